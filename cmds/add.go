@@ -0,0 +1,215 @@
+package cmds
+
+import (
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/antoniszczepanik/gggit/common"
+	"github.com/antoniszczepanik/gggit/ignore"
+	"github.com/antoniszczepanik/gggit/index"
+)
+
+func Add(args []string) {
+	flags := flag.NewFlagSet("add", flag.ExitOnError)
+	force := flags.Bool("f", false, "allow adding otherwise ignored files")
+	flags.BoolVar(force, "force", false, "same as -f")
+	flags.Parse(args)
+	if flags.NArg() == 0 {
+		common.Usage("specify files you would like to add")
+	}
+	repoRoot, err := common.GetRepoRoot("")
+	if err != nil {
+		common.Usage("not a git repository (or any of the parent directories)")
+	}
+	idx, err := index.Read()
+	if err != nil {
+		common.Usage(err.Error())
+	}
+	a := &adder{idx: idx, repoRoot: repoRoot, force: *force, queued: make(map[string]bool)}
+	if a.matcher, err = ignore.New(repoRoot); err != nil {
+		common.Usage(err.Error())
+	}
+	for _, pathspec := range flags.Args() {
+		if err := a.addPathspec(pathspec); err != nil {
+			common.Usage(err.Error())
+		}
+	}
+	if err := a.addFiles(); err != nil {
+		common.Usage(err.Error())
+	}
+	if err := idx.Write(); err != nil {
+		common.Usage(err.Error())
+	}
+	if len(a.ignored) > 0 {
+		common.Usage(fmt.Sprintf("The following paths are ignored by one of your %s files:\n%s\nUse -f if you really want to add them.",
+			ignore.IgnoreFileName, strings.Join(a.ignored, "\n")))
+	}
+}
+
+type adder struct {
+	idx      *index.Index
+	repoRoot string
+	matcher  *ignore.Matcher
+	force    bool
+	// Ignored paths given explicitly, which were not added.
+	ignored []string
+	// Files to be added, all at once, once pathspecs are walked.
+	files  []string
+	queued map[string]bool
+}
+
+// Check whether an untracked path should be skipped because it is ignored.
+func (a *adder) skip(relPath string, isDir bool) (bool, error) {
+	if len(a.idx.Match(relPath)) > 0 {
+		return false, nil
+	}
+	if a.force {
+		// Even with force, git directories are never added.
+		return ignore.IsGitDir(path.Base(relPath)), nil
+	}
+	return a.matcher.IsIgnored(relPath, isDir)
+}
+
+// Stage all files matching a pathspec. Files that are tracked, but do not
+// exist in working directory anymore are removed from the index. Untracked
+// files are skipped if ignored.
+func (a *adder) addPathspec(pathspec string) error {
+	relPath, err := common.RepoRelPath(a.repoRoot, pathspec)
+	if err != nil {
+		return err
+	}
+	fullPath := filepath.Join(a.repoRoot, filepath.FromSlash(relPath))
+	fi, err := os.Lstat(fullPath)
+	if os.IsNotExist(err) {
+		tracked := a.idx.Match(relPath)
+		if len(tracked) == 0 {
+			return fmt.Errorf("pathspec '%s' did not match any files", pathspec)
+		}
+		for _, e := range tracked {
+			a.idx.Remove(e.Path)
+		}
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if relPath != "" {
+		if skip, err := a.skip(relPath, fi.IsDir()); err != nil {
+			return err
+		} else if skip {
+			a.ignored = append(a.ignored, relPath)
+			return nil
+		}
+	}
+	if !fi.IsDir() {
+		a.addFile(relPath)
+		return nil
+	}
+
+	present := make(map[string]bool)
+	err = filepath.WalkDir(fullPath, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if path == fullPath {
+			return nil
+		}
+		fileRelPath, err := common.RepoRelPath(a.repoRoot, path)
+		if err != nil {
+			return err
+		}
+		if skip, err := a.skip(fileRelPath, d.IsDir()); err != nil {
+			return err
+		} else if skip && d.IsDir() {
+			return filepath.SkipDir
+		} else if skip || d.IsDir() {
+			return nil
+		}
+		present[fileRelPath] = true
+		a.addFile(fileRelPath)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, e := range a.idx.Match(relPath) {
+		if !present[e.Path] {
+			a.idx.Remove(e.Path)
+		}
+	}
+	return nil
+}
+
+// Queue a file to be added.
+func (a *adder) addFile(relPath string) {
+	if a.queued[relPath] {
+		return
+	}
+	a.queued[relPath] = true
+	a.files = append(a.files, relPath)
+}
+
+// Write all queued files, with as many workers as configured, and stage
+// them.
+func (a *adder) addFiles() error {
+	entries, err := index.NewEntriesFromFiles(a.repoRoot, a.files)
+	if err != nil {
+		return fmt.Errorf("add: %w", err)
+	}
+	for _, e := range entries {
+		a.idx.Add(e)
+	}
+	return nil
+}
+
+func Rm(args []string) {
+	flags := flag.NewFlagSet("rm", flag.ExitOnError)
+	cached := flags.Bool("cached", false, "only remove from the index, keep working tree files")
+	recursive := flags.Bool("r", false, "allow recursive removal of directories")
+	flags.Parse(args)
+	if flags.NArg() == 0 {
+		common.Usage("specify files you would like to remove")
+	}
+	repoRoot, err := common.GetRepoRoot("")
+	if err != nil {
+		common.Usage("not a git repository (or any of the parent directories)")
+	}
+	idx, err := index.Read()
+	if err != nil {
+		common.Usage(err.Error())
+	}
+	var removed []string
+	for _, pathspec := range flags.Args() {
+		relPath, err := common.RepoRelPath(repoRoot, pathspec)
+		if err != nil {
+			common.Usage(err.Error())
+		}
+		matches := idx.Match(relPath)
+		if len(matches) == 0 {
+			common.Usage(fmt.Sprintf("pathspec '%s' did not match any files", pathspec))
+		}
+		if !*recursive && (len(matches) > 1 || matches[0].Path != relPath) {
+			common.Usage(fmt.Sprintf("not removing '%s' recursively without -r", pathspec))
+		}
+		for _, e := range matches {
+			idx.Remove(e.Path)
+			removed = append(removed, e.Path)
+		}
+	}
+	if err := idx.Write(); err != nil {
+		common.Usage(err.Error())
+	}
+	for _, path := range removed {
+		if !*cached {
+			err := os.Remove(filepath.Join(repoRoot, filepath.FromSlash(path)))
+			if err != nil && !os.IsNotExist(err) {
+				common.Usage(err.Error())
+			}
+		}
+		fmt.Printf("rm '%s'\n", path)
+	}
+}
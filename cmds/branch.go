@@ -5,27 +5,32 @@ import (
 
 	"github.com/antoniszczepanik/gggit/common"
 	"github.com/antoniszczepanik/gggit/refs"
+	"github.com/antoniszczepanik/gggit/revision"
 )
 
 func Branch(args []string) {
 	switch len(args) {
 	case 0:
 		common.Usage("specify a branch you would like to create")
-	case 1:
-
-               if refs.Exists(args[0]) {
-                       common.Usage(fmt.Sprintf("branch named '%s' already exists", args[0]))
-               }
-		f, err := refs.CreateNewRef(args[0])
-		currentTreeHash, err := refs.GetHeadTreeHash()
-		if err != nil {
-			common.Usage("could not get head tree hash")
+	case 1, 2:
+		if err := refs.ValidateRefName(args[0]); err != nil {
+			common.Usage(err.Error())
+		}
+		if refs.Exists(args[0]) {
+			common.Usage(fmt.Sprintf("branch named '%s' already exists", args[0]))
 		}
-		_, err = f.WriteString(currentTreeHash)
+		startPoint := "HEAD"
+		if len(args) == 2 {
+			startPoint = args[1]
+		}
+		commitHash, err := revision.ResolveCommit(startPoint)
 		if err != nil {
-			common.Usage("could not write current tree hash to new branch ref")
+			common.Usage(fmt.Sprintf("not a valid start point '%s': %v", startPoint, err))
+		}
+		if err := refs.PointBranchAt(args[0], commitHash, refs.ZeroHash, "branch: Created from "+startPoint); err != nil {
+			common.Usage(fmt.Sprintf("could not create branch: %v", err))
 		}
-		fmt.Printf("created a new branch %s pointing at %s\n", args[0], currentTreeHash)
+		fmt.Printf("created a new branch %s pointing at %s\n", args[0], commitHash)
 	default:
 		common.Usage("Too many arguments")
 	}
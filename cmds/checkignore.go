@@ -0,0 +1,73 @@
+package cmds
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/antoniszczepanik/gggit/common"
+	"github.com/antoniszczepanik/gggit/ignore"
+	"github.com/antoniszczepanik/gggit/index"
+)
+
+// Print given paths that are ignored. Exits with 1 if none of them is.
+func CheckIgnore(args []string) {
+	flags := flag.NewFlagSet("check-ignore", flag.ExitOnError)
+	verbose := flags.Bool("v", false, "show the pattern deciding about each path")
+	flags.BoolVar(verbose, "verbose", false, "same as -v")
+	nonMatching := flags.Bool("n", false, "with -v, show paths not matching any pattern as well")
+	flags.BoolVar(nonMatching, "non-matching", false, "same as -n")
+	noIndex := flags.Bool("no-index", false, "do not skip tracked files")
+	flags.Parse(args)
+	if flags.NArg() == 0 {
+		common.Usage("no path specified")
+	}
+	if *nonMatching && !*verbose {
+		common.Usage("--non-matching is only valid with --verbose")
+	}
+	repoRoot, err := common.GetRepoRoot("")
+	if err != nil {
+		common.Usage("not a git repository (or any of the parent directories)")
+	}
+	m, err := ignore.New(repoRoot)
+	if err != nil {
+		common.Usage(err.Error())
+	}
+	idx := &index.Index{}
+	if !*noIndex {
+		if idx, err = index.Read(); err != nil {
+			common.Usage(err.Error())
+		}
+	}
+
+	anyIgnored := false
+	for _, arg := range flags.Args() {
+		relPath, err := common.RepoRelPath(repoRoot, arg)
+		if err != nil {
+			common.Usage(err.Error())
+		}
+		// Tracked files are not subject to ignore rules.
+		var p *ignore.Pattern
+		if _, tracked := idx.Get(relPath); !tracked && relPath != "" {
+			fi, err := os.Stat(filepath.Join(repoRoot, filepath.FromSlash(relPath)))
+			isDir := err == nil && fi.IsDir()
+			if p, err = m.Match(relPath, isDir); err != nil {
+				common.Usage(err.Error())
+			}
+		}
+		ignored := p != nil && !p.Negate
+		anyIgnored = anyIgnored || ignored
+		switch {
+		case *verbose && p != nil:
+			fmt.Printf("%s:%d:%s\t%s\n", p.Source, p.Line, p.Text, arg)
+		case *verbose && *nonMatching:
+			fmt.Printf("::\t%s\n", arg)
+		case ignored:
+			fmt.Println(arg)
+		}
+	}
+	if !anyIgnored {
+		os.Exit(1)
+	}
+}
@@ -1,35 +1,100 @@
 package cmds
 
 import (
+	"flag"
 	"fmt"
 
 	"github.com/antoniszczepanik/gggit/common"
+	"github.com/antoniszczepanik/gggit/objects"
 	"github.com/antoniszczepanik/gggit/refs"
+	"github.com/antoniszczepanik/gggit/revision"
+	"github.com/antoniszczepanik/gggit/worktree"
 )
 
+// Switch to a branch, or detach HEAD at any other revision. "-" stands for
+// the previously checked out branch.
 func Checkout(args []string) {
-	switch len(args) {
+	flags := flag.NewFlagSet("checkout", flag.ExitOnError)
+	force := flags.Bool("force", false, "discard local changes")
+	flags.BoolVar(force, "f", false, "shorthand for --force")
+	flags.Parse(args)
+	switch flags.NArg() {
 	case 0:
 		common.Usage("specify a branch you would like to checkout")
 	case 1:
-		if !refs.Exists(args[0]) {
-			common.Usage(fmt.Sprintf("ref %s does not exist", args[0]))
+		target := flags.Arg(0)
+		if target == "-" {
+			target = "@{-1}"
 		}
-		if err := refs.PointHeadAtBranch(args[0]); err != nil {
+		if n, ok := revision.ParsePreviousCheckout(target); ok {
+			previous, err := revision.PreviousCheckout(n)
+			if err != nil {
+				common.Usage(err.Error())
+			}
+			target = previous
+		}
+		branchName := ""
+		if refs.Exists(target) {
+			branchName = target
+		}
+		targetHash, err := revision.ResolveCommit(target)
+		if err != nil {
+			common.Usage(fmt.Sprintf("pathspec '%s' did not match any revision: %v", flags.Arg(0), err))
+		}
+		repoRoot, err := common.GetRepoRoot("")
+		if err != nil {
+			common.Usage("not a git repository (or any of the parent directories)")
+		}
+		currentHash, err := refs.GetHeadCommitHash()
+		if err == refs.ErrBranchWithoutHash {
+			currentHash = ""
+		} else if err != nil {
+			common.Usage(err.Error())
+		}
+		currentTreeHash := ""
+		if currentHash != "" {
+			current, err := objects.ReadCommit(currentHash)
+			if err != nil {
+				common.Usage(err.Error())
+			}
+			currentTreeHash = current.TreeHash
+		}
+		// Remember where we come from, so that @{-n} can find it.
+		from, err := refs.GetCurrentBranch()
+		if err == refs.ErrDetachedHead {
+			from = currentHash
+		} else if err != nil {
 			common.Usage(err.Error())
 		}
-		// Read refHash and treeHash for stats
-		refHash, err := refs.ReadBranchHash(args[0])
+		targetCommit, err := objects.ReadCommit(targetHash)
 		if err != nil {
 			common.Usage(err.Error())
 		}
-		treeHash, err := refs.GetHeadTreeHash()
+		err = worktree.Checkout(repoRoot, currentTreeHash, targetCommit.TreeHash, *force)
 		if err != nil {
 			common.Usage(err.Error())
 		}
-		fmt.Printf("pointed HEAD at %s\n", treeHash)
-		// TODO: Implement actual checkout logic - update working dir.
-		fmt.Printf("on branch master %s (commit %s)\n", args[0], refHash)
+		if branchName != "" {
+			err = refs.PointHeadAtBranch(branchName)
+		} else {
+			err = refs.DetachHead(targetHash)
+		}
+		if err != nil {
+			common.Usage(err.Error())
+		}
+		to := branchName
+		if to == "" {
+			to = targetHash
+		}
+		if err := refs.LogCheckout(currentHash, targetHash, from, to); err != nil {
+			common.Usage(err.Error())
+		}
+		if branchName != "" {
+			fmt.Printf("Switched to branch '%s' (commit %s)\n", branchName, targetHash)
+		} else {
+			subject, _ := splitMessage(targetCommit.Msg)
+			fmt.Printf("HEAD is now at %s %s\n", targetHash[:abbrevLength], subject)
+		}
 	default:
 		common.Usage("Too many arguments")
 	}
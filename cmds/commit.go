@@ -1,35 +1,121 @@
 package cmds
 
 import (
+	"errors"
+	"flag"
 	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"unicode"
 
+	"github.com/antoniszczepanik/gggit/common"
+	"github.com/antoniszczepanik/gggit/config"
+	"github.com/antoniszczepanik/gggit/index"
 	"github.com/antoniszczepanik/gggit/objects"
 	"github.com/antoniszczepanik/gggit/refs"
-	"github.com/antoniszczepanik/gggit/common"
+	"github.com/antoniszczepanik/gggit/worktree"
 )
 
+const commitEditMsgFile = "COMMIT_EDITMSG"
+
+const commitMsgInstructions = `
+# Please enter the commit message for your changes. Lines starting
+# with '#' will be ignored, and an empty message aborts the commit.
+#
+`
+
+// Flag value that can be given multiple times.
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ", ")
+}
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+type commitMsgOptions struct {
+	messages          stringList
+	file              string
+	template          string
+	allowEmptyMessage bool
+}
+
 func Commit(args []string) {
+	flags := flag.NewFlagSet("commit", flag.ExitOnError)
+	opts := commitMsgOptions{}
+	flags.Var(&opts.messages, "m", "use the given message, multiple -m are concatenated as separate paragraphs")
+	flags.Var(&opts.messages, "message", "same as -m")
+	flags.StringVar(&opts.file, "F", "", "take the message from the given file, - reads from standard input")
+	flags.StringVar(&opts.file, "file", "", "same as -F")
+	flags.StringVar(&opts.template, "t", "", "use contents of the given file as initial message in the editor")
+	flags.StringVar(&opts.template, "template", "", "same as -t")
+	flags.BoolVar(&opts.allowEmptyMessage, "allow-empty-message", false, "allow commits with an empty message")
+	flags.Parse(args)
+	if flags.NArg() > 0 {
+		common.Usage("Too many arguments")
+	}
+	if len(opts.messages) > 0 && opts.file != "" {
+		common.Usage("options -m and -F cannot be used together")
+	}
 	repoRoot, err := common.GetRepoRoot("")
 	if err != nil {
 		common.Usage("not a git repository (or any of the parent directories)")
 	}
 
-	treeHash, err := objects.HashTree(repoRoot, true)
+	idx, err := index.Read()
 	if err != nil {
 		common.Usage(err.Error())
 	}
-	// TODO: Add possibility to specify own message.
-	msg := "Hello from gggit."
-
+	if len(idx.Entries) == 0 {
+		common.Usage("nothing added to commit (use \"gggit add\" to track files)")
+	}
+	if idx.HasConflicts() {
+		common.Usage("committing is not possible because you have unmerged files (fix them and use \"gggit add\")")
+	}
+	treeHash, err := idx.WriteTree()
+	if err != nil {
+		common.Usage(err.Error())
+	}
+	var parents []string
 	parentHash, err := refs.GetHeadCommitHash()
 	if err == refs.ErrBranchWithoutHash {
 		parentHash = ""
 	} else if err != nil {
 		common.Usage(err.Error())
 	}
-	c, err := objects.CreateCommitObject(treeHash, parentHash, msg)
+	mergeHash, mergeMsg, err := refs.ReadMergeHead()
+	if err == refs.ErrNoMergeInProgress {
+		mergeHash = ""
+	} else if err != nil {
+		common.Usage(err.Error())
+	}
+	if parentHash != "" {
+		parents = append(parents, parentHash)
+	}
+	if mergeHash != "" {
+		// Concluding a merge, tree might be the same as of the first parent.
+		parents = append(parents, mergeHash)
+	} else if parentHash != "" {
+		parent, err := objects.ReadCommit(parentHash)
+		if err != nil {
+			common.Usage(err.Error())
+		}
+		if parent.TreeHash == treeHash {
+			common.Usage("nothing to commit, working tree clean")
+		}
+	}
+	msg, err := getCommitMessage(repoRoot, opts, mergeMsg)
 	if err != nil {
-		common.Usage("failed to create commit object")
+		common.Usage(err.Error())
+	}
+	c, err := objects.CreateCommitObject(treeHash, parents, msg)
+	if err != nil {
+		common.Usage(err.Error())
 	}
 	err = objects.Write(c)
 	if err != nil {
@@ -39,23 +125,196 @@ func Commit(args []string) {
 	if err != nil {
 		common.Usage("could not get hash for new commit")
 	}
+	// Fail rather than lose commits if someone else moved the branch.
+	oldHash := parentHash
+	if oldHash == "" {
+		oldHash = refs.ZeroHash
+	}
+	subject, _ := splitMessage(msg)
 	branchName, err := refs.GetCurrentBranch()
+	if err == refs.ErrDetachedHead {
+		if err := refs.MoveDetachedHead(commitHash, oldHash, commitLogPrefix(parents)+subject); err != nil {
+			fmt.Println(err)
+			common.Usage("cannot update HEAD")
+		}
+	} else if err != nil {
+		common.Usage(fmt.Sprintf("cannot get current ref: %v", err))
+	} else {
+		err = refs.PointBranchAt(branchName, commitHash, oldHash, commitLogPrefix(parents)+subject)
+		if err != nil {
+			fmt.Println(err)
+			common.Usage("cannot update current ref")
+		}
+		err = refs.PointHeadAtBranch(branchName)
+		if err != nil {
+			fmt.Println(err)
+			common.Usage("could not checkout the new ref")
+		}
+	}
+	if err := refs.FinishMerge(); err != nil {
+		common.Usage(err.Error())
+	}
+	fmt.Printf("commit %s\n", commitHash)
+	err = objects.PrintObject(commitHash)
 	if err != nil {
-		common.Usage("cannot get current ref. Are you in detached HEAD mode?")
+		common.Usage("could not print commit content")
+	}
+}
+
+// Get commit message from -m options, a file or the editor. Messages
+// prepared in the editor are stripped of comments, initial content comes
+// from a template (-t or commit.template) or the message of an interrupted
+// merge.
+func getCommitMessage(repoRoot string, opts commitMsgOptions, mergeMsg string) (string, error) {
+	var msg string
+	switch {
+	case len(opts.messages) > 0:
+		msg = cleanupMessage(strings.Join(opts.messages, "\n\n"), false)
+	case opts.file == "-":
+		content, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			return "", err
+		}
+		msg = cleanupMessage(string(content), false)
+	case opts.file != "":
+		content, err := os.ReadFile(opts.file)
+		if err != nil {
+			return "", err
+		}
+		msg = cleanupMessage(string(content), false)
+	default:
+		initial := mergeMsg
+		if opts.template == "" {
+			c, err := config.Load()
+			if err != nil {
+				return "", err
+			}
+			if opts.template, err = c.GetPath("commit.template", ""); err != nil {
+				return "", err
+			}
+		}
+		if opts.template != "" {
+			content, err := os.ReadFile(opts.template)
+			if err != nil {
+				return "", fmt.Errorf("could not read template: %w", err)
+			}
+			initial = string(content)
+		}
+		content, err := editCommitMessage(repoRoot, initial)
+		if err != nil {
+			return "", err
+		}
+		msg = cleanupMessage(content, true)
+		if opts.template != "" && msg == cleanupMessage(initial, true) {
+			return "", errors.New("aborting commit, you did not edit the message")
+		}
+	}
+	if msg == "" && !opts.allowEmptyMessage {
+		return "", errors.New("aborting commit due to empty commit message")
 	}
-	err = refs.PointBranchAt(branchName, commitHash)
+	return msg, nil
+}
+
+// Let the user write the message in $GGGIT_EDITOR or $EDITOR. The file
+// opened in the editor includes instructions and a status summary as
+// comments.
+func editCommitMessage(repoRoot, initial string) (string, error) {
+	msgPath, err := common.GetGitFilePath(commitEditMsgFile)
 	if err != nil {
-		fmt.Println(err)
-		common.Usage("cannot update current ref")
+		return "", err
 	}
-	err = refs.PointHeadAtBranch(branchName)
+	var b strings.Builder
+	b.WriteString(initial)
+	if initial != "" && !strings.HasSuffix(initial, "\n") {
+		b.WriteString("\n")
+	}
+	b.WriteString(commitMsgInstructions)
+	summary, err := commitStatusSummary(repoRoot)
 	if err != nil {
-		fmt.Println(err)
-		common.Usage("could not checkout the new ref")
+		return "", err
 	}
-	fmt.Printf("commit %s\n", commitHash)
-	err = objects.PrintObject(commitHash)
+	for _, line := range strings.Split(strings.TrimRight(summary, "\n"), "\n") {
+		b.WriteString(strings.TrimRight("# "+line, " ") + "\n")
+	}
+	if err := os.WriteFile(msgPath, []byte(b.String()), 0644); err != nil {
+		return "", err
+	}
+
+	return launchEditor(msgPath)
+}
+
+// Open a file in $GGGIT_EDITOR or $EDITOR and return its contents once the
+// editor exits.
+func launchEditor(path string) (string, error) {
+	editor := os.Getenv("GGGIT_EDITOR")
+	if editor == "" {
+		editor = os.Getenv("EDITOR")
+	}
+	if editor == "" {
+		editor = "vi"
+	}
+	// Run through shell, so that editors can be given with arguments.
+	cmd := exec.Command("sh", "-c", editor+` "$@"`, editor, path)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("problem with the editor '%s': %w", editor, err)
+	}
+	content, err := os.ReadFile(path)
 	if err != nil {
-		common.Usage("could not print commit content")
+		return "", err
+	}
+	return string(content), nil
+}
+
+func commitStatusSummary(repoRoot string) (string, error) {
+	var b strings.Builder
+	branchName, err := refs.GetCurrentBranch()
+	if err == refs.ErrDetachedHead {
+		b.WriteString("HEAD detached\n")
+	} else if err != nil {
+		return "", err
+	} else {
+		fmt.Fprintf(&b, "On branch %s\n", branchName)
+	}
+	headTreeHash, err := refs.GetHeadTreeHash()
+	if err == refs.ErrBranchWithoutHash {
+		headTreeHash = ""
+	} else if err != nil {
+		return "", err
+	}
+	status, err := worktree.GetStatus(repoRoot, headTreeHash)
+	if err != nil {
+		return "", err
+	}
+	writeStatusSections(&b, status)
+	return b.String(), nil
+}
+
+// Remove trailing whitespace, leading and trailing empty lines and collapse
+// consecutive empty lines. Lines starting with '#' are removed as well if
+// stripComments is set.
+func cleanupMessage(msg string, stripComments bool) string {
+	var lines []string
+	for _, line := range strings.Split(msg, "\n") {
+		if stripComments && strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimRightFunc(line, unicode.IsSpace)
+		if line == "" && (len(lines) == 0 || lines[len(lines)-1] == "") {
+			continue
+		}
+		lines = append(lines, line)
+	}
+	return strings.TrimRight(strings.Join(lines, "\n"), "\n")
+}
+
+// Get reason recorded in logs for a commit with given parents.
+func commitLogPrefix(parents []string) string {
+	switch len(parents) {
+	case 0:
+		return "commit (initial): "
+	case 1:
+		return "commit: "
 	}
+	return "commit (merge): "
 }
@@ -0,0 +1,201 @@
+package cmds
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/antoniszczepanik/gggit/common"
+	"github.com/antoniszczepanik/gggit/config"
+	"github.com/antoniszczepanik/gggit/objects"
+)
+
+func Config(args []string) {
+	flags := flag.NewFlagSet("config", flag.ExitOnError)
+	get := flags.Bool("get", false, "print the value of a key")
+	set := flags.Bool("set", false, "set a key to a value")
+	unset := flags.Bool("unset", false, "remove a key")
+	list := flags.Bool("list", false, "list all variables with their values")
+	flags.BoolVar(list, "l", false, "same as --list")
+	showOrigin := flags.Bool("show-origin", false, "show the file each value comes from")
+	system := flags.Bool("system", false, "use the system-wide config file")
+	global := flags.Bool("global", false, "use the per-user config file")
+	local := flags.Bool("local", false, "use the repository config file")
+	file := flags.String("file", "", "use the given config file")
+	flags.StringVar(file, "f", "", "same as --file")
+	valueType := flags.String("type", "", "interpret the value as bool, int or path")
+	flags.Parse(args)
+
+	scopes := 0
+	for _, chosen := range []bool{*system, *global, *local, *file != ""} {
+		if chosen {
+			scopes++
+		}
+	}
+	if scopes > 1 {
+		common.Usage("only one config file at a time")
+	}
+	actions := 0
+	for _, chosen := range []bool{*get, *set, *unset, *list} {
+		if chosen {
+			actions++
+		}
+	}
+	if actions > 1 {
+		common.Usage("only one action at a time")
+	}
+	// Without an explicit action, a key alone is a lookup and a key with
+	// a value is an assignment.
+	if actions == 0 {
+		switch flags.NArg() {
+		case 1:
+			*get = true
+		case 2:
+			*set = true
+		default:
+			common.Usage("usage: gggit config [<file-option>] [--get|--set|--unset|--list] [<key> [<value>]]")
+		}
+	}
+
+	path, scope := "", config.LocalScope
+	switch {
+	case *system:
+		scope = config.SystemScope
+	case *global:
+		scope = config.GlobalScope
+	case *file != "":
+		path = *file
+	}
+	if path == "" && (scopes > 0 || *set || *unset) {
+		var err error
+		if path, err = config.ScopePath(scope); err != nil {
+			common.Usage("not in a git directory, use --global or --file")
+		}
+	}
+	if scope == config.LocalScope && *file == "" && (*set || *unset) {
+		if err := common.CheckWritable(); err != nil {
+			common.Usage(err.Error())
+		}
+	}
+
+	if (*set || *unset) && flags.NArg() > 0 {
+		checkTreeFormatChange(path, flags.Arg(0))
+	}
+
+	switch {
+	case *list:
+		if flags.NArg() != 0 {
+			common.Usage("wrong number of arguments, should be 0")
+		}
+		c := loadConfig(path, scope)
+		for _, e := range c.Entries {
+			line := e.Key
+			if !e.NoValue {
+				line += "=" + e.Value
+			}
+			printConfigLine(e, line, *showOrigin)
+		}
+	case *get:
+		if flags.NArg() != 1 {
+			common.Usage("wrong number of arguments, should be 1")
+		}
+		c := loadConfig(path, scope)
+		e, err := c.Lookup(flags.Arg(0))
+		if err == config.ErrKeyNotFound {
+			os.Exit(1)
+		} else if err != nil {
+			common.Usage(err.Error())
+		}
+		value, err := typedConfigValue(c, flags.Arg(0), e, *valueType)
+		if err != nil {
+			common.Usage(err.Error())
+		}
+		printConfigLine(e, value, *showOrigin)
+	case *set:
+		if flags.NArg() != 2 {
+			common.Usage("wrong number of arguments, should be 2")
+		}
+		if err := config.Set(path, flags.Arg(0), flags.Arg(1)); err != nil {
+			common.Usage(err.Error())
+		}
+	case *unset:
+		if flags.NArg() != 1 {
+			common.Usage("wrong number of arguments, should be 1")
+		}
+		err := config.Unset(path, flags.Arg(0))
+		if err == config.ErrKeyNotFound {
+			os.Exit(5)
+		} else if err != nil {
+			common.Usage(err.Error())
+		}
+	}
+}
+
+// Refuse to change tree format in the repository configuration once trees
+// are stored. It is only ever read from there.
+func checkTreeFormatChange(path, key string) {
+	key, err := config.NormalizeKey(key)
+	if err != nil {
+		return
+	}
+	formatKey, err := config.NormalizeKey(objects.TreeFormatKey)
+	if err != nil || key != formatKey {
+		return
+	}
+	localPath, err := config.ScopePath(config.LocalScope)
+	if err != nil || !samePath(path, localPath) {
+		return
+	}
+	if err := objects.CheckTreeFormatChangeable(); err != nil {
+		common.Usage(err.Error())
+	}
+}
+
+func samePath(a, b string) bool {
+	absA, errA := filepath.Abs(a)
+	absB, errB := filepath.Abs(b)
+	return errA == nil && errB == nil && absA == absB
+}
+
+// Load config from a single file, or all layers if path is empty.
+func loadConfig(path string, scope config.Scope) *config.Config {
+	var c *config.Config
+	var err error
+	if path == "" {
+		c, err = config.Load()
+	} else {
+		c, err = config.LoadFile(path, scope)
+	}
+	if err != nil {
+		common.Usage(err.Error())
+	}
+	return c
+}
+
+// Print value normalized to its type, so that scripts do not need to know
+// all accepted spellings of booleans and numbers.
+func typedConfigValue(c *config.Config, key string, e config.Entry, valueType string) (string, error) {
+	switch valueType {
+	case "":
+		return e.Value, nil
+	case "bool":
+		b, err := c.GetBool(key, false)
+		return strconv.FormatBool(b), err
+	case "int":
+		n, err := c.GetInt(key, 0)
+		return strconv.Itoa(n), err
+	case "path":
+		return c.GetPath(key, "")
+	}
+	return "", fmt.Errorf("unrecognized --type argument, %s", valueType)
+}
+
+func printConfigLine(e config.Entry, line string, showOrigin bool) {
+	if showOrigin {
+		fmt.Printf("file:%s\t%s\n", e.Origin, line)
+	} else {
+		fmt.Println(line)
+	}
+}
@@ -0,0 +1,316 @@
+package cmds
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/antoniszczepanik/gggit/common"
+	"github.com/antoniszczepanik/gggit/diff"
+	"github.com/antoniszczepanik/gggit/index"
+	"github.com/antoniszczepanik/gggit/objects"
+	"github.com/antoniszczepanik/gggit/refs"
+	"github.com/antoniszczepanik/gggit/worktree"
+)
+
+const (
+	nullHash    = "0000000000000000000000000000000000000000"
+	maxStatBars = 40
+)
+
+// Compare working directory with the index (default), the index with a
+// commit (--cached [<commit>]), working directory with a commit
+// (<commit>) or two commits (<commit> <commit>).
+func Diff(args []string) {
+	flags := flag.NewFlagSet("diff", flag.ExitOnError)
+	cached := flags.Bool("cached", false, "compare the index with HEAD or a given commit")
+	stat := flags.Bool("stat", false, "show a diffstat instead of a patch")
+	nameStatus := flags.Bool("name-status", false, "show only names and status of changed files")
+	context := flags.Int("U", diff.DefaultContext, "number of context lines")
+	flags.IntVar(context, "unified", diff.DefaultContext, "number of context lines")
+	args, dashes := parseInterspersed(flags, attachContextValue(args))
+	if *context < 0 {
+		common.Usage("number of context lines cannot be negative")
+	}
+
+	repoRoot, err := common.GetRepoRoot("")
+	if err != nil {
+		common.Usage("not a git repository (or any of the parent directories)")
+	}
+	var revisions, paths []string
+	if dashes >= 0 {
+		revisions, paths = args[:dashes], args[dashes:]
+	} else {
+		revisions, paths = splitRevisionsAndPaths(args)
+	}
+	oldTree, newTree, err := diffSides(repoRoot, revisions, *cached)
+	if err != nil {
+		common.Usage(err.Error())
+	}
+	changes, err := diff.CompareTrees(oldTree, newTree)
+	if err != nil {
+		common.Usage(err.Error())
+	}
+	changes, err = filterChanges(repoRoot, changes, paths)
+	if err != nil {
+		common.Usage(err.Error())
+	}
+
+	switch {
+	case *nameStatus:
+		for _, c := range changes {
+			fmt.Printf("%c\t%s\n", c.Status, c.Path)
+		}
+	case *stat:
+		err = printDiffStat(changes)
+	default:
+		for _, c := range changes {
+			if err = printFileDiff(c, *context); err != nil {
+				break
+			}
+		}
+	}
+	if err != nil {
+		common.Usage(err.Error())
+	}
+}
+
+// Like git, accept number of context lines attached to -U, e.g. "-U0",
+// which is not a flag the flag package knows of.
+func attachContextValue(args []string) []string {
+	attached := make([]string, len(args))
+	for i, arg := range args {
+		if arg == "--" {
+			copy(attached[i:], args[i:])
+			break
+		}
+		if strings.HasPrefix(arg, "-U") && len(arg) > 2 && arg[2] != '=' {
+			arg = "-U=" + arg[2:]
+		}
+		attached[i] = arg
+	}
+	return attached
+}
+
+// Split positional arguments, given without "--", into revisions and paths.
+// Leading arguments are revisions as long as they resolve to a tree-ish.
+func splitRevisionsAndPaths(args []string) ([]string, []string) {
+	i := 0
+	for i < len(args) {
+		if _, err := resolveTree(args[i]); err != nil {
+			break
+		}
+		i++
+	}
+	for _, path := range args[i:] {
+		if _, err := os.Stat(path); err != nil {
+			common.Usage(fmt.Sprintf("ambiguous argument '%s': unknown revision or path not in the working tree", path))
+		}
+	}
+	return args[:i], args[i:]
+}
+
+// Get trees that should be compared.
+func diffSides(repoRoot string, revisions []string, cached bool) (objects.Tree, objects.Tree, error) {
+	if len(revisions) > 2 || (cached && len(revisions) > 1) {
+		return nil, nil, fmt.Errorf("too many revisions")
+	}
+	if len(revisions) == 2 {
+		oldTree, err := resolveTree(revisions[0])
+		if err != nil {
+			return nil, nil, err
+		}
+		newTree, err := resolveTree(revisions[1])
+		return oldTree, newTree, err
+	}
+
+	idx, err := index.Read()
+	if err != nil {
+		return nil, nil, err
+	}
+	var oldTree objects.Tree
+	if len(revisions) == 1 {
+		if oldTree, err = resolveTree(revisions[0]); err != nil {
+			return nil, nil, err
+		}
+	} else if cached {
+		if oldTree, err = resolveTree("HEAD"); err != nil {
+			if _, headErr := refs.GetHeadCommitHash(); headErr != refs.ErrBranchWithoutHash {
+				return nil, nil, err
+			}
+			// Everything staged on a branch without commits is new.
+			oldTree = nil
+		}
+	} else {
+		if oldTree, err = idx.Tree(); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	if cached {
+		newTree, err := idx.Tree()
+		return oldTree, newTree, err
+	}
+	newTree, err := worktree.WorkdirTree(repoRoot, idx)
+	return oldTree, newTree, err
+}
+
+func filterChanges(repoRoot string, changes []diff.FileChange, paths []string) ([]diff.FileChange, error) {
+	if len(paths) == 0 {
+		return changes, nil
+	}
+	var pathspecs []string
+	for _, path := range paths {
+		relPath, err := common.RepoRelPath(repoRoot, path)
+		if err != nil {
+			return nil, err
+		}
+		pathspecs = append(pathspecs, relPath)
+	}
+	var filtered []diff.FileChange
+	for _, c := range changes {
+		for _, pathspec := range pathspecs {
+			if index.MatchesPathspec(c.Path, pathspec) {
+				filtered = append(filtered, c)
+				break
+			}
+		}
+	}
+	return filtered, nil
+}
+
+func printFileDiff(c diff.FileChange, context int) error {
+	oldContent, newContent, err := changeContents(c)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("diff --git a/%s b/%s\n", c.Path, c.Path)
+	oldHash, newHash := c.Old.Hash, c.New.Hash
+	modeSuffix := ""
+	switch c.Status {
+	case diff.Added:
+		oldHash = nullHash
+		fmt.Printf("new file mode %s\n", c.New.Mode)
+	case diff.Deleted:
+		newHash = nullHash
+		fmt.Printf("deleted file mode %s\n", c.Old.Mode)
+	default:
+		if c.Old.Mode != c.New.Mode {
+			fmt.Printf("old mode %s\nnew mode %s\n", c.Old.Mode, c.New.Mode)
+		} else {
+			modeSuffix = " " + c.Old.Mode
+		}
+	}
+	if oldHash == newHash {
+		// Only the mode changed.
+		return nil
+	}
+	fmt.Printf("index %s..%s%s\n", oldHash[:abbrevLength], newHash[:abbrevLength], modeSuffix)
+	oldName, newName := "a/"+c.Path, "b/"+c.Path
+	if c.Status == diff.Added {
+		oldName = "/dev/null"
+	}
+	if c.Status == diff.Deleted {
+		newName = "/dev/null"
+	}
+	if diff.IsBinary(oldContent) || diff.IsBinary(newContent) {
+		fmt.Printf("Binary files %s and %s differ\n", oldName, newName)
+		return nil
+	}
+	fmt.Printf("--- %s\n+++ %s\n", oldName, newName)
+	return diff.Unified(os.Stdout, oldContent, newContent, context)
+}
+
+// Get contents of both sides of a change. Missing sides are empty.
+func changeContents(c diff.FileChange) (string, string, error) {
+	var oldContent, newContent string
+	var err error
+	if c.Status != diff.Added {
+		if oldContent, err = diff.EntryContent(c.Old); err != nil {
+			return "", "", err
+		}
+	}
+	if c.Status != diff.Deleted {
+		if newContent, err = diff.EntryContent(c.New); err != nil {
+			return "", "", err
+		}
+	}
+	return oldContent, newContent, nil
+}
+
+func printDiffStat(changes []diff.FileChange) error {
+	type fileStat struct {
+		path       string
+		insertions int
+		deletions  int
+		binary     bool
+	}
+	var stats []fileStat
+	nameWidth, maxChanges := 0, 0
+	totalInsertions, totalDeletions := 0, 0
+	for _, c := range changes {
+		oldContent, newContent, err := changeContents(c)
+		if err != nil {
+			return err
+		}
+		s := fileStat{path: c.Path}
+		if diff.IsBinary(oldContent) || diff.IsBinary(newContent) {
+			s.binary = true
+		} else {
+			edits := diff.Myers(diff.Lines(oldContent), diff.Lines(newContent))
+			s.insertions, s.deletions = diff.CountChanges(edits)
+		}
+		stats = append(stats, s)
+		if len(s.path) > nameWidth {
+			nameWidth = len(s.path)
+		}
+		if s.insertions+s.deletions > maxChanges {
+			maxChanges = s.insertions + s.deletions
+		}
+		totalInsertions += s.insertions
+		totalDeletions += s.deletions
+	}
+	for _, s := range stats {
+		if s.binary {
+			fmt.Printf(" %-*s | Bin\n", nameWidth, s.path)
+			continue
+		}
+		plus, minus := s.insertions, s.deletions
+		// Scale bars down so that they fit, keeping at least one mark for
+		// any change.
+		if maxChanges > maxStatBars {
+			plus = scaleStat(plus, maxChanges)
+			minus = scaleStat(minus, maxChanges)
+		}
+		fmt.Printf(" %-*s | %d %s%s\n", nameWidth, s.path, s.insertions+s.deletions,
+			strings.Repeat("+", plus), strings.Repeat("-", minus))
+	}
+	summary := fmt.Sprintf(" %d %s changed", len(stats), plural(len(stats), "file", "files"))
+	if totalInsertions > 0 || totalDeletions == 0 {
+		summary += fmt.Sprintf(", %d %s(+)", totalInsertions, plural(totalInsertions, "insertion", "insertions"))
+	}
+	if totalDeletions > 0 || totalInsertions == 0 {
+		summary += fmt.Sprintf(", %d %s(-)", totalDeletions, plural(totalDeletions, "deletion", "deletions"))
+	}
+	fmt.Println(summary)
+	return nil
+}
+
+func scaleStat(n, max int) int {
+	if n == 0 {
+		return 0
+	}
+	scaled := n * maxStatBars / max
+	if scaled == 0 {
+		return 1
+	}
+	return scaled
+}
+
+func plural(n int, singular, pluralForm string) string {
+	if n == 1 {
+		return singular
+	}
+	return pluralForm
+}
@@ -0,0 +1,23 @@
+package cmds
+
+import "flag"
+
+// Parse flags which, like in git, may follow positional arguments as well,
+// e.g. "tag -a v1 -m msg". Returns positional arguments and number of those
+// given before "--", or -1 if there was none. Everything after "--" is
+// positional.
+func parseInterspersed(flags *flag.FlagSet, args []string) ([]string, int) {
+	var positional []string
+	for {
+		flags.Parse(args)
+		rest := flags.Args()
+		if len(rest) < len(args) && args[len(args)-len(rest)-1] == "--" {
+			return append(positional, rest...), len(positional)
+		}
+		if len(rest) == 0 {
+			return positional, -1
+		}
+		positional = append(positional, rest[0])
+		args = rest[1:]
+	}
+}
@@ -0,0 +1,40 @@
+package cmds
+
+import (
+	"flag"
+	"reflect"
+	"testing"
+)
+
+func TestParseInterspersed(t *testing.T) {
+	tests := []struct {
+		args       []string
+		positional []string
+		dashes     int
+		stat       bool
+		context    int
+	}{
+		{nil, nil, -1, false, 3},
+		{[]string{"a", "b"}, []string{"a", "b"}, -1, false, 3},
+		{[]string{"--stat", "a", "b"}, []string{"a", "b"}, -1, true, 3},
+		{[]string{"a", "b", "--stat"}, []string{"a", "b"}, -1, true, 3},
+		{[]string{"a", "-U", "1", "b", "--stat"}, []string{"a", "b"}, -1, true, 1},
+		{[]string{"-U0", "a"}, []string{"a"}, -1, false, 0},
+		{[]string{"a", "-U10"}, []string{"a"}, -1, false, 10},
+		{[]string{"a", "--", "-U0", "--stat"}, []string{"a", "-U0", "--stat"}, 1, false, 3},
+		{[]string{"--", "a"}, []string{"a"}, 0, false, 3},
+		{[]string{"a", "--"}, []string{"a"}, 1, false, 3},
+	}
+	for _, test := range tests {
+		flags := flag.NewFlagSet("test", flag.ContinueOnError)
+		stat := flags.Bool("stat", false, "")
+		context := flags.Int("U", 3, "")
+		positional, dashes := parseInterspersed(flags, attachContextValue(test.args))
+		if !reflect.DeepEqual(positional, test.positional) || dashes != test.dashes {
+			t.Errorf("%q: got %q with %d before --, want %q with %d", test.args, positional, dashes, test.positional, test.dashes)
+		}
+		if *stat != test.stat || *context != test.context {
+			t.Errorf("%q: got stat %v and context %d, want %v and %d", test.args, *stat, *context, test.stat, test.context)
+		}
+	}
+}
@@ -0,0 +1,36 @@
+package cmds
+
+import (
+	"flag"
+	"fmt"
+
+	"github.com/antoniszczepanik/gggit/common"
+	"github.com/antoniszczepanik/gggit/fsck"
+)
+
+// Verify integrity of the object database, printing one line per problem.
+// Exits with an error if anything other than dangling objects is found.
+func Fsck(args []string) {
+	flags := flag.NewFlagSet("fsck", flag.ExitOnError)
+	noDangling := flags.Bool("no-dangling", false, "do not report dangling objects")
+	flags.Parse(args)
+	if flags.NArg() != 0 {
+		common.Usage("fsck does not take any arguments")
+	}
+	problems, err := fsck.Check()
+	if err != nil {
+		common.Usage(err.Error())
+	}
+	failed := 0
+	for _, p := range problems {
+		if p.IsError() {
+			failed++
+		} else if *noDangling {
+			continue
+		}
+		fmt.Println(p)
+	}
+	if failed > 0 {
+		common.Usage(fmt.Sprintf("fsck: found %d %s", failed, plural(failed, "error", "errors")))
+	}
+}
@@ -0,0 +1,119 @@
+package cmds
+
+import (
+	"flag"
+	"fmt"
+	"time"
+
+	"github.com/antoniszczepanik/gggit/common"
+	"github.com/antoniszczepanik/gggit/gc"
+	"github.com/antoniszczepanik/gggit/objects"
+)
+
+// Remove unreachable objects older than the grace period and pack all
+// reachable ones together.
+func Gc(args []string) {
+	flags := flag.NewFlagSet("gc", flag.ExitOnError)
+	pruneExpire := flags.String("prune", "", "prune unreachable objects older than that, "+gc.DefaultPruneExpire+" by default")
+	dryRun := flags.Bool("dry-run", false, "only list objects that would be removed")
+	flags.BoolVar(dryRun, "n", false, "same as --dry-run")
+	quiet := flags.Bool("q", false, "do not print any summary")
+	flags.Parse(args)
+	if flags.NArg() != 0 {
+		common.Usage("gc does not take any arguments")
+	}
+	expire, err := gc.PruneExpire(*pruneExpire)
+	if err != nil {
+		common.Usage(err.Error())
+	}
+	reachable, garbage := findGarbage(expire, true)
+	if *dryRun {
+		printGarbage(garbage)
+		return
+	}
+	if err := gc.RemoveLoose(garbage); err != nil {
+		common.Usage(err.Error())
+	}
+	if err := objects.RemoveTempFiles(expire); err != nil {
+		common.Usage(err.Error())
+	}
+	stats, err := gc.Repack(reachable, expire, objects.DefaultPackOptions)
+	if err != nil {
+		common.Usage(err.Error())
+	}
+	if *quiet {
+		return
+	}
+	printRemoved(garbage)
+	if stats.Name != "" {
+		fmt.Printf("Packed %d %s (%d %s) into %s\n", stats.Objects, plural(stats.Objects, "object", "objects"),
+			stats.Deltas, plural(stats.Deltas, "delta", "deltas"), stats.Name)
+	}
+}
+
+// Remove unreachable loose objects older than the grace period.
+func Prune(args []string) {
+	flags := flag.NewFlagSet("prune", flag.ExitOnError)
+	pruneExpire := flags.String("expire", "", "prune objects older than that, "+gc.DefaultPruneExpire+" by default")
+	dryRun := flags.Bool("dry-run", false, "only list objects that would be removed")
+	flags.BoolVar(dryRun, "n", false, "same as --dry-run")
+	flags.Parse(args)
+	if flags.NArg() != 0 {
+		common.Usage("prune does not take any arguments")
+	}
+	expire, err := gc.PruneExpire(*pruneExpire)
+	if err != nil {
+		common.Usage(err.Error())
+	}
+	_, garbage := findGarbage(expire, false)
+	if *dryRun {
+		printGarbage(garbage)
+		return
+	}
+	if err := gc.RemoveLoose(garbage); err != nil {
+		common.Usage(err.Error())
+	}
+	if err := objects.RemoveTempFiles(expire); err != nil {
+		common.Usage(err.Error())
+	}
+	printRemoved(garbage)
+}
+
+func findGarbage(expire time.Time, packed bool) (map[string]bool, []gc.Garbage) {
+	reachable, err := gc.Reachable()
+	if err != nil {
+		common.Usage(fmt.Sprintf("cannot determine reachable objects: %v", err))
+	}
+	garbage, err := gc.FindGarbage(reachable, expire, packed)
+	if err != nil {
+		common.Usage(err.Error())
+	}
+	return reachable, garbage
+}
+
+// Print "<hash> <type> <bytes>" of each object followed by a summary.
+func printGarbage(garbage []gc.Garbage) {
+	var size int64
+	for _, g := range garbage {
+		where := ""
+		if g.Packed {
+			where = " (packed)"
+		}
+		fmt.Printf("%s %s %d%s\n", g.Hash, g.Type, g.Size, where)
+		size += g.Size
+	}
+	fmt.Printf("Would remove %d unreachable %s, reclaiming %d bytes\n",
+		len(garbage), plural(len(garbage), "object", "objects"), size)
+}
+
+func printRemoved(garbage []gc.Garbage) {
+	if len(garbage) == 0 {
+		return
+	}
+	var size int64
+	for _, g := range garbage {
+		size += g.Size
+	}
+	fmt.Printf("Removed %d unreachable %s, reclaiming %d bytes\n",
+		len(garbage), plural(len(garbage), "object", "objects"), size)
+}
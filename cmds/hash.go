@@ -1,8 +1,10 @@
 package cmds
 
 import (
+	"context"
 	"fmt"
 	"os"
+	"os/signal"
 
 	"github.com/antoniszczepanik/gggit/objects"
 	"github.com/antoniszczepanik/gggit/common"
@@ -41,7 +43,10 @@ func hashEntityByType(path string, write bool) (string, error) {
 		return "", err
 	}
 	if fileInfo.IsDir() {
-		return objects.HashTree(path, write)
+		// Interrupting stops all workers hashing files.
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		defer stop()
+		return objects.HashTree(ctx, path, write)
 	}
 	return hashFile(path, write)
 }
@@ -2,22 +2,36 @@ package cmds
 
 import (
 	"errors"
+	"flag"
 	"fmt"
 	"os"
 	"path/filepath"
 
 	"github.com/antoniszczepanik/gggit/common"
+	"github.com/antoniszczepanik/gggit/config"
+	"github.com/antoniszczepanik/gggit/objects"
 )
 
+const defaultExclude = `# Patterns of files to ignore, which are not shared in .gggitignore files.
+# Lines starting with '#' are comments.
+`
+
 func Init(args []string) {
-	path, err := initRepository("")
+	flags := flag.NewFlagSet("init", flag.ExitOnError)
+	treeFormat := flags.String("tree-format", string(objects.TextTreeFormat), "format of tree objects, text or git")
+	flags.Parse(args)
+	format, err := objects.ParseTreeFormat(*treeFormat)
+	if err != nil {
+		common.Usage(err.Error())
+	}
+	path, err := initRepository("", format)
 	if err != nil {
 		fmt.Println(err)
 		os.Exit(1)
 	}
 	fmt.Printf("Created new repository at %v\n", path)
 }
-func initRepository(path string) (string, error) {
+func initRepository(path string, format objects.TreeFormat) (string, error) {
 	var err error
 	if path == "" {
 		path, err = os.Getwd()
@@ -52,6 +66,14 @@ func initRepository(path string) (string, error) {
 	if err != nil {
 		return "", err
 	}
+	err = os.Mkdir(filepath.Join(gitdir, "info"), 0755)
+	if err != nil {
+		return "", err
+	}
+	err = os.WriteFile(filepath.Join(gitdir, "info", "exclude"), []byte(defaultExclude), 0644)
+	if err != nil {
+		return "", err
+	}
 	headFile, err := os.Create(filepath.Join(gitdir, "HEAD"))
 	if err != nil {
 		return "", err
@@ -68,5 +90,16 @@ func initRepository(path string) (string, error) {
 	if err != nil {
 		return "", err
 	}
+	if format != objects.TextTreeFormat {
+		// Version 0 makes git itself accept the repository, as it ignores
+		// extensions it does not know about.
+		configPath := filepath.Join(gitdir, "config")
+		if err := config.Set(configPath, "core.repositoryFormatVersion", "0"); err != nil {
+			return "", err
+		}
+		if err := config.Set(configPath, objects.TreeFormatKey, string(format)); err != nil {
+			return "", err
+		}
+	}
 	return path, nil
 }
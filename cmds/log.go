@@ -0,0 +1,297 @@
+package cmds
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/antoniszczepanik/gggit/common"
+	"github.com/antoniszczepanik/gggit/objects"
+	"github.com/antoniszczepanik/gggit/refs"
+	"github.com/antoniszczepanik/gggit/revision"
+)
+
+const (
+	logDateFmt   = "Mon Jan 2 15:04:05 2006 -0700"
+	abbrevLength = 7
+)
+
+func Log(args []string) {
+	flags := flag.NewFlagSet("log", flag.ExitOnError)
+	oneline := flags.Bool("oneline", false, "show each commit on a single line")
+	maxCount := flags.Int("n", -1, "limit the number of commits to show")
+	format := flags.String("format", "", "pretty-print commits with a template, e.g. \"%h %an %s\"")
+	firstParent := flags.Bool("first-parent", false, "follow only the first parent of merge commits")
+	flags.Parse(args)
+
+	rev, paths := splitRevisionAndPaths(flags.Args())
+	commitHash, err := revision.ResolveCommit(rev)
+	if err == refs.ErrBranchWithoutHash {
+		common.Usage("your current branch does not have any commits yet")
+	} else if err != nil {
+		common.Usage(err.Error())
+	}
+	if *oneline && *format == "" {
+		*format = "%h %s"
+	}
+
+	shown := 0
+	history := newHistoryWalker(commitHash, *firstParent)
+	for shown != *maxCount {
+		hash, c, err := history.next()
+		if err != nil {
+			common.Usage(err.Error())
+		}
+		if hash == "" {
+			break
+		}
+		touched, err := touchesPaths(c, paths)
+		if err != nil {
+			common.Usage(err.Error())
+		}
+		if !touched {
+			continue
+		}
+		if *format != "" {
+			fmt.Println(formatCommit(*format, hash, c))
+		} else {
+			if shown > 0 {
+				fmt.Println()
+			}
+			printCommit(hash, c)
+		}
+		shown++
+	}
+}
+
+// Walks history of a commit, yielding every reachable commit once, newest
+// first.
+type historyWalker struct {
+	firstParent bool
+	pending     []string
+	commits     map[string]objects.Commit
+	seen        map[string]bool
+}
+
+func newHistoryWalker(start string, firstParent bool) *historyWalker {
+	return &historyWalker{
+		firstParent: firstParent,
+		pending:     []string{start},
+		commits:     make(map[string]objects.Commit),
+		seen:        map[string]bool{start: true},
+	}
+}
+
+// Get the next commit, or an empty hash once history is exhausted.
+func (w *historyWalker) next() (string, objects.Commit, error) {
+	if len(w.pending) == 0 {
+		return "", objects.Commit{}, nil
+	}
+	newest := -1
+	for i, hash := range w.pending {
+		c, ok := w.commits[hash]
+		if !ok {
+			var err error
+			if c, err = objects.ReadCommit(hash); err != nil {
+				return "", objects.Commit{}, err
+			}
+			w.commits[hash] = c
+		}
+		if newest == -1 || c.CommitTime.After(w.commits[w.pending[newest]].CommitTime) {
+			newest = i
+		}
+	}
+	hash := w.pending[newest]
+	c := w.commits[hash]
+	w.pending = append(w.pending[:newest], w.pending[newest+1:]...)
+	delete(w.commits, hash)
+	parents := c.Parents
+	if w.firstParent && len(parents) > 1 {
+		parents = parents[:1]
+	}
+	for _, parent := range parents {
+		if !w.seen[parent] {
+			w.seen[parent] = true
+			w.pending = append(w.pending, parent)
+		}
+	}
+	return hash, c, nil
+}
+
+// Split positional log arguments into an optional revision and paths.
+// Everything after "--" is a path, otherwise the first argument is a path
+// only if it does not resolve to a commit.
+func splitRevisionAndPaths(args []string) (string, []string) {
+	for i, arg := range args {
+		if arg == "--" {
+			if i == 0 {
+				return "HEAD", args[1:]
+			}
+			return args[0], args[i+1:]
+		}
+	}
+	if len(args) == 0 {
+		return "HEAD", nil
+	}
+	if _, err := revision.ResolveCommit(args[0]); err == nil {
+		return args[0], args[1:]
+	}
+	if _, err := os.Stat(args[0]); err != nil {
+		common.Usage(fmt.Sprintf("ambiguous argument '%s': unknown revision or path not in the working tree", args[0]))
+	}
+	return "HEAD", args
+}
+
+// Check if commit changes any of the paths compared to its parents. Merge
+// commits touch a path only if it differs from all of the parents. Commits
+// always touch an empty list of paths.
+func touchesPaths(c objects.Commit, paths []string) (bool, error) {
+	if len(paths) == 0 {
+		return true, nil
+	}
+	repoRoot, err := common.GetRepoRoot("")
+	if err != nil {
+		return false, err
+	}
+	tree, err := objects.ReadTree(c.TreeHash)
+	if err != nil {
+		return false, err
+	}
+	// Root commits are compared with an empty tree.
+	parentTrees := []objects.Tree{nil}
+	if len(c.Parents) > 0 {
+		parentTrees = nil
+	}
+	for _, parentHash := range c.Parents {
+		parent, err := objects.ReadCommit(parentHash)
+		if err != nil {
+			return false, err
+		}
+		parentTree, err := objects.ReadTree(parent.TreeHash)
+		if err != nil {
+			return false, err
+		}
+		parentTrees = append(parentTrees, parentTree)
+	}
+	for _, path := range paths {
+		relPath, err := common.RepoRelPath(repoRoot, path)
+		if err != nil {
+			return false, err
+		}
+		if relPath == "" {
+			return true, nil
+		}
+		e, found, err := tree.Find(relPath)
+		if err != nil {
+			return false, err
+		}
+		differsFromAll := true
+		for _, parentTree := range parentTrees {
+			parentEntry, parentFound, err := parentTree.Find(relPath)
+			if err != nil {
+				return false, err
+			}
+			if found == parentFound && e.Hash == parentEntry.Hash && e.Mode == parentEntry.Mode {
+				differsFromAll = false
+				break
+			}
+		}
+		if differsFromAll {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func printCommit(hash string, c objects.Commit) {
+	fmt.Printf("commit %s\n", hash)
+	if len(c.Parents) > 1 {
+		fmt.Printf("Merge: %s\n", abbrevHashes(c.Parents))
+	}
+	fmt.Printf("Author: %s <%s>\n", c.Author.Name, c.Author.Email)
+	fmt.Printf("Date:   %s\n\n", c.Time.Format(logDateFmt))
+	for _, line := range strings.Split(strings.TrimRight(c.Msg, "\n"), "\n") {
+		fmt.Printf("    %s\n", line)
+	}
+}
+
+var placeholderRegex = regexp.MustCompile(`%(H|h|T|t|P|p|an|ae|ad|at|cn|ce|cd|ct|s|b|n|%)`)
+
+// Expand placeholders of a format template:
+//
+//	%H, %h  commit hash, abbreviated commit hash
+//	%T, %t  tree hash, abbreviated tree hash
+//	%P, %p  parent hashes, abbreviated parent hashes
+//	%an     author name
+//	%ae     author email
+//	%ad     author date
+//	%at     author date as unix timestamp
+//	%cn     committer name
+//	%ce     committer email
+//	%cd     committer date
+//	%ct     committer date as unix timestamp
+//	%s, %b  subject and body of the commit message
+//	%n, %%  new line and a literal percent sign
+func formatCommit(format, hash string, c objects.Commit) string {
+	subject, body := splitMessage(c.Msg)
+	return placeholderRegex.ReplaceAllStringFunc(format, func(placeholder string) string {
+		switch placeholder[1:] {
+		case "H":
+			return hash
+		case "h":
+			return hash[:abbrevLength]
+		case "T":
+			return c.TreeHash
+		case "t":
+			return c.TreeHash[:abbrevLength]
+		case "P":
+			return strings.Join(c.Parents, " ")
+		case "p":
+			return abbrevHashes(c.Parents)
+		case "an":
+			return c.Author.Name
+		case "ae":
+			return c.Author.Email
+		case "ad":
+			return c.Time.Format(logDateFmt)
+		case "at":
+			return fmt.Sprint(c.Time.Unix())
+		case "cn":
+			return c.Committer.Name
+		case "ce":
+			return c.Committer.Email
+		case "cd":
+			return c.CommitTime.Format(logDateFmt)
+		case "ct":
+			return fmt.Sprint(c.CommitTime.Unix())
+		case "s":
+			return subject
+		case "b":
+			return body
+		case "n":
+			return "\n"
+		}
+		return "%"
+	})
+}
+
+// Join abbreviated hashes with spaces.
+func abbrevHashes(hashes []string) string {
+	abbrevs := make([]string, len(hashes))
+	for i, hash := range hashes {
+		abbrevs[i] = hash[:abbrevLength]
+	}
+	return strings.Join(abbrevs, " ")
+}
+
+// Split commit message into its first line and the rest.
+func splitMessage(msg string) (string, string) {
+	msg = strings.TrimRight(msg, "\n")
+	i := strings.Index(msg, "\n")
+	if i == -1 {
+		return msg, ""
+	}
+	return msg[:i], strings.TrimLeft(msg[i+1:], "\n")
+}
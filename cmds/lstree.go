@@ -0,0 +1,144 @@
+package cmds
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+
+	"github.com/antoniszczepanik/gggit/common"
+	"github.com/antoniszczepanik/gggit/objects"
+	"github.com/antoniszczepanik/gggit/revision"
+)
+
+type lsTreeOptions struct {
+	recursive bool
+	showTrees bool
+	nameOnly  bool
+	long      bool
+	// Slash separated paths relative to repository root. Trailing slash
+	// means contents of a directory rather than the directory itself.
+	paths []string
+}
+
+func Ls(args []string) {
+	flags := flag.NewFlagSet("ls-tree", flag.ExitOnError)
+	opts := lsTreeOptions{}
+	flags.BoolVar(&opts.recursive, "r", false, "recurse into subtrees")
+	flags.BoolVar(&opts.showTrees, "t", false, "show tree entries even when recursing")
+	flags.BoolVar(&opts.nameOnly, "name-only", false, "list only names of entries")
+	flags.BoolVar(&opts.long, "l", false, "show size of blob entries")
+	flags.Parse(args)
+	if flags.NArg() == 0 {
+		common.Usage("specify a tree-ish you would like to list")
+	}
+	t, err := resolveTree(flags.Arg(0))
+	if err != nil {
+		common.Usage(err.Error())
+	}
+	if flags.NArg() > 1 {
+		repoRoot, err := common.GetRepoRoot("")
+		if err != nil {
+			common.Usage("not a git repository (or any of the parent directories)")
+		}
+		for _, path := range flags.Args()[1:] {
+			relPath, err := common.RepoRelPath(repoRoot, path)
+			if err != nil {
+				common.Usage(err.Error())
+			}
+			if strings.HasSuffix(path, "/") && relPath != "" {
+				relPath += "/"
+			}
+			opts.paths = append(opts.paths, relPath)
+		}
+	}
+	if err := listTree(t, "", opts); err != nil {
+		common.Usage(err.Error())
+	}
+}
+
+// Resolve a tree-ish revision into a tree.
+func resolveTree(name string) (objects.Tree, error) {
+	hash, err := revision.ResolveTree(name)
+	if err != nil {
+		return nil, err
+	}
+	return objects.ReadTree(hash)
+}
+
+func listTree(t objects.Tree, prefix string, opts lsTreeOptions) error {
+	for _, e := range t {
+		path := prefix + e.Name
+		isTree := e.Mode == objects.ModeTree
+		selected, ancestor := matchLsTreePaths(path, opts.paths)
+		switch {
+		case selected && isTree && opts.recursive, !selected && ancestor && isTree:
+			if opts.showTrees {
+				if err := printTreeEntry(e, path, opts); err != nil {
+					return err
+				}
+			}
+			subtree, err := objects.ReadTree(e.Hash)
+			if err != nil {
+				return err
+			}
+			if err := listTree(subtree, path+"/", opts); err != nil {
+				return err
+			}
+		case selected:
+			if err := printTreeEntry(e, path, opts); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Check whether a path is selected by any of the requested paths, or is one
+// of their parent directories.
+func matchLsTreePaths(path string, paths []string) (bool, bool) {
+	if len(paths) == 0 {
+		return true, false
+	}
+	selected, ancestor := false, false
+	for _, p := range paths {
+		if p == "" || path == p || strings.HasPrefix(path, strings.TrimSuffix(p, "/")+"/") {
+			selected = true
+		}
+		if strings.HasPrefix(p, path+"/") {
+			ancestor = true
+		}
+	}
+	return selected, ancestor
+}
+
+func printTreeEntry(e objects.TreeEntry, path string, opts lsTreeOptions) error {
+	if opts.nameOnly {
+		fmt.Println(path)
+		return nil
+	}
+	entryType := objects.TypeFromMode(e.Mode)
+	if !opts.long {
+		fmt.Printf("%s %s %s\t%s\n", e.Mode, entryType, e.Hash, path)
+		return nil
+	}
+	size := "-"
+	if entryType == objects.BlobObject {
+		blob, ok := e.Entry.(objects.Blob)
+		if !ok {
+			o, err := objects.Read(e.Hash)
+			if err != nil {
+				return err
+			}
+			if blob, ok = o.(objects.Blob); !ok {
+				return fmt.Errorf("object %s is a %s, not a blob", e.Hash, o.GetType())
+			}
+		}
+		n, err := blob.Size()
+		if err != nil {
+			return err
+		}
+		size = fmt.Sprint(n)
+	}
+	fmt.Printf("%s %s %s %7s\t%s\n", e.Mode, entryType, e.Hash, size, path)
+	return nil
+}
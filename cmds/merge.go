@@ -0,0 +1,210 @@
+package cmds
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/antoniszczepanik/gggit/common"
+	"github.com/antoniszczepanik/gggit/index"
+	"github.com/antoniszczepanik/gggit/merge"
+	"github.com/antoniszczepanik/gggit/objects"
+	"github.com/antoniszczepanik/gggit/refs"
+	"github.com/antoniszczepanik/gggit/revision"
+	"github.com/antoniszczepanik/gggit/worktree"
+)
+
+func Merge(args []string) {
+	if len(args) != 1 {
+		common.Usage("specify a branch you would like to merge")
+	}
+	repoRoot, err := common.GetRepoRoot("")
+	if err != nil {
+		common.Usage("not a git repository (or any of the parent directories)")
+	}
+	if _, _, err := refs.ReadMergeHead(); err == nil {
+		common.Usage("you have not concluded your merge, fix conflicts and run \"gggit commit\"")
+	}
+	branchName, err := refs.GetCurrentBranch()
+	if err != nil {
+		common.Usage("cannot merge without being on a branch")
+	}
+	headHash, err := refs.GetHeadCommitHash()
+	if err != nil {
+		common.Usage("cannot merge into a branch without commits")
+	}
+	theirHash, err := revision.ResolveCommit(args[0])
+	if err != nil {
+		common.Usage(err.Error())
+	}
+	head, err := objects.ReadCommit(headHash)
+	if err != nil {
+		common.Usage(err.Error())
+	}
+	their, err := objects.ReadCommit(theirHash)
+	if err != nil {
+		common.Usage(err.Error())
+	}
+	status, err := worktree.GetStatus(repoRoot, head.TreeHash)
+	if err != nil {
+		common.Usage(err.Error())
+	}
+	if len(status.Staged) > 0 || len(status.Unstaged) > 0 || len(status.Unmerged) > 0 {
+		common.Usage("your local changes would be overwritten by merge, commit them first")
+	}
+
+	baseHash, err := merge.MergeBase(headHash, theirHash)
+	if err == merge.ErrNoMergeBase {
+		common.Usage("refusing to merge unrelated histories")
+	} else if err != nil {
+		common.Usage(err.Error())
+	}
+	if baseHash == theirHash {
+		fmt.Println("Already up to date.")
+		return
+	}
+	if baseHash == headHash {
+		fastForward(repoRoot, branchName, args[0], headHash, theirHash, head.TreeHash, their.TreeHash)
+		return
+	}
+
+	base, err := objects.ReadCommit(baseHash)
+	if err != nil {
+		common.Usage(err.Error())
+	}
+	baseFiles, err := worktree.ReadFlatTree(base.TreeHash)
+	if err != nil {
+		common.Usage(err.Error())
+	}
+	ourFiles, err := worktree.ReadFlatTree(head.TreeHash)
+	if err != nil {
+		common.Usage(err.Error())
+	}
+	theirFiles, err := worktree.ReadFlatTree(their.TreeHash)
+	if err != nil {
+		common.Usage(err.Error())
+	}
+	result, err := merge.MergeTrees(baseFiles, ourFiles, theirFiles, "HEAD", args[0])
+	if err != nil {
+		common.Usage(err.Error())
+	}
+	if err := checkUntrackedOverwrites(repoRoot, ourFiles, result); err != nil {
+		common.Usage(err.Error())
+	}
+	idx, err := applyMergeResult(repoRoot, ourFiles, result)
+	if err != nil {
+		common.Usage(err.Error())
+	}
+
+	msg := fmt.Sprintf("Merge branch '%s'", args[0])
+	if len(result.Conflicts) > 0 {
+		if err := refs.StartMerge(theirHash, msg); err != nil {
+			common.Usage(err.Error())
+		}
+		for _, c := range result.Conflicts {
+			if c.Kind == merge.FileDirectoryConflict {
+				fmt.Printf("CONFLICT (%s): There is a directory with name %s, adding %s as %s\n", c.Kind, c.Path, c.Path, c.WorkPath)
+				continue
+			}
+			fmt.Printf("CONFLICT (%s): Merge conflict in %s\n", c.Kind, c.Path)
+		}
+		common.Usage("Automatic merge failed; fix conflicts and then commit the result.")
+	}
+	treeHash, err := idx.WriteTree()
+	if err != nil {
+		common.Usage(err.Error())
+	}
+	c, err := objects.CreateCommitObject(treeHash, []string{headHash, theirHash}, msg)
+	if err != nil {
+		common.Usage(err.Error())
+	}
+	if err := c.Write(); err != nil {
+		common.Usage(err.Error())
+	}
+	commitHash, err := objects.CalculateHash(c)
+	if err != nil {
+		common.Usage(err.Error())
+	}
+	if err := refs.PointBranchAt(branchName, commitHash, headHash, "merge "+args[0]+": Merge made by the 'three-way' strategy."); err != nil {
+		common.Usage(err.Error())
+	}
+	fmt.Printf("Merge made by the 'three-way' strategy.\ncommit %s\n", commitHash)
+}
+
+func fastForward(repoRoot, branchName, theirName, headHash, theirHash, headTree, theirTree string) {
+	if err := worktree.Checkout(repoRoot, headTree, theirTree, false); err != nil {
+		common.Usage(err.Error())
+	}
+	if err := refs.PointBranchAt(branchName, theirHash, headHash, "merge "+theirName+": Fast-forward"); err != nil {
+		common.Usage(err.Error())
+	}
+	fmt.Printf("Updating %s..%s\nFast-forward\n", headHash[:abbrevLength], theirHash[:abbrevLength])
+}
+
+// Refuse to merge if any of untracked files would be overwritten.
+func checkUntrackedOverwrites(repoRoot string, ourFiles map[string]objects.TreeEntry, result *merge.Result) error {
+	paths := make([]string, 0, len(result.Entries)+len(result.Conflicts))
+	for path := range result.Entries {
+		paths = append(paths, path)
+	}
+	for _, c := range result.Conflicts {
+		paths = append(paths, c.WorkPath)
+	}
+	checkoutErr := &worktree.CheckoutError{}
+	for _, path := range paths {
+		if _, tracked := ourFiles[path]; tracked {
+			continue
+		}
+		if _, err := os.Lstat(filepath.Join(repoRoot, filepath.FromSlash(path))); err == nil {
+			checkoutErr.Untracked = append(checkoutErr.Untracked, path)
+		}
+	}
+	if len(checkoutErr.Untracked) > 0 {
+		return checkoutErr
+	}
+	return nil
+}
+
+// Update working directory and the index with the result of a merge.
+// Conflicting paths get their base, ours and theirs versions recorded as
+// separate index stages.
+func applyMergeResult(repoRoot string, ourFiles map[string]objects.TreeEntry, result *merge.Result) (*index.Index, error) {
+	conflicted := make(map[string]bool)
+	for _, c := range result.Conflicts {
+		conflicted[c.WorkPath] = true
+	}
+	for path := range ourFiles {
+		if _, ok := result.Entries[path]; !ok && !conflicted[path] {
+			if err := worktree.RemoveFile(repoRoot, path); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	idx := &index.Index{}
+	for path, e := range result.Entries {
+		if old, ok := ourFiles[path]; !ok || old.Hash != e.Hash || old.Mode != e.Mode {
+			if err := worktree.WriteFile(repoRoot, path, e); err != nil {
+				return nil, err
+			}
+		}
+		idxEntry, err := worktree.NewIndexEntry(repoRoot, path, e)
+		if err != nil {
+			return nil, err
+		}
+		idx.Add(idxEntry)
+	}
+	for _, c := range result.Conflicts {
+		if err := worktree.WriteContent(repoRoot, c.WorkPath, c.Content); err != nil {
+			return nil, err
+		}
+		var stages []index.Entry
+		for stage, e := range []*objects.TreeEntry{c.Base, c.Ours, c.Theirs} {
+			if e != nil {
+				stages = append(stages, index.Entry{Path: c.Path, Mode: e.Mode, Hash: e.Hash, Stage: stage + 1})
+			}
+		}
+		idx.AddConflict(stages...)
+	}
+	return idx, idx.Write()
+}
@@ -2,51 +2,43 @@ package cmds
 
 import (
 	"fmt"
-	"os"
-	"path/filepath"
+	"sort"
 
 	"github.com/antoniszczepanik/gggit/objects"
 	"github.com/antoniszczepanik/gggit/common"
+	"github.com/antoniszczepanik/gggit/revision"
 )
 
-func Add(args []string) {
-	fmt.Println("add")
-}
-
 func Cat(args []string) {
 	if len(args) != 1 {
-		common.Usage("You should provide hash of object to cat.")
+		common.Usage("You should provide a revision of object to cat.")
 	}
-	err := objects.PrintObject(args[0])
+	hash, err := revision.Resolve(args[0])
+	if err != nil {
+		common.Usage(err.Error())
+	}
+	err = objects.PrintObject(hash)
 	if err != nil {
 		fmt.Println(err)
 	}
 }
 
-func Ls(args []string) {
-	fmt.Println("ls-tree")
-}
-
-func Log(args []string) {
-	fmt.Println("log")
-}
-
+// List hashes of all objects, loose and packed.
 func LsObjects(args []string) {
-	objectsDir, err := common.GetGitSubdir("objects")
+	loose, err := objects.ListLoose()
 	if err != nil {
-		common.Usage("could not find git objects dir")
+		common.Usage(err.Error())
 	}
-	dirEntries, err := os.ReadDir(objectsDir)
+	packed, err := objects.ListPacked()
 	if err != nil {
-		common.Usage("could not read git objects dir")
+		common.Usage(err.Error())
 	}
-	for _, e := range dirEntries {
-		subDirEntries, err := os.ReadDir(filepath.Join(objectsDir, e.Name()))
-		if err != nil {
-			common.Usage("could not read one of object subdirs")
-		}
-		for _, se := range subDirEntries {
-			fmt.Println(e.Name() + se.Name())
+	hashes := append(loose, packed...)
+	sort.Strings(hashes)
+	for i, hash := range hashes {
+		if i > 0 && hash == hashes[i-1] {
+			continue
 		}
+		fmt.Println(hash)
 	}
 }
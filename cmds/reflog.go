@@ -0,0 +1,96 @@
+package cmds
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+
+	"github.com/antoniszczepanik/gggit/common"
+	"github.com/antoniszczepanik/gggit/refs"
+	"github.com/antoniszczepanik/gggit/revision"
+)
+
+// Show log of updates of a ref, HEAD by default, or expire old entries.
+func Reflog(args []string) {
+	if len(args) > 0 && args[0] == "expire" {
+		reflogExpire(args[1:])
+		return
+	}
+	if len(args) > 0 && args[0] == "show" {
+		args = args[1:]
+	}
+	flags := flag.NewFlagSet("reflog", flag.ExitOnError)
+	flags.Parse(args)
+	name := "HEAD"
+	switch flags.NArg() {
+	case 0:
+	case 1:
+		name = flags.Arg(0)
+	default:
+		common.Usage("specify a single ref to show log of")
+	}
+	refName, err := revision.FullRefName(name)
+	if err != nil {
+		common.Usage(fmt.Sprintf("unknown ref %s: %v", name, err))
+	}
+	entries, err := refs.ReadLog(refName)
+	if err != nil {
+		common.Usage(err.Error())
+	}
+	for i, e := range entries {
+		fmt.Printf("%s %s@{%d}: %s\n", e.New[:abbrevLength], shortRefName(refName), i, e.Msg)
+	}
+}
+
+func reflogExpire(args []string) {
+	flags := flag.NewFlagSet("reflog expire", flag.ExitOnError)
+	expireValue := flags.String("expire", "", "expire entries older than that, "+refs.DefaultReflogExpire+" by default")
+	all := flags.Bool("all", false, "expire entries of all refs")
+	dryRun := flags.Bool("dry-run", false, "only print how many entries would be expired")
+	flags.BoolVar(dryRun, "n", false, "same as --dry-run")
+	flags.Parse(args)
+	if *all == (flags.NArg() > 0) {
+		common.Usage("specify refs to expire logs of, or --all")
+	}
+	expire, err := refs.ReflogExpire(*expireValue)
+	if err != nil {
+		common.Usage(err.Error())
+	}
+	refNames := flags.Args()
+	if *all {
+		if refNames, err = refs.ListLogs(); err != nil {
+			common.Usage(err.Error())
+		}
+	}
+	for _, name := range refNames {
+		// Logs are expired even if their refs are gone.
+		refName := name
+		if !*all {
+			if refName, err = revision.FullRefName(name); err != nil {
+				common.Usage(fmt.Sprintf("unknown ref %s: %v", name, err))
+			}
+		}
+		expired, err := refs.ExpireLog(refName, expire, *dryRun)
+		if err != nil {
+			common.Usage(err.Error())
+		}
+		if expired == 0 {
+			continue
+		}
+		verb := "Expired"
+		if *dryRun {
+			verb = "Would expire"
+		}
+		fmt.Printf("%s %d %s of %s\n", verb, expired, plural(expired, "entry", "entries"), refName)
+	}
+}
+
+// Strip "refs/heads/", "refs/tags/" or "refs/remotes/" prefix of a ref name.
+func shortRefName(refName string) string {
+	for _, prefix := range []string{"refs/heads/", "refs/tags/", "refs/remotes/"} {
+		if name := strings.TrimPrefix(refName, prefix); name != refName {
+			return name
+		}
+	}
+	return refName
+}
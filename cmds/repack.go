@@ -0,0 +1,83 @@
+package cmds
+
+import (
+	"flag"
+	"fmt"
+
+	"github.com/antoniszczepanik/gggit/common"
+	"github.com/antoniszczepanik/gggit/objects"
+)
+
+// Pack loose objects, or with -a all objects, into a single new pack.
+func Repack(args []string) {
+	flags := flag.NewFlagSet("repack", flag.ExitOnError)
+	all := flags.Bool("a", false, "pack all objects, including already packed ones")
+	remove := flags.Bool("d", false, "remove loose objects and packs made redundant by the new pack")
+	quiet := flags.Bool("q", false, "do not print any summary")
+	opts := objects.DefaultPackOptions
+	flags.IntVar(&opts.Window, "window", opts.Window, "number of objects tried as delta bases of each object")
+	flags.IntVar(&opts.Depth, "depth", opts.Depth, "longest chain of deltas")
+	flags.BoolVar(&opts.RefDeltas, "no-delta-base-offset", false, "refer to delta bases by hash rather than offset")
+	flags.Parse(args)
+	if flags.NArg() != 0 {
+		common.Usage("repack does not take any arguments")
+	}
+	if opts.Window < 0 || opts.Depth < 0 {
+		common.Usage("window and depth cannot be negative")
+	}
+	removed, err := repack(*all, *remove, opts, *quiet)
+	if err != nil {
+		common.Usage(err.Error())
+	}
+	if !*quiet && removed > 0 {
+		fmt.Printf("Removed %d redundant loose %s\n", removed, plural(removed, "object", "objects"))
+	}
+}
+
+// Write a new pack and, if asked to, remove objects made redundant by it.
+// Returns number of removed loose objects.
+func repack(all, remove bool, opts objects.PackOptions, quiet bool) (int, error) {
+	hashes, err := objects.ListLoose()
+	if err != nil {
+		return 0, err
+	}
+	oldPacks, err := objects.ListPacks()
+	if err != nil {
+		return 0, err
+	}
+	if all {
+		packed, err := objects.ListPacked()
+		if err != nil {
+			return 0, err
+		}
+		hashes = append(hashes, packed...)
+	}
+	if len(hashes) == 0 {
+		if !quiet {
+			fmt.Println("Nothing new to pack.")
+		}
+		return 0, nil
+	}
+	stats, err := objects.WritePack(hashes, opts)
+	if err != nil {
+		return 0, err
+	}
+	if !quiet {
+		fmt.Printf("Packed %d %s (%d %s) into %s\n", stats.Objects, plural(stats.Objects, "object", "objects"),
+			stats.Deltas, plural(stats.Deltas, "delta", "deltas"), stats.Name)
+	}
+	if !remove {
+		return 0, nil
+	}
+	if all {
+		for _, name := range oldPacks {
+			if name == stats.Name {
+				continue
+			}
+			if err := objects.RemovePack(name); err != nil {
+				return 0, err
+			}
+		}
+	}
+	return objects.PrunePacked()
+}
@@ -0,0 +1,63 @@
+package cmds
+
+import (
+	"flag"
+	"fmt"
+
+	"github.com/antoniszczepanik/gggit/common"
+	"github.com/antoniszczepanik/gggit/refs"
+	"github.com/antoniszczepanik/gggit/revision"
+)
+
+// Print object hashes revision expressions resolve to.
+func RevParse(args []string) {
+	flags := flag.NewFlagSet("rev-parse", flag.ExitOnError)
+	verify := flags.Bool("verify", false, "require exactly one valid revision")
+	short := flags.Bool("short", false, "print the shortest unambiguous abbreviation of hashes")
+	abbrev := flags.Int("abbrev", abbrevLength, "minimal length of abbreviated hashes")
+	abbrevRef := flags.Bool("abbrev-ref", false, "print branch names instead of hashes where possible")
+	flags.Parse(args)
+	if flags.NArg() == 0 {
+		common.Usage("specify a revision you would like to parse")
+	}
+	if *verify && flags.NArg() != 1 {
+		common.Usage("Needed a single revision")
+	}
+	for _, arg := range flags.Args() {
+		if *abbrevRef {
+			if name, ok := symbolicName(arg); ok {
+				fmt.Println(name)
+				continue
+			}
+		}
+		hash, err := revision.Resolve(arg)
+		if err != nil {
+			if *verify {
+				common.Usage("Needed a single revision")
+			}
+			common.Usage(fmt.Sprintf("ambiguous argument '%s': %v", arg, err))
+		}
+		if *short {
+			if hash, err = revision.Abbrev(hash, *abbrev); err != nil {
+				common.Usage(err.Error())
+			}
+		}
+		fmt.Println(hash)
+	}
+}
+
+// Get branch name an expression refers to, if it refers to one.
+func symbolicName(expr string) (string, bool) {
+	if expr == "HEAD" || expr == "@" {
+		branchName, err := refs.GetCurrentBranch()
+		if err == refs.ErrDetachedHead {
+			return "HEAD", true
+		}
+		return branchName, err == nil
+	}
+	if n, ok := revision.ParsePreviousCheckout(expr); ok {
+		previous, err := revision.PreviousCheckout(n)
+		return previous, err == nil && refs.Exists(previous)
+	}
+	return expr, refs.Exists(expr)
+}
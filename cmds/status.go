@@ -1,27 +1,134 @@
 package cmds
 
 import (
+	"flag"
+	"fmt"
+	"io"
 	"os"
+	"sort"
 	"strings"
-	"fmt"
 
-	"github.com/antoniszczepanik/gggit/refs"
 	"github.com/antoniszczepanik/gggit/common"
+	"github.com/antoniszczepanik/gggit/refs"
+	"github.com/antoniszczepanik/gggit/worktree"
 )
 
 func Status(args []string) {
-	currentCommitHash, err := refs.GetHeadCommitHash()
+	flags := flag.NewFlagSet("status", flag.ExitOnError)
+	porcelain := flags.Bool("porcelain", false, "give the output in a stable, machine-readable format")
+	flags.Parse(args)
+
+	repoRoot, err := common.GetRepoRoot("")
 	if err != nil {
+		common.Usage("not a git repository (or any of the parent directories)")
+	}
+	currentCommitHash, err := refs.GetHeadCommitHash()
+	if err != nil && err != refs.ErrBranchWithoutHash {
 		common.Usage("could not get current commit")
 	}
+	headTreeHash, err := refs.GetHeadTreeHash()
+	if err == refs.ErrBranchWithoutHash {
+		headTreeHash = ""
+	} else if err != nil {
+		common.Usage(err.Error())
+	}
+	status, err := worktree.GetStatus(repoRoot, headTreeHash)
+	if err != nil {
+		common.Usage(err.Error())
+	}
+	if *porcelain {
+		printPorcelainStatus(status)
+		return
+	}
+
 	branchName, err := refs.GetCurrentBranch()
 	if err == refs.ErrDetachedHead {
-		fmt.Printf("detached HEAD mode on %s\n", currentCommitHash)
-		return
+		fmt.Printf("HEAD detached at %s\n", currentCommitHash)
 	} else if err != nil {
 		common.Usage("could not get current branch")
+	} else if currentCommitHash == "" {
+		fmt.Printf("On branch %s\n\nNo commits yet\n", branchName)
+	} else {
+		fmt.Printf("On branch %s (commit %s)\n", branchName, currentCommitHash)
+	}
+	printLongStatus(status)
+}
+
+// Write human readable lists of staged, unmerged, unstaged and untracked
+// paths.
+func writeStatusSections(w io.Writer, status *worktree.Status) {
+	if len(status.Staged) > 0 {
+		fmt.Fprintln(w, "\nChanges to be committed:")
+		for _, c := range status.Staged {
+			fmt.Fprintf(w, "\t%-12s%s\n", c.Kind.String()+":", c.Path)
+		}
+	}
+	if len(status.Unmerged) > 0 {
+		fmt.Fprintln(w, "\nUnmerged paths:")
+		for _, u := range status.Unmerged {
+			fmt.Fprintf(w, "\t%-17s%s\n", u.String()+":", u.Path)
+		}
+	}
+	if len(status.Unstaged) > 0 {
+		fmt.Fprintln(w, "\nChanges not staged for commit:")
+		for _, c := range status.Unstaged {
+			fmt.Fprintf(w, "\t%-12s%s\n", c.Kind.String()+":", c.Path)
+		}
+	}
+	if len(status.Untracked) > 0 {
+		fmt.Fprintln(w, "\nUntracked files:")
+		for _, path := range status.Untracked {
+			fmt.Fprintf(w, "\t%s\n", path)
+		}
+	}
+}
+
+func printLongStatus(status *worktree.Status) {
+	writeStatusSections(os.Stdout, status)
+	switch {
+	case status.Clean():
+		fmt.Println("\nnothing to commit, working tree clean")
+	case len(status.Unmerged) > 0:
+		fmt.Println("\nfix conflicts and run \"gggit commit\"")
+	case len(status.Staged) == 0 && len(status.Unstaged) == 0:
+		fmt.Println("\nnothing added to commit but untracked files present (use \"gggit add\" to track)")
+	case len(status.Staged) == 0:
+		fmt.Println("\nno changes added to commit (use \"gggit add\")")
+	}
+}
+
+// Print one "XY path" line per changed path, where X is the status of the
+// index and Y is the status of working directory. Untracked files are
+// marked with "??", unmerged paths with one of "DD", "AU", "UD", "UA", "DU",
+// "AA" and "UU".
+func printPorcelainStatus(status *worktree.Status) {
+	codes := make(map[string][]byte)
+	code := func(path string) []byte {
+		if _, ok := codes[path]; !ok {
+			codes[path] = []byte("  ")
+		}
+		return codes[path]
+	}
+	for _, c := range status.Staged {
+		code(c.Path)[0] = byte(c.Kind)
+	}
+	for _, c := range status.Unstaged {
+		code(c.Path)[1] = byte(c.Kind)
+	}
+	for _, u := range status.Unmerged {
+		codes[u.Path] = []byte(u.Code())
+	}
+	paths := make([]string, 0, len(codes))
+	for path := range codes {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		fmt.Printf("%s %s\n", codes[path], path)
+	}
+	for _, path := range status.Untracked {
+		fmt.Printf("?? %s\n", path)
 	}
-	fmt.Printf("On branch %s (commit %s)\n", branchName, currentCommitHash)
 }
 
 func getBranchName(refPath string) string {
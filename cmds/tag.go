@@ -0,0 +1,261 @@
+package cmds
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/antoniszczepanik/gggit/common"
+	"github.com/antoniszczepanik/gggit/objects"
+	"github.com/antoniszczepanik/gggit/refs"
+	"github.com/antoniszczepanik/gggit/revision"
+)
+
+const tagEditMsgFile = "TAG_EDITMSG"
+
+const tagMsgInstructions = `
+#
+# Write a message for tag:
+#   %s
+# Lines starting with '#' will be ignored.
+`
+
+type tagOptions struct {
+	annotate bool
+	messages stringList
+	file     string
+	force    bool
+}
+
+func Tag(args []string) {
+	flags := flag.NewFlagSet("tag", flag.ExitOnError)
+	opts := tagOptions{}
+	flags.BoolVar(&opts.annotate, "a", false, "create an annotated tag")
+	flags.Var(&opts.messages, "m", "use the given tag message, implies -a")
+	flags.StringVar(&opts.file, "F", "", "take the tag message from the given file, implies -a")
+	flags.BoolVar(&opts.force, "f", false, "replace an existing tag")
+	del := flags.Bool("d", false, "delete tags")
+	list := flags.Bool("l", false, "list tags matching optional patterns")
+	annotations := flags.Bool("n", false, "when listing, print first line of tag messages")
+	show := flags.Bool("show", false, "show tags together with objects they point at")
+	args, _ = parseInterspersed(flags, args)
+	if len(opts.messages) > 0 && opts.file != "" {
+		common.Usage("options -m and -F cannot be used together")
+	}
+
+	switch {
+	case *del:
+		deleteTags(args)
+	case *show:
+		for i, name := range args {
+			if i > 0 {
+				fmt.Println()
+			}
+			if err := showTag(name); err != nil {
+				common.Usage(err.Error())
+			}
+		}
+	case *list || len(args) == 0:
+		if err := listTags(args, *annotations); err != nil {
+			common.Usage(err.Error())
+		}
+	case len(args) > 2:
+		common.Usage("Too many arguments")
+	default:
+		target := "HEAD"
+		if len(args) == 2 {
+			target = args[1]
+		}
+		if err := createTag(args[0], target, opts); err != nil {
+			common.Usage(err.Error())
+		}
+	}
+}
+
+// Create a lightweight tag, or an annotated one if any message options are
+// given.
+func createTag(name, target string, opts tagOptions) error {
+	if err := refs.ValidateRefName(name); err != nil {
+		return err
+	}
+	oldHash, err := refs.ReadTagHash(name)
+	if err == nil && !opts.force {
+		return fmt.Errorf("tag '%s' already exists", name)
+	} else if err != nil && err != refs.ErrTagNotFound {
+		return err
+	}
+	hash, err := revision.Resolve(target)
+	if err != nil {
+		return fmt.Errorf("failed to resolve '%s' as a valid ref: %w", target, err)
+	}
+	if opts.annotate || len(opts.messages) > 0 || opts.file != "" {
+		o, err := objects.Read(hash)
+		if err != nil {
+			return err
+		}
+		msg, err := getTagMessage(name, opts)
+		if err != nil {
+			return err
+		}
+		t, err := objects.CreateTagObject(hash, o.GetType(), name, msg)
+		if err != nil {
+			return err
+		}
+		if err := t.Write(); err != nil {
+			return err
+		}
+		if hash, err = objects.CalculateHash(t); err != nil {
+			return err
+		}
+	}
+	if err := refs.PointTagAt(name, hash); err != nil {
+		return err
+	}
+	if oldHash != "" && oldHash != hash {
+		fmt.Printf("Updated tag '%s' (was %s)\n", name, oldHash[:abbrevLength])
+	}
+	return nil
+}
+
+func getTagMessage(name string, opts tagOptions) (string, error) {
+	var msg string
+	switch {
+	case len(opts.messages) > 0:
+		msg = cleanupMessage(strings.Join(opts.messages, "\n\n"), false)
+	case opts.file != "":
+		content, err := os.ReadFile(opts.file)
+		if err != nil {
+			return "", err
+		}
+		msg = cleanupMessage(string(content), false)
+	default:
+		msgPath, err := common.GetGitFilePath(tagEditMsgFile)
+		if err != nil {
+			return "", err
+		}
+		if err := os.WriteFile(msgPath, []byte(fmt.Sprintf(tagMsgInstructions, name)), 0644); err != nil {
+			return "", err
+		}
+		content, err := launchEditor(msgPath)
+		if err != nil {
+			return "", err
+		}
+		msg = cleanupMessage(content, true)
+	}
+	if msg == "" {
+		return "", errors.New("no tag message?")
+	}
+	return msg, nil
+}
+
+func deleteTags(names []string) {
+	if len(names) == 0 {
+		common.Usage("specify tags you would like to delete")
+	}
+	failed := false
+	for _, name := range names {
+		hash, err := refs.ReadTagHash(name)
+		if err == nil {
+			err = refs.DeleteTag(name)
+		}
+		if err == refs.ErrTagNotFound {
+			fmt.Fprintf(os.Stderr, "tag '%s' not found.\n", name)
+			failed = true
+			continue
+		} else if err != nil {
+			common.Usage(err.Error())
+		}
+		fmt.Printf("Deleted tag '%s' (was %s)\n", name, hash[:abbrevLength])
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
+// List tags with names matching any of shell patterns, or all tags if no
+// patterns are given.
+func listTags(patterns []string, annotations bool) error {
+	names, err := refs.ListTags()
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		matched := len(patterns) == 0
+		for _, pattern := range patterns {
+			if ok, err := path.Match(pattern, name); err != nil {
+				return fmt.Errorf("invalid pattern %s: %w", pattern, err)
+			} else if ok {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			continue
+		}
+		if !annotations {
+			fmt.Println(name)
+			continue
+		}
+		subject, err := tagSubject(name)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%-15s %s\n", name, subject)
+	}
+	return nil
+}
+
+// Get first line of a tag message, or of the commit message for lightweight
+// tags.
+func tagSubject(name string) (string, error) {
+	hash, err := refs.ReadTagHash(name)
+	if err != nil {
+		return "", err
+	}
+	o, err := objects.Read(hash)
+	if err != nil {
+		return "", err
+	}
+	switch o := o.(type) {
+	case objects.Tag:
+		subject, _ := splitMessage(o.Msg)
+		return subject, nil
+	case objects.Commit:
+		subject, _ := splitMessage(o.Msg)
+		return subject, nil
+	}
+	return "", nil
+}
+
+// Print tag objects a tag goes through, followed by the object it finally
+// points at.
+func showTag(name string) error {
+	hash, err := refs.ReadTagHash(name)
+	if err == refs.ErrTagNotFound {
+		return fmt.Errorf("tag '%s' not found", name)
+	} else if err != nil {
+		return err
+	}
+	for {
+		o, err := objects.Read(hash)
+		if err != nil {
+			return err
+		}
+		switch o := o.(type) {
+		case objects.Tag:
+			fmt.Printf("tag %s\n", o.Name)
+			fmt.Printf("Tagger: %s <%s>\n", o.Tagger.Name, o.Tagger.Email)
+			fmt.Printf("Date:   %s\n\n", o.Time.Format(logDateFmt))
+			fmt.Printf("%s\n\n", o.Msg)
+			hash = o.Object
+			continue
+		case objects.Commit:
+			printCommit(hash, o)
+			return nil
+		}
+		return objects.PrintObject(hash)
+	}
+}
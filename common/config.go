@@ -1,13 +1,108 @@
 package common
 
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
 type Author struct {
 	Name  string
 	Email string
 }
 
-func GetAuthorFromConfig() (Author, error) {
-	return Author{
-		Name:  "Antoni Szczepanik",
-		Email: "szczepanik.antoni@gmail.com",
-	}, nil
+// Roles an identity can be used in, as they appear in names of environment
+// variables overriding it.
+const (
+	AuthorRole    = "AUTHOR"
+	CommitterRole = "COMMITTER"
+)
+
+// Parse a date in one of the formats: "<unix seconds> <+hhmm>" (as stored
+// in objects), "@<unix seconds>", RFC 3339 or RFC 2822.
+func ParseDate(value string) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	if strings.HasPrefix(value, "@") {
+		seconds, err := strconv.ParseInt(value[1:], 10, 64)
+		if err != nil {
+			return time.Time{}, err
+		}
+		return time.Unix(seconds, 0).UTC(), nil
+	}
+	if fields := strings.Fields(value); len(fields) == 2 {
+		if t, err := ParseTimestamp(fields[0], fields[1]); err == nil {
+			return t, nil
+		}
+	}
+	for _, layout := range []string{time.RFC3339, time.RFC1123Z, time.RFC822Z} {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("unrecognized date format %q", value)
+}
+
+var approxUnits = map[string]time.Duration{
+	"second": time.Second,
+	"minute": time.Minute,
+	"hour":   time.Hour,
+	"day":    24 * time.Hour,
+	"week":   7 * 24 * time.Hour,
+	"month":  30 * 24 * time.Hour,
+	"year":   365 * 24 * time.Hour,
+}
+
+// Parse a point in time relative to now, like "2.weeks.ago" or "3 days ago",
+// as well as "now", "never" (zero time) and anything ParseDate accepts.
+func ParseApproxDate(value string, now time.Time) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	switch value {
+	case "now":
+		return now, nil
+	case "never":
+		return time.Time{}, nil
+	}
+	fields := strings.FieldsFunc(value, func(r rune) bool { return r == '.' || r == ' ' })
+	if len(fields) == 3 && fields[2] == "ago" {
+		n, err := strconv.Atoi(fields[0])
+		unit, ok := approxUnits[strings.TrimSuffix(fields[1], "s")]
+		if err == nil && ok && n >= 0 {
+			return now.Add(-time.Duration(n) * unit), nil
+		}
+	}
+	t, err := ParseDate(value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("unrecognized date %q", value)
+	}
+	return t, nil
+}
+
+// Parse unix seconds and a "+hhmm" time zone offset.
+func ParseTimestamp(seconds, zone string) (time.Time, error) {
+	unix, err := strconv.ParseInt(seconds, 10, 64)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid timestamp %q", seconds)
+	}
+	if len(zone) != 5 || (zone[0] != '+' && zone[0] != '-') {
+		return time.Time{}, fmt.Errorf("invalid time zone %q", zone)
+	}
+	hours, err := strconv.Atoi(zone[1:3])
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid time zone %q", zone)
+	}
+	minutes, err := strconv.Atoi(zone[3:])
+	if err != nil || minutes >= 60 {
+		return time.Time{}, fmt.Errorf("invalid time zone %q", zone)
+	}
+	offset := hours*3600 + minutes*60
+	if zone[0] == '-' {
+		offset = -offset
+	}
+	return time.Unix(unix, 0).In(time.FixedZone("", offset)), nil
+}
+
+// Format time as unix seconds and a "+hhmm" time zone offset.
+func FormatTimestamp(t time.Time) string {
+	return fmt.Sprintf("%d %s", t.Unix(), t.Format("-0700"))
 }
@@ -6,10 +6,16 @@ import (
 	"io"
 	"os"
 	"path/filepath"
+	"strings"
 )
 
 const GitDirName = ".gggit"
 
+// Directory of git's own repositories, which can be opened read-only.
+const ForeignGitDirName = ".git"
+
+var ErrReadOnlyRepo = errors.New("git repositories are read-only, only gggit repositories can be modified")
+
 // Find git directory and return its specific subdirectory.
 func GetGitSubdir(subdirName string) (string, error) {
 	gitDir, err := GetGitDir("")
@@ -23,13 +29,14 @@ func GetGitSubdir(subdirName string) (string, error) {
 	return subDir, nil
 }
 
-// Get a path to .git directory.
+// Get a path to .git directory. It is .gggit, unless the repository is one
+// of git's own.
 func GetGitDir(path string) (string, error) {
 	repoDir, err := GetRepoRoot(path)
 	if err != nil {
 		return "", err
 	}
-	return filepath.Join(repoDir, GitDirName), nil
+	return findGitDir(repoDir), nil
 }
 
 // Get a path to repository root.
@@ -41,8 +48,7 @@ func GetRepoRoot(path string) (string, error) {
 			return "", err
 		}
 	}
-	gitPath := filepath.Join(path, GitDirName)
-	if _, err = os.ReadDir(gitPath); os.IsNotExist(err) {
+	if findGitDir(path) == "" {
 		if path == "/" {
 			return "", errors.New("did not find git directory")
 		}
@@ -51,6 +57,32 @@ func GetRepoRoot(path string) (string, error) {
 	return path, nil
 }
 
+// Get git directory inside of a directory, preferring .gggit over .git.
+// Returns an empty string if there is none.
+func findGitDir(dir string) string {
+	for _, name := range []string{GitDirName, ForeignGitDirName} {
+		gitPath := filepath.Join(dir, name)
+		if fi, err := os.Stat(gitPath); err == nil && fi.IsDir() {
+			return gitPath
+		}
+	}
+	return ""
+}
+
+// Check if current repository is one of git's own.
+func IsForeignRepo() bool {
+	gitDir, err := GetGitDir("")
+	return err == nil && filepath.Base(gitDir) == ForeignGitDirName
+}
+
+// Fail with ErrReadOnlyRepo for repositories that cannot be modified.
+func CheckWritable() error {
+	if IsForeignRepo() {
+		return ErrReadOnlyRepo
+	}
+	return nil
+}
+
 // Returns a pointer to internal git file. Caller is responsilbe for
 // closing a file handle.
 func GetGitFile(filename string) (*os.File, error) {
@@ -84,6 +116,25 @@ func SplitHash(hash string) (string, string, error) {
 	return hash[:2], hash[2:], nil
 }
 
+// Get slash separated path relative to repository root. Relative paths are
+// resolved against current working directory.
+func RepoRelPath(repoRoot, path string) (string, error) {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	relPath, err := filepath.Rel(repoRoot, absPath)
+	if err != nil {
+		return "", err
+	}
+	if relPath == ".." || strings.HasPrefix(relPath, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("%s is outside repository at %s", path, repoRoot)
+	}
+	if relPath == "." {
+		return "", nil
+	}
+	return filepath.ToSlash(relPath), nil
+}
 
 func Usage(msg string) {
 	_, err := io.WriteString(os.Stderr, msg+"\n")
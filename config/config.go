@@ -0,0 +1,257 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/antoniszczepanik/gggit/common"
+)
+
+type Scope string
+
+// Configuration layers, from the least to the most specific. Values from
+// more specific layers override less specific ones.
+const (
+	SystemScope Scope = "system"
+	GlobalScope Scope = "global"
+	LocalScope  Scope = "local"
+)
+
+const (
+	defaultSystemConfig = "/etc/gggitconfig"
+	globalConfigName    = ".gggitconfig"
+	localConfigName     = "config"
+	// Protects from include cycles.
+	maxIncludeDepth = 10
+)
+
+var ErrKeyNotFound = errors.New("key not found")
+
+type Entry struct {
+	// Normalized key in "section.name" or "section.subsection.name" form.
+	Key   string
+	Value string
+	// Key given without a value, which is a boolean true.
+	NoValue bool
+	Scope   Scope
+	// File the entry was read from.
+	Origin string
+}
+
+// Configuration merged from all layers, in order entries were read.
+type Config struct {
+	Entries []Entry
+}
+
+// Get path to configuration file of a scope. GGGIT_CONFIG_SYSTEM and
+// GGGIT_CONFIG_GLOBAL environment variables override default locations.
+func ScopePath(scope Scope) (string, error) {
+	switch scope {
+	case SystemScope:
+		if path := os.Getenv("GGGIT_CONFIG_SYSTEM"); path != "" {
+			return path, nil
+		}
+		return defaultSystemConfig, nil
+	case GlobalScope:
+		if path := os.Getenv("GGGIT_CONFIG_GLOBAL"); path != "" {
+			return path, nil
+		}
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		return filepath.Join(home, globalConfigName), nil
+	case LocalScope:
+		return common.GetGitFilePath(localConfigName)
+	}
+	return "", fmt.Errorf("unknown config scope %q", scope)
+}
+
+// Load configuration from system, global and repository files. Missing files
+// are skipped, the repository layer is skipped outside of a repository.
+func Load() (*Config, error) {
+	c := &Config{}
+	for _, scope := range []Scope{SystemScope, GlobalScope, LocalScope} {
+		path, err := ScopePath(scope)
+		if scope == LocalScope && err != nil {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		if err := c.loadFile(path, scope, 0); err != nil {
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// Load configuration from a single file.
+func LoadFile(path string, scope Scope) (*Config, error) {
+	c := &Config{}
+	return c, c.loadFile(path, scope, 0)
+}
+
+func (c *Config) loadFile(path string, scope Scope, depth int) error {
+	content, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	entries, err := parse(string(content))
+	if err != nil {
+		return fmt.Errorf("bad config file %s: %w", path, err)
+	}
+	for _, e := range entries {
+		c.Entries = append(c.Entries, Entry{Key: e.key, Value: e.value, NoValue: e.noValue, Scope: scope, Origin: path})
+		if e.key != "include.path" || e.noValue {
+			continue
+		}
+		// Included files are read in place, as if their contents were
+		// part of the including file.
+		if depth >= maxIncludeDepth {
+			return fmt.Errorf("exceeded maximum include depth while including %s", e.value)
+		}
+		included, err := expandPath(e.value)
+		if err != nil {
+			return err
+		}
+		if !filepath.IsAbs(included) {
+			included = filepath.Join(filepath.Dir(path), included)
+		}
+		if err := c.loadFile(included, scope, depth+1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Get the last entry for a key.
+func (c *Config) Lookup(key string) (Entry, error) {
+	all, err := c.LookupAll(key)
+	if err != nil {
+		return Entry{}, err
+	}
+	if len(all) == 0 {
+		return Entry{}, ErrKeyNotFound
+	}
+	return all[len(all)-1], nil
+}
+
+// Get all entries for a multi-valued key.
+func (c *Config) LookupAll(key string) ([]Entry, error) {
+	key, err := NormalizeKey(key)
+	if err != nil {
+		return nil, err
+	}
+	var all []Entry
+	for _, e := range c.Entries {
+		if e.Key == key {
+			all = append(all, e)
+		}
+	}
+	return all, nil
+}
+
+// Get a string value, or a default if the key is not set.
+func (c *Config) Get(key, def string) (string, error) {
+	e, err := c.Lookup(key)
+	if err == ErrKeyNotFound {
+		return def, nil
+	} else if err != nil {
+		return "", err
+	}
+	return e.Value, nil
+}
+
+// Get a boolean value. true, yes, on and 1 are true, false, no, off, 0 and
+// an empty value are false. A key without a value is true.
+func (c *Config) GetBool(key string, def bool) (bool, error) {
+	e, err := c.Lookup(key)
+	if err == ErrKeyNotFound {
+		return def, nil
+	} else if err != nil {
+		return false, err
+	}
+	if e.NoValue {
+		return true, nil
+	}
+	b, err := ParseBool(e.Value)
+	if err != nil {
+		return false, fmt.Errorf("bad boolean config value '%s' for '%s'", e.Value, key)
+	}
+	return b, nil
+}
+
+// Get an integer value, optionally with a k, m or g suffix.
+func (c *Config) GetInt(key string, def int) (int, error) {
+	e, err := c.Lookup(key)
+	if err == ErrKeyNotFound {
+		return def, nil
+	} else if err != nil {
+		return 0, err
+	}
+	n, err := ParseInt(e.Value)
+	if err != nil {
+		return 0, fmt.Errorf("bad numeric config value '%s' for '%s'", e.Value, key)
+	}
+	return n, nil
+}
+
+// Get a path value with a leading "~/" expanded to the home directory.
+func (c *Config) GetPath(key, def string) (string, error) {
+	e, err := c.Lookup(key)
+	if err == ErrKeyNotFound {
+		return def, nil
+	} else if err != nil {
+		return "", err
+	}
+	return expandPath(e.Value)
+}
+
+func ParseBool(value string) (bool, error) {
+	switch strings.ToLower(value) {
+	case "true", "yes", "on", "1":
+		return true, nil
+	case "false", "no", "off", "0", "":
+		return false, nil
+	}
+	return false, fmt.Errorf("invalid boolean %q", value)
+}
+
+func ParseInt(value string) (int, error) {
+	multiplier := 1
+	if value != "" {
+		switch strings.ToLower(value[len(value)-1:]) {
+		case "k":
+			multiplier = 1 << 10
+		case "m":
+			multiplier = 1 << 20
+		case "g":
+			multiplier = 1 << 30
+		}
+		if multiplier != 1 {
+			value = value[:len(value)-1]
+		}
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, err
+	}
+	return n * multiplier, nil
+}
+
+func expandPath(path string) (string, error) {
+	if path != "~" && !strings.HasPrefix(path, "~/") {
+		return path, nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, path[1:]), nil
+}
@@ -0,0 +1,171 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Make home directory point at dir until the test ends.
+func setHome(t *testing.T, dir string) {
+	old, set := os.LookupEnv("HOME")
+	os.Setenv("HOME", dir)
+	t.Cleanup(func() {
+		if set {
+			os.Setenv("HOME", old)
+		} else {
+			os.Unsetenv("HOME")
+		}
+	})
+}
+
+func TestLoadFileIncludes(t *testing.T) {
+	dir := t.TempDir()
+	home := filepath.Join(dir, "home")
+	setHome(t, home)
+	path := filepath.Join(dir, "config")
+	writeFile(t, path, "[a]\n\tkey = 1\n[include]\n\tpath = sub/included\n\tpath = ~/home-included\n\tpath = missing\n[a]\n\tkey = 4\n")
+	writeFile(t, filepath.Join(dir, "sub", "included"), "[a]\n\tkey = 2\n")
+	writeFile(t, filepath.Join(home, "home-included"), "[a]\n\tkey = 3\n")
+	c, err := LoadFile(path, LocalScope)
+	if err != nil {
+		t.Fatal(err)
+	}
+	all, err := c.LookupAll("a.key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var values, origins []string
+	for _, e := range all {
+		values = append(values, e.Value)
+		origins = append(origins, e.Origin)
+	}
+	// Included files are read in place of their include.path entry.
+	if want := []string{"1", "2", "3", "4"}; !reflect.DeepEqual(values, want) {
+		t.Errorf("got values %v, want %v", values, want)
+	}
+	wantOrigins := []string{path, filepath.Join(dir, "sub", "included"), filepath.Join(home, "home-included"), path}
+	if !reflect.DeepEqual(origins, wantOrigins) {
+		t.Errorf("got origins %v, want %v", origins, wantOrigins)
+	}
+}
+
+func TestLoadFileIncludeCycle(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config")
+	writeFile(t, path, "[include]\n\tpath = config\n")
+	if _, err := LoadFile(path, LocalScope); err == nil {
+		t.Error("config including itself loaded without an error")
+	}
+}
+
+func TestGetters(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config")
+	writeFile(t, path, `[bool]
+	yes = yes
+	on = On
+	one = 1
+	flag
+	off = off
+	zero = 0
+	empty =
+	bad = maybe
+	overridden = true
+	overridden = false
+[int]
+	plain = 42
+	negative = -3
+	kilo = 2k
+	mega = 1M
+	giga = 1g
+	bad = 12x
+[path]
+	home = ~/file
+	plain = /etc/file
+	relative = file
+`)
+	home := t.TempDir()
+	setHome(t, home)
+	c, err := LoadFile(path, LocalScope)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bools := []struct {
+		key     string
+		def     bool
+		want    bool
+		wantErr bool
+	}{
+		{"bool.yes", false, true, false},
+		{"bool.on", false, true, false},
+		{"bool.one", false, true, false},
+		{"bool.flag", false, true, false},
+		{"bool.off", true, false, false},
+		{"bool.zero", true, false, false},
+		{"bool.empty", true, false, false},
+		{"bool.bad", false, false, true},
+		{"bool.overridden", true, false, false},
+		{"bool.missing", true, true, false},
+		{"Bool.Yes", false, true, false},
+	}
+	for _, test := range bools {
+		got, err := c.GetBool(test.key, test.def)
+		if (err != nil) != test.wantErr || got != test.want {
+			t.Errorf("%s: got %v, %v, want %v", test.key, got, err, test.want)
+		}
+	}
+	ints := []struct {
+		key     string
+		def     int
+		want    int
+		wantErr bool
+	}{
+		{"int.plain", 0, 42, false},
+		{"int.negative", 0, -3, false},
+		{"int.kilo", 0, 2 << 10, false},
+		{"int.mega", 0, 1 << 20, false},
+		{"int.giga", 0, 1 << 30, false},
+		{"int.bad", 0, 0, true},
+		{"int.missing", 7, 7, false},
+	}
+	for _, test := range ints {
+		got, err := c.GetInt(test.key, test.def)
+		if (err != nil) != test.wantErr || got != test.want {
+			t.Errorf("%s: got %v, %v, want %v", test.key, got, err, test.want)
+		}
+	}
+	paths := []struct {
+		key  string
+		def  string
+		want string
+	}{
+		{"path.home", "", filepath.Join(home, "file")},
+		{"path.plain", "", "/etc/file"},
+		{"path.relative", "", "file"},
+		{"path.missing", "default", "default"},
+	}
+	for _, test := range paths {
+		got, err := c.GetPath(test.key, test.def)
+		if err != nil || got != test.want {
+			t.Errorf("%s: got %v, %v, want %v", test.key, got, err, test.want)
+		}
+	}
+	if got, err := c.Get("path.missing", "default"); err != nil || got != "default" {
+		t.Errorf("missing key: got %v, %v, want default", got, err)
+	}
+	if _, err := c.Get("nosection", ""); err == nil {
+		t.Error("key without a section got without an error")
+	}
+}
@@ -0,0 +1,59 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/antoniszczepanik/gggit/common"
+)
+
+const identityHelp = `
+
+*** Please tell me who you are.
+
+Run
+
+  gggit config --global user.email "you@example.com"
+  gggit config --global user.name "Your Name"
+
+to set your account's default identity.`
+
+// Get identity for a role together with time it should be recorded with.
+// GGGIT_<ROLE>_NAME, GGGIT_<ROLE>_EMAIL and GGGIT_<ROLE>_DATE environment
+// variables take precedence over user.name, user.email and current time.
+func GetIdentity(role string, now time.Time) (common.Author, time.Time, error) {
+	c, err := Load()
+	if err != nil {
+		return common.Author{}, time.Time{}, err
+	}
+	name, nameSet := os.LookupEnv("GGGIT_" + role + "_NAME")
+	if !nameSet {
+		if name, err = c.Get("user.name", ""); err != nil {
+			return common.Author{}, time.Time{}, err
+		}
+	}
+	email, emailSet := os.LookupEnv("GGGIT_" + role + "_EMAIL")
+	if !emailSet {
+		if email, err = c.Get("user.email", ""); err != nil {
+			return common.Author{}, time.Time{}, err
+		}
+	}
+	if name == "" || email == "" {
+		return common.Author{}, time.Time{}, fmt.Errorf("%s identity unknown%s", roleName(role), identityHelp)
+	}
+	t := now
+	if date, ok := os.LookupEnv("GGGIT_" + role + "_DATE"); ok {
+		if t, err = common.ParseDate(date); err != nil {
+			return common.Author{}, time.Time{}, fmt.Errorf("invalid GGGIT_%s_DATE: %w", role, err)
+		}
+	}
+	return common.Author{Name: name, Email: email}, t, nil
+}
+
+func roleName(role string) string {
+	if role == common.CommitterRole {
+		return "committer"
+	}
+	return "author"
+}
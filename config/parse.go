@@ -0,0 +1,220 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+)
+
+// A single line of a config file that assigns a value to a key.
+type rawEntry struct {
+	key   string
+	value string
+	// Key given without "=", which stands for a boolean true.
+	noValue bool
+	line    int
+}
+
+// Parse contents of an INI-style config file:
+//
+//	# comment
+//	[section]
+//		key = value ; comment
+//		flag
+//	[section "subsection"]
+//		key = "quoted value with \"escapes\"" \
+//		      continued on the next line
+//
+// Section and key names are case insensitive, subsection names are not.
+func parse(content string) ([]rawEntry, error) {
+	var entries []rawEntry
+	section := ""
+	lines := strings.Split(content, "\n")
+	for i := 0; i < len(lines); i++ {
+		lineNo := i + 1
+		line := strings.TrimSpace(strings.TrimSuffix(lines[i], "\r"))
+		if line == "" || line[0] == '#' || line[0] == ';' {
+			continue
+		}
+		if line[0] == '[' {
+			var err error
+			if section, err = parseSectionHeader(line); err != nil {
+				return nil, fmt.Errorf("line %d: %w", lineNo, err)
+			}
+			continue
+		}
+		if section == "" {
+			return nil, fmt.Errorf("line %d: key outside of a section", lineNo)
+		}
+		name, rest := line, ""
+		if eq := strings.IndexAny(line, "=#;"); eq != -1 {
+			name, rest = line[:eq], line[eq:]
+		}
+		name = strings.TrimSpace(name)
+		if !validName(name) {
+			return nil, fmt.Errorf("line %d: invalid key name %q", lineNo, name)
+		}
+		entry := rawEntry{key: section + "." + strings.ToLower(name), line: lineNo}
+		if !strings.HasPrefix(rest, "=") {
+			entry.noValue = true
+			entries = append(entries, entry)
+			continue
+		}
+		value, last, err := parseValueLines(lines, i, rest[1:])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", lineNo, err)
+		}
+		entry.value = value
+		entries = append(entries, entry)
+		i = last
+	}
+	return entries, nil
+}
+
+// Parse "[section]", "[section "subsection"]" or "[section.subsection]"
+// into a key prefix.
+func parseSectionHeader(line string) (string, error) {
+	end := strings.LastIndex(line, "]")
+	if end == -1 {
+		return "", fmt.Errorf("unterminated section header %q", line)
+	}
+	if rest := strings.TrimSpace(line[end+1:]); rest != "" && rest[0] != '#' && rest[0] != ';' {
+		return "", fmt.Errorf("unexpected content after section header %q", line)
+	}
+	header := strings.TrimSpace(line[1:end])
+	quote := strings.Index(header, "\"")
+	if quote == -1 {
+		// Legacy [section.subsection] syntax lowercases everything.
+		for _, part := range strings.Split(header, ".") {
+			if !validName(part) {
+				return "", fmt.Errorf("invalid section name %q", header)
+			}
+		}
+		return strings.ToLower(header), nil
+	}
+	name := strings.TrimSpace(header[:quote])
+	if !validName(name) {
+		return "", fmt.Errorf("invalid section name %q", name)
+	}
+	quoted := header[quote:]
+	if len(quoted) < 2 || quoted[len(quoted)-1] != '"' {
+		return "", fmt.Errorf("invalid subsection in %q", line)
+	}
+	subsection := strings.NewReplacer(`\"`, `"`, `\\`, `\`).Replace(quoted[1 : len(quoted)-1])
+	return strings.ToLower(name) + "." + subsection, nil
+}
+
+// Parse a value given after "=" on line i, following the lines it is
+// continued on with a backslash at their end. Returns the value and index
+// of its last line.
+func parseValueLines(lines []string, i int, first string) (string, int, error) {
+	value, continued, quoted, err := parseValue(first, false)
+	for err == nil && continued && i+1 < len(lines) {
+		i++
+		var more string
+		more, continued, quoted, err = parseValue(strings.TrimSuffix(lines[i], "\r"), quoted)
+		value += more
+	}
+	if err == nil {
+		err = checkQuotes(quoted)
+	}
+	return value, i, err
+}
+
+// Parse a single line of a value, stripping comments and unescaping quoted
+// parts. Reports whether the value continues on the next line, and whether
+// it does so inside quotes.
+func parseValue(raw string, inQuotes bool) (string, bool, bool, error) {
+	var b strings.Builder
+	// Whitespace is kept only if followed by something other than a comment
+	// or the end of a line.
+	pendingSpace := ""
+	for i := 0; i < len(raw); i++ {
+		c := raw[i]
+		switch {
+		case c == '\\':
+			if i+1 == len(raw) {
+				b.WriteString(pendingSpace)
+				return b.String(), true, inQuotes, nil
+			}
+			i++
+			escaped, ok := map[byte]string{'n': "\n", 't': "\t", 'b': "\b", '"': `"`, '\\': `\`}[raw[i]]
+			if !ok {
+				return "", false, false, fmt.Errorf("invalid escape sequence \\%c", raw[i])
+			}
+			b.WriteString(pendingSpace + escaped)
+			pendingSpace = ""
+		case c == '"':
+			b.WriteString(pendingSpace)
+			pendingSpace = ""
+			inQuotes = !inQuotes
+		case inQuotes:
+			b.WriteByte(c)
+		case c == '#' || c == ';':
+			return b.String(), false, false, checkQuotes(inQuotes)
+		case c == ' ' || c == '\t':
+			if b.Len() > 0 {
+				pendingSpace += string(c)
+			}
+		default:
+			b.WriteString(pendingSpace)
+			pendingSpace = ""
+			b.WriteByte(c)
+		}
+	}
+	return b.String(), false, false, checkQuotes(inQuotes)
+}
+
+func checkQuotes(inQuotes bool) error {
+	if inQuotes {
+		return fmt.Errorf("unterminated quoted value")
+	}
+	return nil
+}
+
+// Section and key names consist of alphanumeric characters and dashes and
+// start with a letter.
+func validName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for i, c := range name {
+		isLetter := (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+		if !isLetter && (i == 0 || !(c == '-' || (c >= '0' && c <= '9'))) {
+			return false
+		}
+	}
+	return true
+}
+
+// Split a key into section (with subsection) and name, normalizing case of
+// section and name.
+func splitKey(key string) (string, string, string, error) {
+	first := strings.Index(key, ".")
+	last := strings.LastIndex(key, ".")
+	if first == -1 || last == len(key)-1 || first == 0 {
+		return "", "", "", fmt.Errorf("key does not contain a section: %s", key)
+	}
+	section := strings.ToLower(key[:first])
+	name := strings.ToLower(key[last+1:])
+	subsection := ""
+	if first != last {
+		subsection = key[first+1 : last]
+	}
+	if !validName(section) || !validName(name) {
+		return "", "", "", fmt.Errorf("invalid key: %s", key)
+	}
+	return section, subsection, name, nil
+}
+
+// Normalize case of a key, so that it can be compared with keys of parsed
+// entries.
+func NormalizeKey(key string) (string, error) {
+	section, subsection, name, err := splitKey(key)
+	if err != nil {
+		return "", err
+	}
+	if subsection != "" {
+		return section + "." + subsection + "." + name, nil
+	}
+	return section + "." + name, nil
+}
@@ -0,0 +1,125 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    []rawEntry
+	}{
+		{"plain", "[core]\n\tbare = false\n", []rawEntry{
+			{key: "core.bare", value: "false", line: 2},
+		}},
+		{"comments", "# comment\n; comment\n[core] # comment\nkey = a b ; comment\n", []rawEntry{
+			{key: "core.key", value: "a b", line: 4},
+		}},
+		{"no value", "[core]\n\tflag\n\tother # comment\n", []rawEntry{
+			{key: "core.flag", noValue: true, line: 2},
+			{key: "core.other", noValue: true, line: 3},
+		}},
+		{"empty value", "[core]\nkey =\n", []rawEntry{
+			{key: "core.key", line: 2},
+		}},
+		{"case of names", "[Core]\n\tIgnoreCase = true\n", []rawEntry{
+			{key: "core.ignorecase", value: "true", line: 2},
+		}},
+		{"subsection", "[Branch \"Feature/X\"]\n\tmerge = refs/heads/x\n", []rawEntry{
+			{key: "branch.Feature/X.merge", value: "refs/heads/x", line: 2},
+		}},
+		{"escaped subsection", `[remote "a\"b\\c"]` + "\nurl = u\n", []rawEntry{
+			{key: `remote.a"b\c.url`, value: "u", line: 2},
+		}},
+		{"legacy subsection", "[Branch.Main]\nremote = origin\n", []rawEntry{
+			{key: "branch.main.remote", value: "origin", line: 2},
+		}},
+		{"inner whitespace", "[a]\nkey = one \t two  \n", []rawEntry{
+			{key: "a.key", value: "one \t two", line: 2},
+		}},
+		{"quotes", "[a]\nkey = \" padded ; not a comment \" tail\n", []rawEntry{
+			{key: "a.key", value: " padded ; not a comment  tail", line: 2},
+		}},
+		{"escapes", `[a]` + "\n" + `key = "q\"uote" back\\slash tab\tnew\nline\b` + "\n", []rawEntry{
+			{key: "a.key", value: "q\"uote back\\slash tab\tnew\nline\b", line: 2},
+		}},
+		{"continuation", "[a]\nkey = first \\\nsecond\\\nthird\nother = x\n", []rawEntry{
+			{key: "a.key", value: "first secondthird", line: 2},
+			{key: "a.other", value: "x", line: 5},
+		}},
+		{"quoted continuation", "[a]\nkey = \"one\\\n two\"\n", []rawEntry{
+			{key: "a.key", value: "one two", line: 2},
+		}},
+		{"continuation at end of file", "[a]\nkey = value\\", []rawEntry{
+			{key: "a.key", value: "value", line: 2},
+		}},
+		{"carriage returns", "[a]\r\nkey = value\r\n", []rawEntry{
+			{key: "a.key", value: "value", line: 2},
+		}},
+		{"repeated key", "[a]\nkey = 1\n[b]\nkey = 2\n[a]\nkey = 3\n", []rawEntry{
+			{key: "a.key", value: "1", line: 2},
+			{key: "b.key", value: "2", line: 4},
+			{key: "a.key", value: "3", line: 6},
+		}},
+	}
+	for _, test := range tests {
+		got, err := parse(test.content)
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: got %+v, want %+v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+	}{
+		{"key outside of a section", "key = value\n"},
+		{"unterminated section", "[core\n"},
+		{"content after section", "[core] key = value\n"},
+		{"invalid section", "[co_re]\n"},
+		{"invalid subsection", "[remote \"origin]\n"},
+		{"invalid key", "[core]\n1key = value\n"},
+		{"invalid escape", "[core]\nkey = a\\qb\n"},
+		{"unterminated quote", "[core]\nkey = \"value\n"},
+		{"unterminated continued quote", "[core]\nkey = \"one\\\ntwo\n"},
+		{"quote continued at end of file", "[core]\nkey = \"one\\"},
+	}
+	for _, test := range tests {
+		if entries, err := parse(test.content); err == nil {
+			t.Errorf("%s: parsed as %+v", test.name, entries)
+		}
+	}
+}
+
+func TestNormalizeKey(t *testing.T) {
+	tests := []struct {
+		key  string
+		want string
+	}{
+		{"core.bare", "core.bare"},
+		{"Core.Bare", "core.bare"},
+		{"Branch.Feature.X.Merge", "branch.Feature.X.merge"},
+		{"url.https://host/.insteadOf", "url.https://host/.insteadof"},
+	}
+	for _, test := range tests {
+		got, err := NormalizeKey(test.key)
+		if err != nil {
+			t.Errorf("%s: %v", test.key, err)
+		} else if got != test.want {
+			t.Errorf("%s normalized to %s, want %s", test.key, got, test.want)
+		}
+	}
+	for _, key := range []string{"core", "core.", ".bare", "co_re.bare", "core.1bare"} {
+		if _, err := NormalizeKey(key); err == nil {
+			t.Errorf("%s normalized without an error", key)
+		}
+	}
+}
@@ -0,0 +1,172 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Where entries for a key are located in lines of a config file.
+type keyLocation struct {
+	// Line ranges of entries of the key, including continuation lines.
+	matches [][2]int
+	// Line after which a new entry of the key can be added, -1 if the
+	// section does not exist.
+	sectionEnd int
+}
+
+// Set a key in a config file, replacing its last value if it is already
+// set. The file is created if it does not exist. Formatting and comments of
+// other lines are preserved.
+func Set(path, key, value string) error {
+	section, subsection, name, err := splitKey(key)
+	if err != nil {
+		return err
+	}
+	lines, err := readLines(path)
+	if err != nil {
+		return err
+	}
+	loc, err := locateKey(lines, key)
+	if err != nil {
+		return fmt.Errorf("bad config file %s: %w", path, err)
+	}
+	newLine := fmt.Sprintf("\t%s = %s", name, formatValue(value))
+	switch {
+	case len(loc.matches) > 0:
+		last := loc.matches[len(loc.matches)-1]
+		lines = splice(lines, last[0], last[1], newLine)
+	case loc.sectionEnd != -1:
+		lines = splice(lines, loc.sectionEnd, loc.sectionEnd, newLine)
+	default:
+		header := "[" + section + "]"
+		if subsection != "" {
+			escaped := strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(subsection)
+			header = fmt.Sprintf("[%s \"%s\"]", section, escaped)
+		}
+		lines = append(lines, header, newLine)
+	}
+	return writeLines(path, lines)
+}
+
+// Remove all values of a key from a config file.
+func Unset(path, key string) error {
+	if _, _, _, err := splitKey(key); err != nil {
+		return err
+	}
+	lines, err := readLines(path)
+	if err != nil {
+		return err
+	}
+	loc, err := locateKey(lines, key)
+	if err != nil {
+		return fmt.Errorf("bad config file %s: %w", path, err)
+	}
+	if len(loc.matches) == 0 {
+		return ErrKeyNotFound
+	}
+	for i := len(loc.matches) - 1; i >= 0; i-- {
+		lines = splice(lines, loc.matches[i][0], loc.matches[i][1])
+	}
+	return writeLines(path, lines)
+}
+
+func locateKey(lines []string, key string) (keyLocation, error) {
+	key, err := NormalizeKey(key)
+	if err != nil {
+		return keyLocation{}, err
+	}
+	section := key[:strings.LastIndex(key, ".")]
+	loc := keyLocation{sectionEnd: -1}
+	current := ""
+	for i := 0; i < len(lines); i++ {
+		line := strings.TrimSpace(strings.TrimSuffix(lines[i], "\r"))
+		if line == "" || line[0] == '#' || line[0] == ';' {
+			continue
+		}
+		if line[0] == '[' {
+			if current, err = parseSectionHeader(line); err != nil {
+				return keyLocation{}, fmt.Errorf("line %d: %w", i+1, err)
+			}
+			if current == section {
+				loc.sectionEnd = i + 1
+			}
+			continue
+		}
+		start := i
+		name, rest := line, ""
+		if eq := strings.IndexAny(line, "=#;"); eq != -1 {
+			name, rest = line[:eq], line[eq:]
+		}
+		if strings.HasPrefix(rest, "=") {
+			var err error
+			if _, i, err = parseValueLines(lines, i, rest[1:]); err != nil {
+				return keyLocation{}, fmt.Errorf("line %d: %w", start+1, err)
+			}
+		}
+		if current != section {
+			continue
+		}
+		loc.sectionEnd = i + 1
+		if current+"."+strings.ToLower(strings.TrimSpace(name)) == key {
+			loc.matches = append(loc.matches, [2]int{start, i + 1})
+		}
+	}
+	return loc, nil
+}
+
+// Quote values that would not survive parsing unquoted.
+func formatValue(value string) string {
+	escaped := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "\t", `\t`, "\b", `\b`).Replace(value)
+	if value != strings.TrimSpace(value) || strings.ContainsAny(value, "#;") {
+		return `"` + escaped + `"`
+	}
+	return escaped
+}
+
+// Replace lines in [start, end) range with new ones.
+func splice(lines []string, start, end int, replacement ...string) []string {
+	result := append([]string{}, lines[:start]...)
+	result = append(result, replacement...)
+	return append(result, lines[end:]...)
+}
+
+func readLines(path string) ([]string, error) {
+	content, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	text := strings.TrimSuffix(string(content), "\n")
+	if text == "" {
+		return nil, nil
+	}
+	return strings.Split(text, "\n"), nil
+}
+
+// Write through a lock file, so that readers never see a partially written
+// config.
+func writeLines(path string, lines []string) error {
+	lockPath := path + ".lock"
+	f, err := os.OpenFile(lockPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if os.IsExist(err) {
+		return fmt.Errorf("could not lock config file %s: %s exists", path, lockPath)
+	} else if err != nil {
+		return err
+	}
+	content := ""
+	if len(lines) > 0 {
+		content = strings.Join(lines, "\n") + "\n"
+	}
+	if _, err := f.WriteString(content); err != nil {
+		f.Close()
+		os.Remove(lockPath)
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(lockPath)
+		return err
+	}
+	return os.Rename(lockPath, path)
+}
@@ -0,0 +1,220 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Edited lines are reformatted, all others are kept byte for byte.
+const writeTestConfig = `# Top comment
+[core]
+	bare = false ; trailing comment
+	editor = "vim -f"
+	multi = 1
+	multi = 2
+	long = first \
+second
+[remote "origin"]
+	url = https://example.com/repo
+; Comment before a section
+[user]
+	name = Someone
+`
+
+func TestSet(t *testing.T) {
+	tests := []struct {
+		name  string
+		key   string
+		value string
+		want  string
+	}{
+		{"replace value", "core.bare", "true", `# Top comment
+[core]
+	bare = true
+	editor = "vim -f"
+	multi = 1
+	multi = 2
+	long = first \
+second
+[remote "origin"]
+	url = https://example.com/repo
+; Comment before a section
+[user]
+	name = Someone
+`},
+		{"replace last of many values", "Core.Multi", "3", `# Top comment
+[core]
+	bare = false ; trailing comment
+	editor = "vim -f"
+	multi = 1
+	multi = 3
+	long = first \
+second
+[remote "origin"]
+	url = https://example.com/repo
+; Comment before a section
+[user]
+	name = Someone
+`},
+		{"replace continued value", "core.long", "short", `# Top comment
+[core]
+	bare = false ; trailing comment
+	editor = "vim -f"
+	multi = 1
+	multi = 2
+	long = short
+[remote "origin"]
+	url = https://example.com/repo
+; Comment before a section
+[user]
+	name = Someone
+`},
+		{"add to section", "core.pager", "less", `# Top comment
+[core]
+	bare = false ; trailing comment
+	editor = "vim -f"
+	multi = 1
+	multi = 2
+	long = first \
+second
+	pager = less
+[remote "origin"]
+	url = https://example.com/repo
+; Comment before a section
+[user]
+	name = Someone
+`},
+		{"add to subsection", "remote.origin.fetch", "+refs/heads/*:refs/remotes/origin/*", `# Top comment
+[core]
+	bare = false ; trailing comment
+	editor = "vim -f"
+	multi = 1
+	multi = 2
+	long = first \
+second
+[remote "origin"]
+	url = https://example.com/repo
+	fetch = +refs/heads/*:refs/remotes/origin/*
+; Comment before a section
+[user]
+	name = Someone
+`},
+		{"add section", "branch.Feature/X.merge", "refs/heads/x", writeTestConfig + `[branch "Feature/X"]
+	merge = refs/heads/x
+`},
+		{"quote value", "user.name", ` a "quoted" #name `, `# Top comment
+[core]
+	bare = false ; trailing comment
+	editor = "vim -f"
+	multi = 1
+	multi = 2
+	long = first \
+second
+[remote "origin"]
+	url = https://example.com/repo
+; Comment before a section
+[user]
+	name = " a \"quoted\" #name "
+`},
+	}
+	for _, test := range tests {
+		path := filepath.Join(t.TempDir(), "config")
+		writeFile(t, path, writeTestConfig)
+		if err := Set(path, test.key, test.value); err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		content, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(content) != test.want {
+			t.Errorf("%s: got\n%s\nwant\n%s", test.name, content, test.want)
+		}
+		// The value reads back as it was set.
+		c, err := LoadFile(path, LocalScope)
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		if got, err := c.Get(test.key, ""); err != nil || got != test.value {
+			t.Errorf("%s: read back %q, %v", test.name, got, err)
+		}
+	}
+}
+
+func TestSetCreatesFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config")
+	if err := Set(path, "core.bare", "false"); err != nil {
+		t.Fatal(err)
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "[core]\n\tbare = false\n"; string(content) != want {
+		t.Errorf("got %q, want %q", content, want)
+	}
+}
+
+func TestSetValueRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config")
+	for _, value := range []string{"", "plain", " padded ", "a#b;c", `back\slash`, `"quoted"`, "new\nline", "tab\there"} {
+		if err := Set(path, "a.key", value); err != nil {
+			t.Fatalf("%q: %v", value, err)
+		}
+		c, err := LoadFile(path, LocalScope)
+		if err != nil {
+			t.Fatalf("%q: %v", value, err)
+		}
+		if got, err := c.Get("a.key", "unset"); err != nil || got != value {
+			t.Errorf("set %q, read back %q, %v", value, got, err)
+		}
+	}
+}
+
+func TestUnset(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config")
+	writeFile(t, path, writeTestConfig)
+	for _, key := range []string{"core.multi", "core.long", "remote.origin.url"} {
+		if err := Unset(path, key); err != nil {
+			t.Fatalf("%s: %v", key, err)
+		}
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `# Top comment
+[core]
+	bare = false ; trailing comment
+	editor = "vim -f"
+[remote "origin"]
+; Comment before a section
+[user]
+	name = Someone
+`
+	if string(content) != want {
+		t.Errorf("got\n%s\nwant\n%s", content, want)
+	}
+	if err := Unset(path, "core.multi"); !errors.Is(err, ErrKeyNotFound) {
+		t.Errorf("unset of a missing key: got error %v, want %v", err, ErrKeyNotFound)
+	}
+}
+
+func TestSetLocked(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config")
+	writeFile(t, path, writeTestConfig)
+	writeFile(t, path+".lock", "")
+	if err := Set(path, "core.bare", "true"); err == nil {
+		t.Error("set succeeded while config was locked")
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(content) != writeTestConfig {
+		t.Errorf("locked config changed to\n%s", content)
+	}
+}
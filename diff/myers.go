@@ -0,0 +1,236 @@
+package diff
+
+import "strings"
+
+type Op int
+
+const (
+	Equal Op = iota
+	Delete
+	Insert
+)
+
+// A single step of an edit script turning one sequence of lines into
+// another. OldLine and NewLine are 0-based positions in the old and new
+// sequence. For insertions OldLine is the number of old lines preceding the
+// inserted one, for deletions the same goes for NewLine.
+type Edit struct {
+	Op      Op
+	OldLine int
+	NewLine int
+	Text    string
+}
+
+// Split text into lines, keeping line feeds. Last line lacks a line feed if
+// the text does not end with one.
+func Lines(text string) []string {
+	if text == "" {
+		return nil
+	}
+	lines := strings.SplitAfter(text, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// Find the shortest edit script turning a into b, using the linear space
+// variant of Myers' O(ND) algorithm: the middle snake of the shortest path
+// is found by searching from both ends at once, and both halves around it
+// are compared recursively. Scripts of large, very different inputs may be
+// a bit longer, see bisect. Within every changed region deletions come
+// before insertions.
+func Myers(a, b []string) []Edit {
+	d := &differ{a: a, b: b, deleted: make([]bool, len(a)), inserted: make([]bool, len(b))}
+	d.compare(0, len(a), 0, len(b))
+	return d.script()
+}
+
+// Lines of both sequences which are not a part of their longest common
+// subsequence are marked as deleted or inserted.
+type differ struct {
+	a, b     []string
+	deleted  []bool
+	inserted []bool
+}
+
+// Mark changed lines between a[aStart:aEnd] and b[bStart:bEnd].
+func (d *differ) compare(aStart, aEnd, bStart, bEnd int) {
+	// Common prefix and suffix are never a part of an edit.
+	for aStart < aEnd && bStart < bEnd && d.a[aStart] == d.b[bStart] {
+		aStart, bStart = aStart+1, bStart+1
+	}
+	for aStart < aEnd && bStart < bEnd && d.a[aEnd-1] == d.b[bEnd-1] {
+		aEnd, bEnd = aEnd-1, bEnd-1
+	}
+	switch {
+	case aStart == aEnd:
+		for y := bStart; y < bEnd; y++ {
+			d.inserted[y] = true
+		}
+	case bStart == bEnd:
+		for x := aStart; x < aEnd; x++ {
+			d.deleted[x] = true
+		}
+	default:
+		x, y, ok := d.bisect(aStart, aEnd, bStart, bEnd)
+		if !ok {
+			// Nothing in common, or at least nothing found cheaply.
+			for x := aStart; x < aEnd; x++ {
+				d.deleted[x] = true
+			}
+			for y := bStart; y < bEnd; y++ {
+				d.inserted[y] = true
+			}
+			return
+		}
+		d.compare(aStart, x, bStart, y)
+		d.compare(x, aEnd, y, bEnd)
+	}
+}
+
+// Find a point on the middle snake of the shortest edit script between
+// a[aStart:aEnd] and b[bStart:bEnd], which both have to be non-empty and
+// differ at their first and last lines. Furthest reaching paths are
+// followed forwards from the start and backwards from the end until they
+// overlap. Like git, once that gets too expensive the furthest reaching
+// path is split at instead, trading a minimal script for speed on large,
+// very different inputs. Returns false if there are no common lines.
+func (d *differ) bisect(aStart, aEnd, bStart, bEnd int) (int, int, bool) {
+	n, m := aEnd-aStart, bEnd-bStart
+	maxD := (n + m + 1) / 2
+	offset := maxD
+	size := 2*maxD + 2
+	// Furthest reaching x of forward and backward paths on every diagonal,
+	// backward ones counted from the ends.
+	forward, backward := make([]int, size), make([]int, size)
+	for i := range forward {
+		forward[i], backward[i] = -1, -1
+	}
+	forward[offset+1], backward[offset+1] = 0, 0
+	delta := n - m
+	// With odd delta forward paths reach the overlap first.
+	odd := delta%2 != 0
+	// Diagonals that ran off an edge of the grid are not followed again.
+	kStart, kEnd, rStart, rEnd := 0, 0, 0, 0
+	limit := maxCost(n + m)
+	for step := 0; step < maxD; step++ {
+		if step >= limit {
+			return d.furthestSplit(forward, backward, offset, step, aStart, bStart, n, m)
+		}
+		for k := -step + kStart; k <= step-kEnd; k += 2 {
+			x := furthest(forward, offset, k, step)
+			y := x - k
+			for x < n && y < m && d.a[aStart+x] == d.b[bStart+y] {
+				x, y = x+1, y+1
+			}
+			forward[offset+k] = x
+			switch {
+			case x > n:
+				kEnd += 2
+			case y > m:
+				kStart += 2
+			case odd:
+				r := offset + delta - k
+				if r >= 0 && r < size && backward[r] != -1 && x >= n-backward[r] {
+					return aStart + x, bStart + y, true
+				}
+			}
+		}
+		for k := -step + rStart; k <= step-rEnd; k += 2 {
+			x := furthest(backward, offset, k, step)
+			y := x - k
+			for x < n && y < m && d.a[aEnd-x-1] == d.b[bEnd-y-1] {
+				x, y = x+1, y+1
+			}
+			backward[offset+k] = x
+			switch {
+			case x > n:
+				rEnd += 2
+			case y > m:
+				rStart += 2
+			case !odd:
+				f := offset + delta - k
+				if f >= 0 && f < size && forward[f] != -1 && forward[f] >= n-x {
+					fx := forward[f]
+					return aStart + fx, bStart + fx - (f - offset), true
+				}
+			}
+		}
+	}
+	return 0, 0, false
+}
+
+// Cost of an edit script, in number of edits, past which the search for
+// the middle snake is cut short: square root of the number of lines, but no
+// less than minMaxCost.
+const minMaxCost = 256
+
+func maxCost(lines int) int {
+	cost := 1
+	for cost*cost < lines {
+		cost *= 2
+	}
+	if cost < minMaxCost {
+		return minMaxCost
+	}
+	return cost
+}
+
+// Split at whichever of forward and backward paths got further after given
+// number of steps. Returns false if neither made any progress.
+func (d *differ) furthestSplit(forward, backward []int, offset, step, aStart, bStart, n, m int) (int, int, bool) {
+	bestX, bestY, best := 0, 0, 0
+	for k := -step; k <= step; k++ {
+		if x := forward[offset+k]; x != -1 && x <= n && x-k >= 0 && x-k <= m && x+x-k > best && x+x-k < n+m {
+			bestX, bestY, best = x, x-k, x+x-k
+		}
+		if x := backward[offset+k]; x != -1 && x <= n && x-k >= 0 && x-k <= m && x+x-k > best && x+x-k < n+m {
+			bestX, bestY, best = n-x, m-(x-k), x+x-k
+		}
+	}
+	return aStart + bestX, bStart + bestY, best > 0
+}
+
+// Get x a path on diagonal k can start from after step edits, extending
+// the furthest path of a neighbouring diagonal by a deletion or an insertion.
+func furthest(v []int, offset, k, step int) int {
+	if k == -step || (k != step && v[offset+k-1] < v[offset+k+1]) {
+		return v[offset+k+1]
+	}
+	return v[offset+k-1] + 1
+}
+
+// Turn marked lines into an edit script.
+func (d *differ) script() []Edit {
+	edits := make([]Edit, 0, len(d.a)+len(d.b))
+	x, y := 0, 0
+	for x < len(d.a) || y < len(d.b) {
+		switch {
+		case x < len(d.a) && d.deleted[x]:
+			edits = append(edits, Edit{Op: Delete, OldLine: x, NewLine: y, Text: d.a[x]})
+			x++
+		case y < len(d.b) && d.inserted[y]:
+			edits = append(edits, Edit{Op: Insert, OldLine: x, NewLine: y, Text: d.b[y]})
+			y++
+		default:
+			edits = append(edits, Edit{Op: Equal, OldLine: x, NewLine: y, Text: d.a[x]})
+			x, y = x+1, y+1
+		}
+	}
+	return edits
+}
+
+// Count inserted and deleted lines of an edit script.
+func CountChanges(edits []Edit) (int, int) {
+	insertions, deletions := 0, 0
+	for _, e := range edits {
+		switch e.Op {
+		case Insert:
+			insertions++
+		case Delete:
+			deletions++
+		}
+	}
+	return insertions, deletions
+}
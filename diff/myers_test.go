@@ -0,0 +1,195 @@
+package diff
+
+import (
+	"math/rand"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestMyers(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b string
+		want []Edit
+	}{
+		{"both empty", "", "", []Edit{}},
+		{"old empty", "", "a\nb\n", []Edit{
+			{Insert, 0, 0, "a\n"},
+			{Insert, 0, 1, "b\n"},
+		}},
+		{"new empty", "a\nb\n", "", []Edit{
+			{Delete, 0, 0, "a\n"},
+			{Delete, 1, 0, "b\n"},
+		}},
+		{"identical", "a\nb\n", "a\nb\n", []Edit{
+			{Equal, 0, 0, "a\n"},
+			{Equal, 1, 1, "b\n"},
+		}},
+		{"nothing in common", "a\n", "b\n", []Edit{
+			{Delete, 0, 0, "a\n"},
+			{Insert, 1, 0, "b\n"},
+		}},
+		{"change in the middle", "a\nb\nc\n", "a\nx\ny\nc\n", []Edit{
+			{Equal, 0, 0, "a\n"},
+			{Delete, 1, 1, "b\n"},
+			{Insert, 2, 1, "x\n"},
+			{Insert, 2, 2, "y\n"},
+			{Equal, 2, 3, "c\n"},
+		}},
+		{"missing final line feed", "a\nb", "a\nb\n", []Edit{
+			{Equal, 0, 0, "a\n"},
+			{Delete, 1, 1, "b"},
+			{Insert, 2, 1, "b\n"},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Myers(Lines(tt.a), Lines(tt.b))
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Myers(%q, %q) = %v, want %v", tt.a, tt.b, got, tt.want)
+			}
+		})
+	}
+}
+
+// Edit scripts of random sequences have to turn one into another and be as
+// short as the longest common subsequence allows.
+func TestMyersRandom(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 500; i++ {
+		a, b := randomLines(r, 20), randomLines(r, 20)
+		edits := Myers(a, b)
+		checkScript(t, a, b, edits)
+		insertions, deletions := CountChanges(edits)
+		if want := len(a) + len(b) - 2*lcs(a, b); insertions+deletions != want {
+			t.Errorf("Myers(%q, %q) has %d changes, want %d", a, b, insertions+deletions, want)
+		}
+	}
+}
+
+// Search for the shortest script is cut short for large inputs, but the
+// script still has to be valid.
+func TestMyersLarge(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	a, b := randomLines(r, 5000), randomLines(r, 5000)
+	checkScript(t, a, b, Myers(a, b))
+}
+
+// Check that an edit script turns a into b.
+func checkScript(t *testing.T, a, b []string, edits []Edit) {
+	t.Helper()
+	x, y := 0, 0
+	for _, e := range edits {
+		if e.OldLine != x || e.NewLine != y {
+			t.Fatalf("edit %v at old line %d, new line %d", e, x, y)
+		}
+		if e.Op != Insert {
+			if x >= len(a) || a[x] != e.Text {
+				t.Fatalf("edit %v does not match old line %d", e, x)
+			}
+			x++
+		}
+		if e.Op != Delete {
+			if y >= len(b) || b[y] != e.Text {
+				t.Fatalf("edit %v does not match new line %d", e, y)
+			}
+			y++
+		}
+	}
+	if x != len(a) || y != len(b) {
+		t.Fatalf("script covers %d of %d old and %d of %d new lines", x, len(a), y, len(b))
+	}
+}
+
+func randomLines(r *rand.Rand, max int) []string {
+	lines := make([]string, r.Intn(max))
+	for i := range lines {
+		lines[i] = string(rune('a'+r.Intn(4))) + "\n"
+	}
+	return lines
+}
+
+// Length of the longest common subsequence, by dynamic programming.
+func lcs(a, b []string) int {
+	prev, cur := make([]int, len(b)+1), make([]int, len(b)+1)
+	for i := range a {
+		for j := range b {
+			switch {
+			case a[i] == b[j]:
+				cur[j+1] = prev[j] + 1
+			case prev[j+1] > cur[j]:
+				cur[j+1] = prev[j+1]
+			default:
+				cur[j+1] = cur[j]
+			}
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
+
+func TestLines(t *testing.T) {
+	tests := []struct {
+		text string
+		want []string
+	}{
+		{"", nil},
+		{"a", []string{"a"}},
+		{"a\n", []string{"a\n"}},
+		{"a\n\nb", []string{"a\n", "\n", "b"}},
+	}
+	for _, tt := range tests {
+		if got := Lines(tt.text); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Lines(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestUnified(t *testing.T) {
+	numbered := func(from, to int) string {
+		var sb strings.Builder
+		for i := from; i <= to; i++ {
+			sb.WriteString(string(rune('a'+i-1)) + "\n")
+		}
+		return sb.String()
+	}
+	tests := []struct {
+		name     string
+		old, new string
+		context  int
+		want     string
+	}{
+		{"both empty", "", "", DefaultContext, ""},
+		{"identical", "a\n", "a\n", DefaultContext, ""},
+		{"added file", "", "a\nb\n", DefaultContext, "@@ -0,0 +1,2 @@\n+a\n+b\n"},
+		{"removed file", "a\n", "", DefaultContext, "@@ -1 +0,0 @@\n-a\n"},
+		{"empty line added", "", "\n", DefaultContext, "@@ -0,0 +1 @@\n+\n"},
+		{
+			"no final line feed", "a\nb", "a\nc",
+			DefaultContext,
+			"@@ -1,2 +1,2 @@\n a\n-b\n\\ No newline at end of file\n+c\n\\ No newline at end of file\n",
+		},
+		{
+			"separate hunks", numbered(1, 12), strings.Replace(strings.Replace(numbered(1, 12), "b\n", "B\n", 1), "k\n", "K\n", 1),
+			1,
+			"@@ -1,3 +1,3 @@\n a\n-b\n+B\n c\n@@ -10,3 +10,3 @@\n j\n-k\n+K\n l\n",
+		},
+		{
+			"merged hunks", numbered(1, 8), strings.Replace(strings.Replace(numbered(1, 8), "b\n", "B\n", 1), "f\n", "F\n", 1),
+			2,
+			"@@ -1,8 +1,8 @@\n a\n-b\n+B\n c\n d\n e\n-f\n+F\n g\n h\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var sb strings.Builder
+			if err := Unified(&sb, tt.old, tt.new, tt.context); err != nil {
+				t.Fatal(err)
+			}
+			if got := sb.String(); got != tt.want {
+				t.Errorf("Unified(%q, %q) =\n%s\nwant\n%s", tt.old, tt.new, got, tt.want)
+			}
+		})
+	}
+}
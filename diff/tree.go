@@ -0,0 +1,125 @@
+package diff
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/antoniszczepanik/gggit/objects"
+)
+
+type Status byte
+
+const (
+	Added    Status = 'A'
+	Modified Status = 'M'
+	Deleted  Status = 'D'
+)
+
+// A file that differs between two trees. Old is empty for added files and
+// New is empty for deleted ones.
+type FileChange struct {
+	Path   string
+	Status Status
+	Old    objects.TreeEntry
+	New    objects.TreeEntry
+}
+
+// Compare two trees, descending only into subtrees that differ. Either of
+// trees can be nil, which stands for an empty tree.
+func CompareTrees(oldTree, newTree objects.Tree) ([]FileChange, error) {
+	var changes []FileChange
+	if err := compareTrees(oldTree, newTree, "", &changes); err != nil {
+		return nil, err
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Path < changes[j].Path })
+	return changes, nil
+}
+
+func compareTrees(oldTree, newTree objects.Tree, prefix string, changes *[]FileChange) error {
+	oldEntries := make(map[string]objects.TreeEntry)
+	for _, e := range oldTree {
+		oldEntries[e.Name] = e
+	}
+	newEntries := make(map[string]objects.TreeEntry)
+	for _, e := range newTree {
+		newEntries[e.Name] = e
+	}
+	for name, oldEntry := range oldEntries {
+		newEntry, ok := newEntries[name]
+		if !ok {
+			if err := compareEntries(name, &oldEntry, nil, prefix, changes); err != nil {
+				return err
+			}
+		} else if oldEntry.Hash != newEntry.Hash || oldEntry.Mode != newEntry.Mode {
+			if err := compareEntries(name, &oldEntry, &newEntry, prefix, changes); err != nil {
+				return err
+			}
+		}
+	}
+	for name, newEntry := range newEntries {
+		if _, ok := oldEntries[name]; !ok {
+			if err := compareEntries(name, nil, &newEntry, prefix, changes); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Record differences between two entries of the same name, any of which
+// can be missing.
+func compareEntries(name string, oldEntry, newEntry *objects.TreeEntry, prefix string, changes *[]FileChange) error {
+	var oldSubtree, newSubtree objects.Tree
+	var err error
+	if oldEntry != nil && oldEntry.Mode == objects.ModeTree {
+		if oldSubtree, err = entryTree(*oldEntry); err != nil {
+			return err
+		}
+		oldEntry = nil
+	}
+	if newEntry != nil && newEntry.Mode == objects.ModeTree {
+		if newSubtree, err = entryTree(*newEntry); err != nil {
+			return err
+		}
+		newEntry = nil
+	}
+	// A file replaced by a directory (or the other way around) is reported
+	// as a removal of one and addition of the other.
+	path := prefix + name
+	switch {
+	case oldEntry != nil && newEntry != nil:
+		*changes = append(*changes, FileChange{Path: path, Status: Modified, Old: *oldEntry, New: *newEntry})
+	case oldEntry != nil:
+		*changes = append(*changes, FileChange{Path: path, Status: Deleted, Old: *oldEntry})
+	case newEntry != nil:
+		*changes = append(*changes, FileChange{Path: path, Status: Added, New: *newEntry})
+	}
+	if oldSubtree == nil && newSubtree == nil {
+		return nil
+	}
+	return compareTrees(oldSubtree, newSubtree, path+"/", changes)
+}
+
+// Read a subtree an entry points at, unless it is already loaded.
+func entryTree(e objects.TreeEntry) (objects.Tree, error) {
+	if t, ok := e.Entry.(objects.Tree); ok {
+		return t, nil
+	}
+	return objects.ReadTree(e.Hash)
+}
+
+// Get content of a blob an entry points at.
+func EntryContent(e objects.TreeEntry) (string, error) {
+	// Submodules are shown by the commit they are at, just like git does.
+	if e.Mode == objects.ModeGitlink {
+		return fmt.Sprintf("Subproject commit %s\n", e.Hash), nil
+	}
+	o := e.Entry
+	if o == nil {
+		var err error
+		if o, err = objects.Read(e.Hash); err != nil {
+			return "", err
+		}
+	}
+	return o.GetContent()
+}
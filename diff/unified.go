@@ -0,0 +1,120 @@
+package diff
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+const DefaultContext = 3
+
+type Hunk struct {
+	OldStart int
+	OldLines int
+	NewStart int
+	NewLines int
+	Edits    []Edit
+}
+
+// Group changes of an edit script into hunks surrounded by up to context
+// lines of unchanged text. Hunks closer than 2*context lines are merged.
+func Hunks(edits []Edit, context int) []Hunk {
+	var hunks []Hunk
+	for i := 0; i < len(edits); {
+		if edits[i].Op == Equal {
+			i++
+			continue
+		}
+		start := i - context
+		if start < 0 {
+			start = 0
+		}
+		// Extend the hunk for as long as the next change is close enough.
+		end := i
+		for {
+			for end < len(edits) && edits[end].Op != Equal {
+				end++
+			}
+			next := end
+			for next < len(edits) && edits[next].Op == Equal {
+				next++
+			}
+			if next == len(edits) || next-end > 2*context {
+				break
+			}
+			end = next
+		}
+		stop := end + context
+		if stop > len(edits) {
+			stop = len(edits)
+		}
+		hunks = append(hunks, newHunk(edits[start:stop]))
+		i = stop
+	}
+	return hunks
+}
+
+func newHunk(edits []Edit) Hunk {
+	h := Hunk{Edits: edits}
+	for _, e := range edits {
+		if e.Op != Insert {
+			h.OldLines++
+		}
+		if e.Op != Delete {
+			h.NewLines++
+		}
+	}
+	// Ranges start with the first line of a hunk, or with the line preceding
+	// it if the range is empty.
+	h.OldStart, h.NewStart = edits[0].OldLine, edits[0].NewLine
+	if h.OldLines > 0 {
+		h.OldStart++
+	}
+	if h.NewLines > 0 {
+		h.NewStart++
+	}
+	return h
+}
+
+func (h Hunk) Header() string {
+	return fmt.Sprintf("@@ -%s +%s @@", formatRange(h.OldStart, h.OldLines), formatRange(h.NewStart, h.NewLines))
+}
+
+func formatRange(start, lines int) string {
+	if lines == 1 {
+		return fmt.Sprint(start)
+	}
+	return fmt.Sprintf("%d,%d", start, lines)
+}
+
+// Write hunks of unified diff between two texts.
+func Unified(w io.Writer, oldText, newText string, context int) error {
+	edits := Myers(Lines(oldText), Lines(newText))
+	for _, h := range Hunks(edits, context) {
+		if _, err := fmt.Fprintln(w, h.Header()); err != nil {
+			return err
+		}
+		for _, e := range h.Edits {
+			prefix := " "
+			switch e.Op {
+			case Insert:
+				prefix = "+"
+			case Delete:
+				prefix = "-"
+			}
+			line := prefix + e.Text
+			if !strings.HasSuffix(line, "\n") {
+				line += "\n\\ No newline at end of file\n"
+			}
+			if _, err := io.WriteString(w, line); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Texts with null bytes are treated as binary and never diffed line by line.
+func IsBinary(text string) bool {
+	return strings.IndexByte(text, 0) != -1
+}
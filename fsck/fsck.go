@@ -0,0 +1,240 @@
+package fsck
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/antoniszczepanik/gggit/index"
+	"github.com/antoniszczepanik/gggit/objects"
+	"github.com/antoniszczepanik/gggit/refs"
+)
+
+type Kind string
+
+const (
+	// Object cannot be read, does not hash to its name or is malformed.
+	Corrupt Kind = "corrupt"
+	// Object is referenced, but does not exist.
+	Missing Kind = "missing"
+	// Ref cannot be read or points at a wrong object.
+	BadRef Kind = "badref"
+	// Object is not referenced by anything. It is not an error, such
+	// objects are left behind e.g. by amended commits.
+	Dangling Kind = "dangling"
+)
+
+type Problem struct {
+	Kind Kind
+	// Type of the object, empty if unknown or if the problem is with a ref.
+	Type objects.ObjectType
+	// Hash of the object or name of the ref.
+	Name   string
+	Detail string
+}
+
+func (p Problem) IsError() bool {
+	return p.Kind != Dangling
+}
+
+// Format problem as "<kind> [<type> ]<name>[: <detail>]".
+func (p Problem) String() string {
+	s := string(p.Kind) + " "
+	if p.Type != "" {
+		s += string(p.Type) + " "
+	}
+	s += p.Name
+	if p.Detail != "" {
+		s += ": " + p.Detail
+	}
+	return s
+}
+
+// Reference from an object, or a ref, to an object of an expected type.
+type link struct {
+	from     string
+	fromType objects.ObjectType
+	to       string
+	toType   objects.ObjectType
+}
+
+// Verify every loose and packed object, check that everything objects and
+// refs point at exists and has the expected type, and find dangling objects.
+// Problems are returned in a stable order: corrupt objects, missing ones,
+// bad refs and dangling objects, each sorted by name.
+func Check() ([]Problem, error) {
+	hashes, err := allObjects()
+	if err != nil {
+		return nil, err
+	}
+	var problems []Problem
+	// Types of all existing objects, empty for those with unreadable headers.
+	types := make(map[string]objects.ObjectType, len(hashes))
+	var links []link
+	for _, hash := range hashes {
+		objectType, o, err := objects.Verify(hash)
+		types[hash] = objectType
+		if err != nil {
+			problems = append(problems, Problem{Kind: Corrupt, Type: objectType, Name: hash, Detail: err.Error()})
+			continue
+		}
+		links = append(links, linksOf(hash, o)...)
+	}
+	rootLinks, refProblems, err := roots(types)
+	if err != nil {
+		return nil, err
+	}
+	links = append(links, rootLinks...)
+
+	referenced := make(map[string]bool)
+	missing := make(map[string]bool)
+	for _, l := range links {
+		referenced[l.to] = true
+		actual, ok := types[l.to]
+		switch {
+		case !ok && !missing[l.to]:
+			missing[l.to] = true
+			problems = append(problems, Problem{Kind: Missing, Type: l.toType, Name: l.to, Detail: "referenced by " + l.describe()})
+		case ok && actual != "" && l.toType != "" && actual != l.toType:
+			problems = append(problems, Problem{Kind: Corrupt, Type: l.fromType, Name: l.from,
+				Detail: fmt.Sprintf("points at %s %s, not a %s", actual, l.to, l.toType)})
+		}
+	}
+	problems = append(problems, refProblems...)
+	for _, hash := range hashes {
+		if !referenced[hash] && types[hash] != "" {
+			problems = append(problems, Problem{Kind: Dangling, Type: types[hash], Name: hash})
+		}
+	}
+	order := map[Kind]int{Corrupt: 0, Missing: 1, BadRef: 2, Dangling: 3}
+	sort.SliceStable(problems, func(i, j int) bool {
+		if problems[i].Kind != problems[j].Kind {
+			return order[problems[i].Kind] < order[problems[j].Kind]
+		}
+		return problems[i].Name < problems[j].Name
+	})
+	return problems, nil
+}
+
+func (l link) describe() string {
+	if l.fromType == "" {
+		return l.from
+	}
+	return string(l.fromType) + " " + l.from
+}
+
+// Get sorted hashes of all loose and packed objects.
+func allObjects() ([]string, error) {
+	loose, err := objects.ListLoose()
+	if err != nil {
+		return nil, err
+	}
+	packed, err := objects.ListPacked()
+	if err != nil {
+		return nil, err
+	}
+	found := make(map[string]bool)
+	var hashes []string
+	for _, hash := range append(loose, packed...) {
+		if !found[hash] {
+			found[hash] = true
+			hashes = append(hashes, hash)
+		}
+	}
+	sort.Strings(hashes)
+	return hashes, nil
+}
+
+// Get objects a valid object points at. Submodule commits live in other
+// repositories and are skipped.
+func linksOf(hash string, o objects.Object) []link {
+	var links []link
+	add := func(to string, toType objects.ObjectType) {
+		links = append(links, link{from: hash, fromType: o.GetType(), to: to, toType: toType})
+	}
+	switch o := o.(type) {
+	case objects.Commit:
+		add(o.TreeHash, objects.TreeObject)
+		for _, parent := range o.Parents {
+			add(parent, objects.CommitObject)
+		}
+	case objects.Tag:
+		add(o.Object, o.Type)
+	case objects.Tree:
+		for _, e := range o {
+			if e.Mode != objects.ModeGitlink {
+				add(e.Hash, objects.TypeFromMode(e.Mode))
+			}
+		}
+	}
+	return links
+}
+
+// Get links from refs, HEAD, a merge in progress, the index and logs. Refs
+// which cannot be read, point at missing objects or, apart from tags, at
+// anything other than a commit are reported right away. Objects recorded
+// only in logs might be long gone, so they are not required to exist.
+func roots(types map[string]objects.ObjectType) ([]link, []Problem, error) {
+	var (
+		links    []link
+		problems []Problem
+	)
+	checkRef := func(name, hash string) {
+		actual, ok := types[hash]
+		switch {
+		case !ok:
+			// Reported as a bad ref only, not as a missing object too.
+			problems = append(problems, Problem{Kind: BadRef, Name: name, Detail: "points at missing object " + hash})
+			return
+		case actual == "":
+			// Already reported as corrupt.
+		case actual != objects.CommitObject && !strings.HasPrefix(name, "refs/tags/"):
+			problems = append(problems, Problem{Kind: BadRef, Name: name,
+				Detail: fmt.Sprintf("points at %s %s, not a commit", actual, hash)})
+		}
+		// Type is checked above, with a message about the ref.
+		links = append(links, link{from: name, to: hash})
+	}
+	names, err := refs.ListAllRefs()
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, name := range names {
+		hash, err := refs.ReadRef(name)
+		if err != nil {
+			problems = append(problems, Problem{Kind: BadRef, Name: name, Detail: err.Error()})
+			continue
+		}
+		checkRef(name, hash)
+	}
+	if head, err := refs.GetHeadCommitHash(); err == nil {
+		checkRef("HEAD", head)
+	} else if err != refs.ErrBranchWithoutHash {
+		problems = append(problems, Problem{Kind: BadRef, Name: "HEAD", Detail: err.Error()})
+	}
+	if mergeHead, _, err := refs.ReadMergeHead(); err == nil {
+		checkRef("MERGE_HEAD", mergeHead)
+	} else if err != refs.ErrNoMergeInProgress {
+		problems = append(problems, Problem{Kind: BadRef, Name: "MERGE_HEAD", Detail: err.Error()})
+	}
+
+	idx, err := index.Read()
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, e := range idx.Entries {
+		if e.Mode != objects.ModeGitlink {
+			links = append(links, link{from: "index entry " + e.Path, to: e.Hash, toType: objects.BlobObject})
+		}
+	}
+	logged, err := refs.LoggedHashes()
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, hash := range logged {
+		if _, ok := types[hash]; ok {
+			links = append(links, link{from: "logs", to: hash})
+		}
+	}
+	return links, problems, nil
+}
@@ -0,0 +1,148 @@
+package gc
+
+import (
+	"sort"
+	"time"
+
+	"github.com/antoniszczepanik/gggit/common"
+	"github.com/antoniszczepanik/gggit/config"
+	"github.com/antoniszczepanik/gggit/objects"
+)
+
+// Config key with the time before which unreachable objects are pruned.
+const PruneExpireKey = "gc.pruneExpire"
+
+// Unreachable objects younger than that are kept, as they might be about to
+// be referenced, e.g. by a commit being created right now.
+const DefaultPruneExpire = "2.weeks.ago"
+
+type Garbage struct {
+	Hash string
+	Type objects.ObjectType
+	// Bytes the object takes on disk.
+	Size   int64
+	Packed bool
+}
+
+// Get time before which unreachable objects are pruned, from configuration
+// unless given explicitly.
+func PruneExpire(value string) (time.Time, error) {
+	if value == "" {
+		c, err := config.Load()
+		if err != nil {
+			return time.Time{}, err
+		}
+		if value, err = c.Get(PruneExpireKey, DefaultPruneExpire); err != nil {
+			return time.Time{}, err
+		}
+	}
+	return common.ParseApproxDate(value, time.Now())
+}
+
+// Find unreachable objects last modified before expire, loose ones and, if
+// asked to, packed ones. Packed objects are as old as their pack. An object
+// stored in many places is found in each of them.
+func FindGarbage(reachable map[string]bool, expire time.Time, packed bool) ([]Garbage, error) {
+	var garbage []Garbage
+	loose, err := objects.ListLoose()
+	if err != nil {
+		return nil, err
+	}
+	for _, hash := range loose {
+		if reachable[hash] {
+			continue
+		}
+		fi, err := objects.StatLoose(hash)
+		if err != nil {
+			return nil, err
+		}
+		if !fi.ModTime().Before(expire) {
+			continue
+		}
+		objectType, err := objects.ReadType(hash)
+		if err != nil {
+			return nil, err
+		}
+		garbage = append(garbage, Garbage{Hash: hash, Type: objectType, Size: fi.Size()})
+	}
+	if !packed {
+		return garbage, nil
+	}
+	packedObjects, err := objects.ListPackedObjects()
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range packedObjects {
+		if reachable[p.Hash] || !p.ModTime.Before(expire) {
+			continue
+		}
+		objectType, err := objects.ReadType(p.Hash)
+		if err != nil {
+			return nil, err
+		}
+		garbage = append(garbage, Garbage{Hash: p.Hash, Type: objectType, Size: p.Size, Packed: true})
+	}
+	sort.SliceStable(garbage, func(i, j int) bool { return garbage[i].Hash < garbage[j].Hash })
+	return garbage, nil
+}
+
+// Remove unreachable loose objects. Packed ones are dropped by repacking.
+func RemoveLoose(garbage []Garbage) error {
+	for _, g := range garbage {
+		if g.Packed {
+			continue
+		}
+		if err := objects.RemoveLoose(g.Hash); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Pack all reachable objects into a single new pack, replacing all other
+// packs. Unreachable packed objects which have not expired yet are stored
+// loose, keeping modification time of their pack, so that they expire in
+// time rather than being kept alive by each repack. Returns stats of the
+// new pack, which is not written if there is nothing reachable.
+func Repack(reachable map[string]bool, expire time.Time, opts objects.PackOptions) (objects.PackStats, error) {
+	var stats objects.PackStats
+	oldPacks, err := objects.ListPacks()
+	if err != nil {
+		return stats, err
+	}
+	packedObjects, err := objects.ListPackedObjects()
+	if err != nil {
+		return stats, err
+	}
+	if len(reachable) > 0 {
+		hashes := make([]string, 0, len(reachable))
+		for hash := range reachable {
+			hashes = append(hashes, hash)
+		}
+		sort.Strings(hashes)
+		if stats, err = objects.WritePack(hashes, opts); err != nil {
+			return stats, err
+		}
+	}
+	for _, p := range packedObjects {
+		if reachable[p.Hash] || p.ModTime.Before(expire) {
+			continue
+		}
+		if _, err := objects.StatLoose(p.Hash); err == nil {
+			continue
+		}
+		if err := objects.Loosen(p.Hash, p.ModTime); err != nil {
+			return stats, err
+		}
+	}
+	for _, name := range oldPacks {
+		if name == stats.Name {
+			continue
+		}
+		if err := objects.RemovePack(name); err != nil {
+			return stats, err
+		}
+	}
+	_, err = objects.PrunePacked()
+	return stats, err
+}
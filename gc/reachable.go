@@ -0,0 +1,105 @@
+package gc
+
+import (
+	"github.com/antoniszczepanik/gggit/index"
+	"github.com/antoniszczepanik/gggit/objects"
+	"github.com/antoniszczepanik/gggit/refs"
+)
+
+// Collect hashes of all objects reachable from refs, HEAD, a merge in
+// progress, the index and logs. Missing objects are an error, as pruning
+// a corrupt repository could make things worse, except for those recorded
+// only in logs, which might be long gone.
+func Reachable() (map[string]bool, error) {
+	reachable := make(map[string]bool)
+	roots, err := roots()
+	if err != nil {
+		return nil, err
+	}
+	logged, err := refs.LoggedHashes()
+	if err != nil {
+		return nil, err
+	}
+	for _, hash := range logged {
+		if objects.Exists(hash) == nil {
+			roots = append(roots, hash)
+		}
+	}
+	if err := walk(roots, reachable); err != nil {
+		return nil, err
+	}
+	idx, err := index.Read()
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range idx.Entries {
+		if e.Mode != objects.ModeGitlink {
+			reachable[e.Hash] = true
+		}
+	}
+	return reachable, nil
+}
+
+func roots() ([]string, error) {
+	var roots []string
+	names, err := refs.ListAllRefs()
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range names {
+		hash, err := refs.ReadRef(name)
+		if err != nil {
+			return nil, err
+		}
+		roots = append(roots, hash)
+	}
+	head, err := refs.GetHeadCommitHash()
+	if err == nil {
+		roots = append(roots, head)
+	} else if err != refs.ErrBranchWithoutHash {
+		return nil, err
+	}
+	mergeHead, _, err := refs.ReadMergeHead()
+	if err == nil {
+		roots = append(roots, mergeHead)
+	} else if err != refs.ErrNoMergeInProgress {
+		return nil, err
+	}
+	return roots, nil
+}
+
+// Mark objects reachable from given ones. Blobs are marked without reading
+// them.
+func walk(hashes []string, reachable map[string]bool) error {
+	for len(hashes) > 0 {
+		hash := hashes[len(hashes)-1]
+		hashes = hashes[:len(hashes)-1]
+		if reachable[hash] {
+			continue
+		}
+		reachable[hash] = true
+		o, err := objects.Read(hash)
+		if err != nil {
+			return err
+		}
+		switch o := o.(type) {
+		case objects.Commit:
+			hashes = append(hashes, o.TreeHash)
+			hashes = append(hashes, o.Parents...)
+		case objects.Tag:
+			hashes = append(hashes, o.Object)
+		case objects.Tree:
+			for _, e := range o {
+				switch e.Mode {
+				case objects.ModeTree:
+					hashes = append(hashes, e.Hash)
+				case objects.ModeGitlink:
+					// Submodule commits live in other repositories.
+				default:
+					reachable[e.Hash] = true
+				}
+			}
+		}
+	}
+	return nil
+}
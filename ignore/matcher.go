@@ -0,0 +1,180 @@
+package ignore
+
+import (
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/antoniszczepanik/gggit/common"
+	"github.com/antoniszczepanik/gggit/config"
+)
+
+const (
+	IgnoreFileName = ".gggitignore"
+	// Ignore files of git's own repositories.
+	ForeignIgnoreFileName = ".gitignore"
+	excludeFile           = "info/exclude"
+)
+
+// Decides which paths of a repository are ignored. Ignore files in
+// directories take precedence over their parents, all of them over
+// .gggit/info/exclude and finally over the global excludes file
+// (core.excludesFile, ~/.config/gggit/ignore by default). Within a single
+// file the last matching pattern wins.
+type Matcher struct {
+	root string
+	// Name of ignore files, .gitignore in git's own repositories.
+	fileName string
+	// Patterns from .gggitignore files keyed by their directory.
+	dirPatterns map[string][]Pattern
+	exclude     []Pattern
+	global      []Pattern
+}
+
+// Create a matcher for a repository. Ignore files in directories are read
+// lazily, as paths in them are matched.
+func New(repoRoot string) (*Matcher, error) {
+	m := &Matcher{root: repoRoot, fileName: IgnoreFileName, dirPatterns: make(map[string][]Pattern)}
+	gitDir, err := common.GetGitDir(repoRoot)
+	if err != nil {
+		return nil, err
+	}
+	gitDirName := filepath.Base(gitDir)
+	if gitDirName == common.ForeignGitDirName {
+		m.fileName = ForeignIgnoreFileName
+	}
+	excludePath := filepath.Join(gitDir, filepath.FromSlash(excludeFile))
+	m.exclude, err = readPatterns(excludePath, path.Join(gitDirName, excludeFile), "")
+	if err != nil {
+		return nil, err
+	}
+	globalPath, err := globalExcludesFile()
+	if err != nil {
+		return nil, err
+	}
+	if globalPath != "" {
+		if m.global, err = readPatterns(globalPath, globalPath, ""); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+func globalExcludesFile() (string, error) {
+	c, err := config.Load()
+	if err != nil {
+		return "", err
+	}
+	excludesFile, err := c.GetPath("core.excludesFile", "")
+	if err != nil || excludesFile != "" {
+		return excludesFile, err
+	}
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		return "", nil
+	}
+	return filepath.Join(configDir, "gggit", "ignore"), nil
+}
+
+// Check whether a slash separated path relative to repository root is
+// ignored. Git directories are always ignored. A nil matcher ignores
+// nothing else.
+func (m *Matcher) IsIgnored(relPath string, isDir bool) (bool, error) {
+	if IsGitDir(path.Base(relPath)) {
+		return true, nil
+	}
+	if m == nil {
+		return false, nil
+	}
+	p, err := m.Match(relPath, isDir)
+	if err != nil {
+		return false, err
+	}
+	return p != nil && !p.Negate, nil
+}
+
+// Same as IsIgnored, but takes a filesystem path.
+func (m *Matcher) IsIgnoredFile(fsPath string, isDir bool) (bool, error) {
+	if m == nil {
+		return IsGitDir(filepath.Base(fsPath)), nil
+	}
+	relPath, err := common.RepoRelPath(m.root, fsPath)
+	if err != nil {
+		return false, err
+	}
+	return m.IsIgnored(relPath, isDir)
+}
+
+// Find the pattern deciding whether a path is ignored, nil if none applies.
+// The pattern might be a negated one, which means the path is explicitly
+// not ignored. Paths inside ignored directories cannot be re-included, so
+// the pattern excluding a parent directory is returned for them.
+func (m *Matcher) Match(relPath string, isDir bool) (*Pattern, error) {
+	parts := strings.Split(relPath, "/")
+	for i := 1; i < len(parts); i++ {
+		p, err := m.matchPath(strings.Join(parts[:i], "/"), true)
+		if err != nil {
+			return nil, err
+		}
+		if p != nil && !p.Negate {
+			return p, nil
+		}
+	}
+	return m.matchPath(relPath, isDir)
+}
+
+func (m *Matcher) matchPath(relPath string, isDir bool) (*Pattern, error) {
+	var levels [][]Pattern
+	for dir := path.Dir(relPath); ; dir = path.Dir(dir) {
+		if dir == "." {
+			dir = ""
+		}
+		patterns, err := m.patternsIn(dir)
+		if err != nil {
+			return nil, err
+		}
+		levels = append(levels, patterns)
+		if dir == "" {
+			break
+		}
+	}
+	levels = append(levels, m.exclude, m.global)
+	for _, patterns := range levels {
+		for i := len(patterns) - 1; i >= 0; i-- {
+			if patterns[i].Matches(relPath, isDir) {
+				return &patterns[i], nil
+			}
+		}
+	}
+	return nil, nil
+}
+
+func (m *Matcher) patternsIn(dir string) ([]Pattern, error) {
+	if patterns, ok := m.dirPatterns[dir]; ok {
+		return patterns, nil
+	}
+	source := path.Join(dir, m.fileName)
+	patterns, err := readPatterns(filepath.Join(m.root, filepath.FromSlash(source)), source, dir)
+	if err != nil {
+		return nil, err
+	}
+	m.dirPatterns[dir] = patterns
+	return patterns, nil
+}
+
+// Check if a file name is one of git directories, which are never tracked.
+func IsGitDir(name string) bool {
+	return name == common.GitDirName || name == common.ForeignGitDirName
+}
+
+// Read patterns from a file, a missing file has none.
+func readPatterns(fsPath, source, base string) ([]Pattern, error) {
+	content, err := os.ReadFile(fsPath)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return ParsePatterns(string(content), source, base)
+}
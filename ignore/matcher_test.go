@@ -0,0 +1,92 @@
+package ignore
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/antoniszczepanik/gggit/common"
+	"github.com/antoniszczepanik/gggit/config"
+	"github.com/antoniszczepanik/gggit/internal/testrepo"
+)
+
+func writeFiles(t *testing.T, root string, files map[string]string) {
+	t.Helper()
+	for path, content := range files {
+		fsPath := filepath.Join(root, filepath.FromSlash(path))
+		if err := os.MkdirAll(filepath.Dir(fsPath), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(fsPath, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestMatcher(t *testing.T) {
+	root := testrepo.Init(t)
+	writeFiles(t, root, map[string]string{
+		IgnoreFileName:                      "*.log\n!keep.log\nbuild/\n/top\n",
+		"sub/" + IgnoreFileName:             "!*.log\nlocal\n",
+		"sub/deep/" + IgnoreFileName:        "*.log\n",
+		common.GitDirName + "/info/exclude": "secret\n*.tmp\n",
+		"global":                            "*.bak\n!x.tmp\n",
+	})
+	configPath, err := config.ScopePath(config.LocalScope)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := config.Set(configPath, "core.excludesFile", filepath.Join(root, "global")); err != nil {
+		t.Fatal(err)
+	}
+	m, err := New(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		path  string
+		isDir bool
+		want  bool
+	}{
+		{"a.log", false, true},
+		{"keep.log", false, false},
+		{"d/keep.log", false, false},
+		// Nested ignore files take precedence over their parents.
+		{"sub/a.log", false, false},
+		{"sub/x/a.log", false, false},
+		{"sub/deep/a.log", false, true},
+		{"sub/local", false, true},
+		{"local", false, false},
+		{"build", true, true},
+		{"build", false, false},
+		{"build/x", false, true},
+		// Paths inside excluded directories cannot be re-included.
+		{"build/keep.log", false, true},
+		{"top", false, true},
+		{"sub/top", false, false},
+		{"secret", false, true},
+		{"sub/secret", false, true},
+		// Repository excludes take precedence over global ones.
+		{"x.tmp", false, true},
+		{"a.bak", false, true},
+		{common.GitDirName, true, true},
+		{"sub/" + common.GitDirName, true, true},
+		{"src/main.go", false, false},
+	}
+	for _, test := range tests {
+		got, err := m.IsIgnored(test.path, test.isDir)
+		if err != nil {
+			t.Fatalf("%s: %v", test.path, err)
+		}
+		if got != test.want {
+			t.Errorf("%s ignored: %v, want %v", test.path, got, test.want)
+		}
+	}
+	p, err := m.Match("build/keep.log", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p == nil || p.Text != "build/" || p.Source != IgnoreFileName || p.Line != 3 {
+		t.Errorf("build/keep.log matched %+v, want build/ of %s", p, IgnoreFileName)
+	}
+}
@@ -0,0 +1,164 @@
+package ignore
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// A single rule from an ignore file.
+type Pattern struct {
+	// Pattern as written in the file, used when explaining matches.
+	Text string
+	// File the pattern comes from and its line number.
+	Source string
+	Line   int
+	// Directory the pattern is relative to, "" for repository root.
+	Base string
+	// Pattern re-includes paths excluded by earlier patterns.
+	Negate bool
+	// Pattern matches only directories.
+	DirOnly bool
+	// Pattern is matched against the whole path relative to Base, instead
+	// of just the last path component.
+	Anchored bool
+	re       *regexp.Regexp
+}
+
+// Parse contents of an ignore file. Patterns follow gitignore rules:
+//
+//	# comment, \# for a literal hash
+//	*.log       matches in any directory
+//	/build      anchored to the directory of the ignore file
+//	doc/*.txt   anchored, since it contains a slash
+//	tmp/        matches directories only
+//	!keep.log   re-includes previously excluded paths
+//	**/foo, foo/**, a/**/b  match across directory levels
+func ParsePatterns(content, source, base string) ([]Pattern, error) {
+	var patterns []Pattern
+	for i, line := range strings.Split(content, "\n") {
+		line = trimTrailingSpace(strings.TrimSuffix(line, "\r"))
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		p := Pattern{Text: line, Source: source, Line: i + 1, Base: base}
+		if line[0] == '!' {
+			p.Negate = true
+			line = line[1:]
+		} else if strings.HasPrefix(line, `\!`) || strings.HasPrefix(line, `\#`) {
+			line = line[1:]
+		}
+		if strings.HasSuffix(line, "/") {
+			p.DirOnly = true
+			line = strings.TrimRight(line, "/")
+		}
+		if strings.Contains(line, "/") {
+			p.Anchored = true
+			line = strings.TrimPrefix(line, "/")
+		}
+		if line == "" {
+			continue
+		}
+		re, err := globToRegexp(line)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", source, i+1, err)
+		}
+		p.re = re
+		patterns = append(patterns, p)
+	}
+	return patterns, nil
+}
+
+// Check whether a slash separated path relative to repository root matches
+// the pattern. Paths outside of pattern's base never match.
+func (p Pattern) Matches(path string, isDir bool) bool {
+	if p.DirOnly && !isDir {
+		return false
+	}
+	if p.Base != "" {
+		if !strings.HasPrefix(path, p.Base+"/") {
+			return false
+		}
+		path = path[len(p.Base)+1:]
+	}
+	if !p.Anchored {
+		path = path[strings.LastIndex(path, "/")+1:]
+	}
+	return p.re.MatchString(path)
+}
+
+// Trailing spaces are ignored unless escaped with a backslash.
+func trimTrailingSpace(line string) string {
+	for strings.HasSuffix(line, " ") && !strings.HasSuffix(line, `\ `) {
+		line = line[:len(line)-1]
+	}
+	return line
+}
+
+// Translate a glob into a regular expression matching whole paths. "*", "?"
+// and character classes do not match slashes, "**" does when it forms
+// a whole path component.
+func globToRegexp(glob string) (*regexp.Regexp, error) {
+	var b strings.Builder
+	b.WriteString("^")
+	for i := 0; i < len(glob); i++ {
+		c := glob[i]
+		atComponentStart := i == 0 || glob[i-1] == '/'
+		switch {
+		case strings.HasPrefix(glob[i:], "**") && atComponentStart && (i+2 == len(glob) || glob[i+2] == '/'):
+			if i+2 == len(glob) {
+				// Trailing "**" matches everything inside.
+				b.WriteString(".*")
+				i++
+			} else {
+				// Leading or middle "**/" matches zero or more directories.
+				b.WriteString("(?:.*/)?")
+				i += 2
+			}
+		case c == '*':
+			b.WriteString("[^/]*")
+		case c == '?':
+			b.WriteString("[^/]")
+		case c == '[':
+			end := classEnd(glob, i)
+			if end == -1 {
+				b.WriteString(regexp.QuoteMeta("["))
+				continue
+			}
+			class := glob[i+1 : end]
+			b.WriteString("[")
+			if class[0] == '!' || class[0] == '^' {
+				b.WriteString("^/")
+				class = class[1:]
+			}
+			b.WriteString(strings.NewReplacer(`\`, `\\`, `[`, `\[`, `]`, `\]`).Replace(class))
+			b.WriteString("]")
+			i = end
+		case c == '\\' && i+1 < len(glob):
+			i++
+			b.WriteString(regexp.QuoteMeta(glob[i : i+1]))
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	b.WriteString("$")
+	return regexp.Compile(b.String())
+}
+
+// Find index of "]" closing a character class opened at i, -1 if there is
+// none. "]" right after the opening bracket is a literal.
+func classEnd(glob string, i int) int {
+	j := i + 1
+	if j < len(glob) && (glob[j] == '!' || glob[j] == '^') {
+		j++
+	}
+	if j < len(glob) && glob[j] == ']' {
+		j++
+	}
+	for ; j < len(glob); j++ {
+		if glob[j] == ']' {
+			return j
+		}
+	}
+	return -1
+}
@@ -0,0 +1,91 @@
+package ignore
+
+import "testing"
+
+// Check whether the last pattern of a file matching a path excludes it.
+func ignoredBy(patterns []Pattern, path string, isDir bool) bool {
+	for i := len(patterns) - 1; i >= 0; i-- {
+		if patterns[i].Matches(path, isDir) {
+			return !patterns[i].Negate
+		}
+	}
+	return false
+}
+
+func TestPatternMatches(t *testing.T) {
+	tests := []struct {
+		name     string
+		patterns string
+		base     string
+		path     string
+		isDir    bool
+		want     bool
+	}{
+		{"name in root", "*.log", "", "a.log", false, true},
+		{"name in subdirectory", "*.log", "", "a/b/c.log", false, true},
+		{"name not matching", "*.log", "", "a.logs", false, false},
+		{"question mark", "?.txt", "", "d/a.txt", false, true},
+		{"question mark needs a character", "?.txt", "", ".txt", false, false},
+		{"character class", "[ab].txt", "", "b.txt", false, true},
+		{"negated character class", "[!ab].txt", "", "b.txt", false, false},
+		{"star does not cross directories", "a*b", "", "a/b", false, false},
+		{"escaped hash", `\#notes`, "", "#notes", false, true},
+		{"comment", "#notes", "", "#notes", false, false},
+		{"escaped exclamation mark", `\!important`, "", "!important", false, true},
+		{"escaped trailing space", `name\ `, "", "name ", false, true},
+		{"trailing space is dropped", "name  ", "", "name", false, true},
+		{"negation", "*.log\n!keep.log", "", "keep.log", false, false},
+		{"negation of other files", "*.log\n!keep.log", "", "other.log", false, true},
+		{"last pattern wins", "!keep.log\n*.log", "", "keep.log", false, true},
+		{"leading slash anchors", "/build", "", "build", true, true},
+		{"leading slash anchors to root", "/build", "", "src/build", true, false},
+		{"middle slash anchors", "doc/*.txt", "", "doc/a.txt", false, true},
+		{"middle slash anchors to root", "doc/*.txt", "", "src/doc/a.txt", false, false},
+		{"anchored star does not cross directories", "doc/*.txt", "", "doc/x/a.txt", false, false},
+		{"anchored to base", "/build", "src", "src/build", true, true},
+		{"anchored to base only", "/build", "src", "src/x/build", true, false},
+		{"outside of base", "*.log", "src", "a.log", false, false},
+		{"name inside base", "*.log", "src", "src/x/a.log", false, true},
+		{"directory only matches directory", "tmp/", "", "x/tmp", true, true},
+		{"directory only skips file", "tmp/", "", "x/tmp", false, false},
+		{"anchored directory only", "/tmp/", "", "tmp", true, true},
+		{"leading double star", "**/foo", "", "foo", false, true},
+		{"leading double star in subdirectory", "**/foo", "", "a/b/foo", false, true},
+		{"leading double star before path", "**/foo/bar", "", "a/foo/bar", false, true},
+		{"trailing double star", "foo/**", "", "foo/a/b", false, true},
+		{"trailing double star skips directory itself", "foo/**", "", "foo", true, false},
+		{"middle double star without directories", "a/**/b", "", "a/b", false, true},
+		{"middle double star with directories", "a/**/b", "", "a/x/y/b", false, true},
+		{"middle double star is anchored", "a/**/b", "", "x/a/b", false, false},
+		{"double star within name", "a**b", "", "a/b", false, false},
+	}
+	for _, test := range tests {
+		patterns, err := ParsePatterns(test.patterns, ".gggitignore", test.base)
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		if got := ignoredBy(patterns, test.path, test.isDir); got != test.want {
+			t.Errorf("%s: %q ignores %s: %v, want %v", test.name, test.patterns, test.path, got, test.want)
+		}
+	}
+}
+
+func TestParsePatterns(t *testing.T) {
+	patterns, err := ParsePatterns("# comment\n\n!/build/\r\ndoc/*.txt\n/\n", "dir/.gggitignore", "dir")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Pattern{
+		{Text: "!/build/", Source: "dir/.gggitignore", Line: 3, Base: "dir", Negate: true, DirOnly: true, Anchored: true},
+		{Text: "doc/*.txt", Source: "dir/.gggitignore", Line: 4, Base: "dir", Anchored: true},
+	}
+	if len(patterns) != len(want) {
+		t.Fatalf("got %d patterns, want %d", len(patterns), len(want))
+	}
+	for i, p := range patterns {
+		p.re = nil
+		if p != want[i] {
+			t.Errorf("pattern %d is %+v, want %+v", i, p, want[i])
+		}
+	}
+}
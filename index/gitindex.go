@@ -0,0 +1,124 @@
+package index
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"time"
+)
+
+// Git's own index layout, versions 2 to 4 (all integers are big endian):
+//
+//	header:  "DIRC" | version uint32 | entry count uint32
+//	entry:   ctime, mtime seconds and nanoseconds uint32 each |
+//	         dev, ino, mode, uid, gid, size uint32 each | hash [20]byte |
+//	         flags uint16 | [extended flags uint16] | path
+//	trailer: extensions, followed by sha1 checksum of everything above
+//
+// Paths are NUL terminated and entries padded to a multiple of 8 bytes. In
+// version 4 paths are stored without padding, as the number of bytes to drop
+// from the end of previous path followed by the remaining suffix. Such index
+// is only ever read.
+const gitIndexSignature = "DIRC"
+
+const (
+	gitEntryFixedSize = 62
+	gitFlagExtended   = 0x4000
+	gitFlagStageShift = 12
+)
+
+func parseGitIndex(content []byte) (*Index, error) {
+	if len(content) < len(gitIndexSignature)+8+sha1.Size {
+		return nil, ErrCorruptIndex
+	}
+	body, checksum := content[:len(content)-sha1.Size], content[len(content)-sha1.Size:]
+	// Git might skip calculating the checksum, leaving it zeroed.
+	if sum := sha1.Sum(body); !bytes.Equal(sum[:], checksum) && !bytes.Equal(checksum, make([]byte, sha1.Size)) {
+		return nil, fmt.Errorf("%w: checksum mismatch", ErrCorruptIndex)
+	}
+	version := binary.BigEndian.Uint32(body[4:8])
+	if version < 2 || version > 4 {
+		return nil, fmt.Errorf("unsupported git index version %d", version)
+	}
+	count := binary.BigEndian.Uint32(body[8:12])
+	idx := &Index{Entries: make([]Entry, 0, count)}
+	rest := body[12:]
+	previousPath := ""
+	for i := uint32(0); i < count; i++ {
+		e, size, err := parseGitEntry(rest, version, previousPath)
+		if err != nil {
+			return nil, fmt.Errorf("%w: entry %d: %v", ErrCorruptIndex, i, err)
+		}
+		idx.Entries = append(idx.Entries, e)
+		previousPath = e.Path
+		rest = rest[size:]
+	}
+	return idx, nil
+}
+
+// Parse a single entry, returning number of bytes it takes.
+func parseGitEntry(b []byte, version uint32, previousPath string) (Entry, int, error) {
+	if len(b) < gitEntryFixedSize {
+		return Entry{}, 0, fmt.Errorf("entry is truncated")
+	}
+	field := func(i int) uint32 { return binary.BigEndian.Uint32(b[i*4:]) }
+	flags := binary.BigEndian.Uint16(b[60:62])
+	e := Entry{
+		MTime: time.Unix(int64(field(2)), int64(field(3))),
+		Mode:  fmt.Sprintf("%06o", field(6)),
+		Size:  int64(field(9)),
+		Hash:  hex.EncodeToString(b[40:60]),
+		Stage: int(flags>>gitFlagStageShift) & 3,
+	}
+	n := gitEntryFixedSize
+	if flags&gitFlagExtended != 0 {
+		if version < 3 {
+			return Entry{}, 0, fmt.Errorf("extended flags in version %d index", version)
+		}
+		n += 2
+	}
+	if version == 4 {
+		strip, varintLen := readGitVarint(b[n:])
+		if varintLen == 0 || strip > uint64(len(previousPath)) {
+			return Entry{}, 0, fmt.Errorf("invalid path compression")
+		}
+		n += varintLen
+		end := bytes.IndexByte(b[n:], 0)
+		if end == -1 {
+			return Entry{}, 0, fmt.Errorf("path is not terminated")
+		}
+		e.Path = previousPath[:len(previousPath)-int(strip)] + string(b[n:n+end])
+		return e, n + end + 1, nil
+	}
+	end := bytes.IndexByte(b[n:], 0)
+	if end == -1 {
+		return Entry{}, 0, fmt.Errorf("path is not terminated")
+	}
+	e.Path = string(b[n : n+end])
+	// At least one NUL byte pads the entry to a multiple of 8 bytes.
+	size := (n + end + 8) &^ 7
+	if size > len(b) {
+		return Entry{}, 0, fmt.Errorf("entry is truncated")
+	}
+	return e, size, nil
+}
+
+// Read a variable length integer, stored most significant bits first, with
+// every continuation adding one. Returns 0 length if it is truncated.
+func readGitVarint(b []byte) (uint64, int) {
+	if len(b) == 0 {
+		return 0, 0
+	}
+	value := uint64(b[0] & 0x7f)
+	i := 1
+	for b[i-1]&0x80 != 0 {
+		if i >= len(b) {
+			return 0, 0
+		}
+		value = ((value + 1) << 7) | uint64(b[i]&0x7f)
+		i++
+	}
+	return value, i
+}
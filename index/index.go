@@ -0,0 +1,381 @@
+package index
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/antoniszczepanik/gggit/common"
+	"github.com/antoniszczepanik/gggit/objects"
+)
+
+// Index file layout (all integers are big endian):
+//
+//	header:  "GIDX" | version uint32 | entry count uint32
+//	entry:   mtime seconds int64 | mtime nanoseconds uint32 | size uint64 |
+//	         mode uint32 | hash [20]byte | stage uint8 | path length uint16 | path
+//	trailer: sha1 checksum of everything above
+const (
+	indexFileName  = "index"
+	indexSignature = "GIDX"
+	indexVersion   = 1
+)
+
+var ErrCorruptIndex = errors.New("index file is corrupt")
+
+type Entry struct {
+	// Slash separated path relative to repository root.
+	Path  string
+	Mode  string
+	Hash  string
+	Size  int64
+	MTime time.Time
+	// 0 for regular entries, 1-3 for base, ours and theirs versions
+	// of a conflicting file.
+	Stage int
+}
+
+type Index struct {
+	Entries []Entry
+}
+
+// Read index of current repository. Missing index file is treated as an
+// empty index. Index of git's own repositories is read too.
+func Read() (*Index, error) {
+	indexPath, err := common.GetGitFilePath(indexFileName)
+	if err != nil {
+		return nil, err
+	}
+	content, err := os.ReadFile(indexPath)
+	if os.IsNotExist(err) {
+		return &Index{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if bytes.HasPrefix(content, []byte(gitIndexSignature)) {
+		return parseGitIndex(content)
+	}
+	return parseIndex(content)
+}
+
+// Write index to disk. The new content is written to a lock file first and
+// renamed over the old index, so readers never see a partial file. Fails if
+// the lock file exists, as another process is writing the index then.
+func (idx *Index) Write() error {
+	if err := common.CheckWritable(); err != nil {
+		return err
+	}
+	indexPath, err := common.GetGitFilePath(indexFileName)
+	if err != nil {
+		return err
+	}
+	content, err := idx.serialize()
+	if err != nil {
+		return err
+	}
+	lockPath := indexPath + ".lock"
+	f, err := os.OpenFile(lockPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if os.IsExist(err) {
+		return fmt.Errorf("could not lock index %s: %s exists", indexPath, lockPath)
+	} else if err != nil {
+		return fmt.Errorf("write index: %w", err)
+	}
+	if _, err := f.Write(content); err != nil {
+		f.Close()
+		os.Remove(lockPath)
+		return fmt.Errorf("write index: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(lockPath)
+		return fmt.Errorf("write index: %w", err)
+	}
+	if err := os.Rename(lockPath, indexPath); err != nil {
+		os.Remove(lockPath)
+		return fmt.Errorf("write index: %w", err)
+	}
+	return nil
+}
+
+// Get a regular (stage 0) entry for a path.
+func (idx *Index) Get(path string) (Entry, bool) {
+	i := idx.search(path)
+	if i < len(idx.Entries) && idx.Entries[i].Path == path && idx.Entries[i].Stage == 0 {
+		return idx.Entries[i], true
+	}
+	return Entry{}, false
+}
+
+// Add an entry, replacing all entries (including conflict stages) that exist
+// for the same path, and those of a file or directory it takes place of.
+func (idx *Index) Add(e Entry) {
+	idx.evict(e.Path)
+	i := idx.search(e.Path)
+	idx.Entries = append(idx.Entries, Entry{})
+	copy(idx.Entries[i+1:], idx.Entries[i:])
+	idx.Entries[i] = e
+}
+
+// Record conflicting versions of a path, replacing all of its entries.
+// Entries have to share the same path and have distinct, non-zero stages.
+func (idx *Index) AddConflict(entries ...Entry) {
+	if len(entries) == 0 {
+		return
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Stage < entries[j].Stage })
+	idx.Remove(entries[0].Path)
+	i := idx.search(entries[0].Path)
+	rest := append([]Entry(nil), idx.Entries[i:]...)
+	idx.Entries = append(append(idx.Entries[:i], entries...), rest...)
+}
+
+// Check whether there are any conflicting (non-zero stage) entries.
+func (idx *Index) HasConflicts() bool {
+	for _, e := range idx.Entries {
+		if e.Stage != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// Remove all entries for a path. Returns false if there was nothing to remove.
+func (idx *Index) Remove(path string) bool {
+	i := idx.search(path)
+	j := i
+	for j < len(idx.Entries) && idx.Entries[j].Path == path {
+		j++
+	}
+	if i == j {
+		return false
+	}
+	idx.Entries = append(idx.Entries[:i], idx.Entries[j:]...)
+	return true
+}
+
+// Remove all entries for a path, entries of files that are its parent
+// directories and entries inside of it, if it was a directory.
+func (idx *Index) evict(path string) {
+	idx.Remove(path)
+	for dir := path; ; {
+		slash := strings.LastIndex(dir, "/")
+		if slash == -1 {
+			break
+		}
+		dir = dir[:slash]
+		idx.Remove(dir)
+	}
+	i := idx.search(path + "/")
+	j := i
+	for j < len(idx.Entries) && strings.HasPrefix(idx.Entries[j].Path, path+"/") {
+		j++
+	}
+	idx.Entries = append(idx.Entries[:i], idx.Entries[j:]...)
+}
+
+// Get all entries matching a pathspec, that is either the exact path or all
+// paths inside of a directory. Empty pathspec matches every entry.
+func (idx *Index) Match(pathspec string) []Entry {
+	var matches []Entry
+	for _, e := range idx.Entries {
+		if MatchesPathspec(e.Path, pathspec) {
+			matches = append(matches, e)
+		}
+	}
+	return matches
+}
+
+func MatchesPathspec(path, pathspec string) bool {
+	return pathspec == "" || path == pathspec || strings.HasPrefix(path, pathspec+"/")
+}
+
+// Find position of the first entry for path.
+func (idx *Index) search(path string) int {
+	return sort.Search(len(idx.Entries), func(i int) bool {
+		return idx.Entries[i].Path >= path
+	})
+}
+
+// Create an index entry for a file in working directory, writing its content
+// to the object database.
+func NewEntryFromFile(repoRoot, path string) (Entry, error) {
+	entries, err := newEntriesFromFiles(repoRoot, []string{path}, 1)
+	if err != nil {
+		return Entry{}, err
+	}
+	return entries[0], nil
+}
+
+// Create index entries for files in working directory like NewEntryFromFile,
+// with their content written by as many workers as configured with
+// core.parallelism. Entries are in the same order as paths.
+func NewEntriesFromFiles(repoRoot string, paths []string) ([]Entry, error) {
+	workers, err := objects.Parallelism()
+	if err != nil {
+		return nil, err
+	}
+	return newEntriesFromFiles(repoRoot, paths, workers)
+}
+
+func newEntriesFromFiles(repoRoot string, paths []string, workers int) ([]Entry, error) {
+	fullPaths := make([]string, len(paths))
+	infos := make([]os.FileInfo, len(paths))
+	for i, path := range paths {
+		fullPaths[i] = filepath.Join(repoRoot, filepath.FromSlash(path))
+		fi, err := os.Lstat(fullPaths[i])
+		if err != nil {
+			return nil, err
+		}
+		if !fi.Mode().IsRegular() && fi.Mode()&os.ModeSymlink == 0 {
+			return nil, fmt.Errorf("%s is neither a regular file nor a symlink", path)
+		}
+		infos[i] = fi
+	}
+	hashes, err := objects.WriteBlobs(context.Background(), fullPaths, infos, workers)
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]Entry, len(paths))
+	for i, path := range paths {
+		entries[i] = Entry{
+			Path:  path,
+			Mode:  objects.ModeFromFileInfo(infos[i]),
+			Hash:  hashes[i],
+			Size:  infos[i].Size(),
+			MTime: infos[i].ModTime(),
+		}
+	}
+	return entries, nil
+}
+
+// Build a tree out of regular index entries, without writing anything to
+// the object database.
+func (idx *Index) Tree() (objects.Tree, error) {
+	files := make(map[string]objects.TreeEntry)
+	for _, e := range idx.Entries {
+		if e.Stage != 0 {
+			return nil, fmt.Errorf("cannot write tree: %s is unmerged", e.Path)
+		}
+		files[e.Path] = objects.TreeEntry{Mode: e.Mode, Hash: e.Hash}
+	}
+	return objects.NewTreeFromEntries(files)
+}
+
+// Build tree objects out of index entries and write them to the object
+// database. Returns hash of the root tree.
+func (idx *Index) WriteTree() (string, error) {
+	if len(idx.Entries) == 0 {
+		return "", errors.New("cannot write tree of an empty index")
+	}
+	t, err := idx.Tree()
+	if err != nil {
+		return "", err
+	}
+	if err := t.Write(); err != nil {
+		return "", err
+	}
+	return objects.CalculateHash(t)
+}
+
+func (idx *Index) serialize() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteString(indexSignature)
+	binary.Write(&buf, binary.BigEndian, uint32(indexVersion))
+	binary.Write(&buf, binary.BigEndian, uint32(len(idx.Entries)))
+	for _, e := range idx.Entries {
+		mode, err := strconv.ParseUint(e.Mode, 8, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid mode %q of %s", e.Mode, e.Path)
+		}
+		hash, err := hex.DecodeString(e.Hash)
+		if err != nil || len(hash) != sha1.Size {
+			return nil, fmt.Errorf("invalid hash %q of %s", e.Hash, e.Path)
+		}
+		if len(e.Path) > 0xffff {
+			return nil, fmt.Errorf("path %s is too long", e.Path)
+		}
+		binary.Write(&buf, binary.BigEndian, e.MTime.Unix())
+		binary.Write(&buf, binary.BigEndian, uint32(e.MTime.Nanosecond()))
+		binary.Write(&buf, binary.BigEndian, uint64(e.Size))
+		binary.Write(&buf, binary.BigEndian, uint32(mode))
+		buf.Write(hash)
+		buf.WriteByte(byte(e.Stage))
+		binary.Write(&buf, binary.BigEndian, uint16(len(e.Path)))
+		buf.WriteString(e.Path)
+	}
+	checksum := sha1.Sum(buf.Bytes())
+	buf.Write(checksum[:])
+	return buf.Bytes(), nil
+}
+
+func parseIndex(content []byte) (*Index, error) {
+	if len(content) < len(indexSignature)+8+sha1.Size {
+		return nil, ErrCorruptIndex
+	}
+	body, checksum := content[:len(content)-sha1.Size], content[len(content)-sha1.Size:]
+	if sum := sha1.Sum(body); !bytes.Equal(sum[:], checksum) {
+		return nil, fmt.Errorf("%w: checksum mismatch", ErrCorruptIndex)
+	}
+	r := bufio.NewReader(bytes.NewReader(body))
+	signature := make([]byte, len(indexSignature))
+	if _, err := io.ReadFull(r, signature); err != nil || string(signature) != indexSignature {
+		return nil, fmt.Errorf("%w: bad signature", ErrCorruptIndex)
+	}
+	var version, count uint32
+	if err := binary.Read(r, binary.BigEndian, &version); err != nil {
+		return nil, ErrCorruptIndex
+	}
+	if version != indexVersion {
+		return nil, fmt.Errorf("unsupported index version %d", version)
+	}
+	if err := binary.Read(r, binary.BigEndian, &count); err != nil {
+		return nil, ErrCorruptIndex
+	}
+	idx := &Index{Entries: make([]Entry, 0, count)}
+	for i := uint32(0); i < count; i++ {
+		e, err := parseEntry(r)
+		if err != nil {
+			return nil, fmt.Errorf("%w: entry %d: %v", ErrCorruptIndex, i, err)
+		}
+		idx.Entries = append(idx.Entries, e)
+	}
+	return idx, nil
+}
+
+func parseEntry(r io.Reader) (Entry, error) {
+	var fixed struct {
+		Seconds     int64
+		Nanoseconds uint32
+		Size        uint64
+		Mode        uint32
+		Hash        [sha1.Size]byte
+		Stage       uint8
+		PathLen     uint16
+	}
+	if err := binary.Read(r, binary.BigEndian, &fixed); err != nil {
+		return Entry{}, err
+	}
+	path := make([]byte, fixed.PathLen)
+	if _, err := io.ReadFull(r, path); err != nil {
+		return Entry{}, err
+	}
+	return Entry{
+		Path:  string(path),
+		Mode:  fmt.Sprintf("%06o", fixed.Mode),
+		Hash:  hex.EncodeToString(fixed.Hash[:]),
+		Size:  int64(fixed.Size),
+		MTime: time.Unix(fixed.Seconds, int64(fixed.Nanoseconds)),
+		Stage: int(fixed.Stage),
+	}, nil
+}
@@ -0,0 +1,222 @@
+package index
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/antoniszczepanik/gggit/config"
+	"github.com/antoniszczepanik/gggit/internal/testrepo"
+	"github.com/antoniszczepanik/gggit/objects"
+)
+
+const (
+	hashA = "8ab686eafeb1f44702738c8b0f24f2567c36da6d"
+	hashB = "e69de29bb2d1d6434b8b29ae775ad8c2e48c5391"
+	hashC = "0123456789abcdef0123456789abcdef01234567"
+)
+
+func TestIndexRoundTrip(t *testing.T) {
+	mtime := time.Unix(1600000000, 123456789)
+	tests := []struct {
+		name    string
+		entries []Entry
+	}{
+		{"empty", nil},
+		{"single", []Entry{
+			{Path: "README", Mode: "100644", Hash: hashA, Size: 12, MTime: mtime},
+		}},
+		{"modes", []Entry{
+			{Path: "bin/run", Mode: "100755", Hash: hashA, Size: 1, MTime: mtime},
+			{Path: "link", Mode: "120000", Hash: hashB, Size: 7, MTime: mtime},
+			{Path: "vendor/lib", Mode: "160000", Hash: hashC, MTime: time.Unix(0, 0)},
+		}},
+		{"conflict", []Entry{
+			{Path: "a.txt", Mode: "100644", Hash: hashA, Stage: 1, MTime: time.Unix(0, 0)},
+			{Path: "a.txt", Mode: "100644", Hash: hashB, Stage: 2, MTime: time.Unix(0, 0)},
+			{Path: "a.txt", Mode: "100644", Hash: hashC, Stage: 3, MTime: time.Unix(0, 0)},
+		}},
+		{"long path", []Entry{
+			{Path: strings.Repeat("d/", 1000) + "f", Mode: "100644", Hash: hashA, Size: 1 << 40, MTime: mtime},
+		}},
+		{"unicode path", []Entry{
+			{Path: "zażółć/gęślą jaźń", Mode: "100644", Hash: hashB, MTime: mtime},
+		}},
+	}
+	for _, test := range tests {
+		idx := &Index{Entries: test.entries}
+		content, err := idx.serialize()
+		if err != nil {
+			t.Fatalf("%s: serialize: %v", test.name, err)
+		}
+		parsed, err := parseIndex(content)
+		if err != nil {
+			t.Fatalf("%s: parse: %v", test.name, err)
+		}
+		if len(parsed.Entries) != len(test.entries) {
+			t.Fatalf("%s: got %d entries, want %d", test.name, len(parsed.Entries), len(test.entries))
+		}
+		for i, e := range parsed.Entries {
+			want := test.entries[i]
+			if !e.MTime.Equal(want.MTime) {
+				t.Errorf("%s: entry %d mtime is %v, want %v", test.name, i, e.MTime, want.MTime)
+			}
+			e.MTime, want.MTime = time.Time{}, time.Time{}
+			if !reflect.DeepEqual(e, want) {
+				t.Errorf("%s: entry %d is %+v, want %+v", test.name, i, e, want)
+			}
+		}
+	}
+}
+
+func TestIndexSerializeInvalid(t *testing.T) {
+	tests := []struct {
+		name  string
+		entry Entry
+	}{
+		{"bad mode", Entry{Path: "a", Mode: "10064x", Hash: hashA}},
+		{"short hash", Entry{Path: "a", Mode: "100644", Hash: hashA[:39]}},
+		{"non hex hash", Entry{Path: "a", Mode: "100644", Hash: strings.Repeat("z", 40)}},
+		{"path too long", Entry{Path: strings.Repeat("a", 0x10000), Mode: "100644", Hash: hashA}},
+	}
+	for _, test := range tests {
+		idx := &Index{Entries: []Entry{test.entry}}
+		if _, err := idx.serialize(); err == nil {
+			t.Errorf("%s: serialize succeeded", test.name)
+		}
+	}
+}
+
+func TestParseCorruptIndex(t *testing.T) {
+	idx := &Index{Entries: []Entry{
+		{Path: "a.txt", Mode: "100644", Hash: hashA, MTime: time.Unix(1, 0)},
+	}}
+	content, err := idx.serialize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	flipped := append([]byte(nil), content...)
+	flipped[len(indexSignature)+10] ^= 1
+	tests := []struct {
+		name    string
+		content []byte
+	}{
+		{"empty", nil},
+		{"truncated", content[:len(content)-1]},
+		{"flipped bit", flipped},
+	}
+	for _, test := range tests {
+		if _, err := parseIndex(test.content); !errors.Is(err, ErrCorruptIndex) {
+			t.Errorf("%s: got error %v, want %v", test.name, err, ErrCorruptIndex)
+		}
+	}
+}
+
+func paths(idx *Index) []string {
+	var paths []string
+	for _, e := range idx.Entries {
+		paths = append(paths, e.Path)
+	}
+	return paths
+}
+
+func TestAddReplacesFileAndDirectory(t *testing.T) {
+	tests := []struct {
+		name     string
+		existing []string
+		add      string
+		want     []string
+	}{
+		{"new file", []string{"a", "c"}, "b", []string{"a", "b", "c"}},
+		{"same file", []string{"a", "d"}, "d", []string{"a", "d"}},
+		{"file replaced by directory", []string{"a", "d", "e"}, "d/x", []string{"a", "d/x", "e"}},
+		{"file replaced by nested directory", []string{"d"}, "d/x/y", []string{"d/x/y"}},
+		{"directory replaced by file", []string{"a", "d/x", "d/y/z", "d-x", "e"}, "d", []string{"a", "d", "d-x", "e"}},
+		{"similar names are kept", []string{"d-x", "d.txt", "dd/x"}, "d/x", []string{"d-x", "d.txt", "d/x", "dd/x"}},
+	}
+	for _, test := range tests {
+		idx := &Index{}
+		for _, path := range test.existing {
+			idx.Add(Entry{Path: path, Mode: "100644", Hash: hashA})
+		}
+		idx.Add(Entry{Path: test.add, Mode: "100644", Hash: hashB})
+		if got := paths(idx); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: got %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestNewEntriesFromFilesParallelism(t *testing.T) {
+	root := testrepo.Init(t)
+	var paths []string
+	for i := 0; i < 100; i++ {
+		path := fmt.Sprintf("d%d/f%d", i%5, i)
+		if err := os.MkdirAll(filepath.Join(root, filepath.Dir(path)), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(root, path), []byte(strings.Repeat("x", i)), 0644); err != nil {
+			t.Fatal(err)
+		}
+		paths = append(paths, path)
+	}
+	configPath, err := config.ScopePath(config.LocalScope)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var want []byte
+	for _, workers := range []string{"1", "2", "8", "64"} {
+		if err := config.Set(configPath, objects.ParallelismKey, workers); err != nil {
+			t.Fatal(err)
+		}
+		entries, err := NewEntriesFromFiles(root, paths)
+		if err != nil {
+			t.Fatalf("%s workers: %v", workers, err)
+		}
+		idx := &Index{}
+		for _, e := range entries {
+			idx.Add(e)
+		}
+		content, err := idx.serialize()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want == nil {
+			want = content
+		} else if !bytes.Equal(content, want) {
+			t.Errorf("%s workers: index differs from the one of a single worker", workers)
+		}
+	}
+}
+
+func TestWriteLocked(t *testing.T) {
+	root := testrepo.Init(t)
+	idx := &Index{Entries: []Entry{{Path: "a", Mode: "100644", Hash: hashA, MTime: time.Unix(1, 0)}}}
+	if err := idx.Write(); err != nil {
+		t.Fatal(err)
+	}
+	indexPath := filepath.Join(root, ".gggit", indexFileName)
+	lockPath := indexPath + ".lock"
+	if err := os.WriteFile(lockPath, []byte("held by another process"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	idx.Add(Entry{Path: "b", Mode: "100644", Hash: hashB, MTime: time.Unix(1, 0)})
+	if err := idx.Write(); err == nil {
+		t.Fatal("index written while it was locked")
+	}
+	if lock, err := os.ReadFile(lockPath); err != nil || string(lock) != "held by another process" {
+		t.Errorf("lock file of another process changed: %q, %v", lock, err)
+	}
+	read, err := Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := paths(read); !reflect.DeepEqual(got, []string{"a"}) {
+		t.Errorf("locked index changed to %v", got)
+	}
+}
@@ -0,0 +1,42 @@
+// Package testrepo sets up repositories for tests.
+package testrepo
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/antoniszczepanik/gggit/common"
+)
+
+// Make a temporary repository the current one, with no configuration
+// outside of it. Returns the repository root. Everything is restored when
+// the test ends.
+func Init(t testing.TB) string {
+	t.Helper()
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, common.GitDirName, "objects"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+	for _, key := range []string{"GGGIT_CONFIG_SYSTEM", "GGGIT_CONFIG_GLOBAL"} {
+		key := key
+		old, set := os.LookupEnv(key)
+		os.Setenv(key, filepath.Join(dir, "none"))
+		t.Cleanup(func() {
+			if set {
+				os.Setenv(key, old)
+			} else {
+				os.Unsetenv(key)
+			}
+		})
+	}
+	return dir
+}
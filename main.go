@@ -8,12 +8,34 @@ import (
 	"github.com/antoniszczepanik/gggit/common"
 )
 
+// Commands which can be used in git's own repositories, as they do not
+// modify them. Commands that write only in some modes, like config or
+// hash-object, are refused once they try to.
+var readOnlyCommands = map[string]bool{
+	"cat-file":     true,
+	"check-ignore": true,
+	"config":       true,
+	"diff":         true,
+	"fsck":         true,
+	"hash-object":  true,
+	"init":         true,
+	"log":          true,
+	"ls-objects":   true,
+	"ls-tree":      true,
+	"reflog":       true,
+	"rev-parse":    true,
+	"status":       true,
+}
+
 func main() {
 	if len(os.Args) < 2 {
 		common.Usage("You need to specify a gggit command.")
 	}
 	cmd := os.Args[1]
 	args := os.Args[2:]
+	if !readOnlyCommands[cmd] && common.IsForeignRepo() {
+		common.Usage(fmt.Sprintf("%s: %v", cmd, common.ErrReadOnlyRepo))
+	}
 	switch cmd {
 	case "add":
 		cmds.Add(args)
@@ -21,10 +43,20 @@ func main() {
 		cmds.Branch(args)
 	case "cat-file":
 		cmds.Cat(args)
+	case "check-ignore":
+		cmds.CheckIgnore(args)
 	case "checkout":
 		cmds.Checkout(args)
 	case "commit":
 		cmds.Commit(args)
+	case "config":
+		cmds.Config(args)
+	case "diff":
+		cmds.Diff(args)
+	case "fsck":
+		cmds.Fsck(args)
+	case "gc":
+		cmds.Gc(args)
 	case "hash-object":
 		cmds.Hash(args)
 	case "init":
@@ -35,8 +67,22 @@ func main() {
 		cmds.Ls(args)
 	case "ls-objects":
 		cmds.LsObjects(args)
+	case "merge":
+		cmds.Merge(args)
+	case "repack":
+		cmds.Repack(args)
+	case "prune":
+		cmds.Prune(args)
+	case "reflog":
+		cmds.Reflog(args)
+	case "rev-parse":
+		cmds.RevParse(args)
+	case "rm":
+		cmds.Rm(args)
 	case "status":
 		cmds.Status(args)
+	case "tag":
+		cmds.Tag(args)
 	default:
 		common.Usage(fmt.Sprintf("Command %v is not available. Did you mean sth else?\n", cmd))
 	}
@@ -0,0 +1,108 @@
+package merge
+
+import (
+	"errors"
+
+	"github.com/antoniszczepanik/gggit/objects"
+)
+
+var ErrNoMergeBase = errors.New("commits do not have a common ancestor")
+
+// Find the best common ancestor of two commits, that is a common ancestor
+// which is not an ancestor of any other common ancestor. If there are more
+// such commits, the most recent one is returned.
+func MergeBase(a, b string) (string, error) {
+	ancestorsOfA, err := ancestors(a)
+	if err != nil {
+		return "", err
+	}
+	// Walk history of b, stopping at commits that are reachable from a.
+	var candidates []string
+	visited := make(map[string]bool)
+	queue := []string{b}
+	for len(queue) > 0 {
+		hash := queue[0]
+		queue = queue[1:]
+		if visited[hash] {
+			continue
+		}
+		visited[hash] = true
+		if ancestorsOfA[hash] {
+			candidates = append(candidates, hash)
+			continue
+		}
+		c, err := objects.ReadCommit(hash)
+		if err != nil {
+			return "", err
+		}
+		queue = append(queue, c.Parents...)
+	}
+
+	var best []string
+	for _, candidate := range candidates {
+		redundant := false
+		for _, other := range candidates {
+			if other == candidate {
+				continue
+			}
+			if ok, err := IsAncestor(candidate, other); err != nil {
+				return "", err
+			} else if ok {
+				redundant = true
+				break
+			}
+		}
+		if !redundant {
+			best = append(best, candidate)
+		}
+	}
+	if len(best) == 0 {
+		return "", ErrNoMergeBase
+	}
+	return mostRecent(best)
+}
+
+// Check whether ancestor is reachable from commit. Every commit is its own
+// ancestor.
+func IsAncestor(ancestor, commit string) (bool, error) {
+	reachable, err := ancestors(commit)
+	if err != nil {
+		return false, err
+	}
+	return reachable[ancestor], nil
+}
+
+// Collect all commits reachable from a commit, including the commit itself.
+func ancestors(hash string) (map[string]bool, error) {
+	reachable := make(map[string]bool)
+	stack := []string{hash}
+	for len(stack) > 0 {
+		hash := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if reachable[hash] {
+			continue
+		}
+		reachable[hash] = true
+		c, err := objects.ReadCommit(hash)
+		if err != nil {
+			return nil, err
+		}
+		stack = append(stack, c.Parents...)
+	}
+	return reachable, nil
+}
+
+func mostRecent(hashes []string) (string, error) {
+	var best string
+	var bestCommit objects.Commit
+	for _, hash := range hashes {
+		c, err := objects.ReadCommit(hash)
+		if err != nil {
+			return "", err
+		}
+		if best == "" || c.CommitTime.After(bestCommit.CommitTime) {
+			best, bestCommit = hash, c
+		}
+	}
+	return best, nil
+}
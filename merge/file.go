@@ -0,0 +1,114 @@
+package merge
+
+import (
+	"strings"
+
+	"github.com/antoniszczepanik/gggit/diff"
+)
+
+const markerSize = 7
+
+// Merge changes made to base text on two sides, line by line. Regions
+// changed differently on both sides are conflicts; both versions are put in
+// the result between conflict markers labeled with ourLabel and theirLabel.
+// Returns the merged text and whether there were any conflicts.
+func MergeText(base, ours, theirs, ourLabel, theirLabel string) (string, bool) {
+	baseLines := diff.Lines(base)
+	ourLines := diff.Lines(ours)
+	theirLines := diff.Lines(theirs)
+	ourMatches := matchLines(baseLines, ourLines)
+	theirMatches := matchLines(baseLines, theirLines)
+
+	var result strings.Builder
+	conflicted := false
+	i, o, t := 0, 0, 0
+	for {
+		// Lines unchanged on both sides go straight to the result.
+		if i < len(baseLines) && ourMatches[i] == o && theirMatches[i] == t {
+			result.WriteString(baseLines[i])
+			i, o, t = i+1, o+1, t+1
+			continue
+		}
+		// Find the next base line that is kept on both sides. Everything
+		// before it is a chunk changed on at least one of the sides.
+		j := i
+		for j < len(baseLines) && (ourMatches[j] == -1 || theirMatches[j] == -1) {
+			j++
+		}
+		nextO, nextT := len(ourLines), len(theirLines)
+		if j < len(baseLines) {
+			nextO, nextT = ourMatches[j], theirMatches[j]
+		}
+		baseChunk := baseLines[i:j]
+		ourChunk := ourLines[o:nextO]
+		theirChunk := theirLines[t:nextT]
+		switch {
+		case equalLines(ourChunk, baseChunk):
+			writeLines(&result, theirChunk)
+		case equalLines(theirChunk, baseChunk), equalLines(ourChunk, theirChunk):
+			writeLines(&result, ourChunk)
+		default:
+			conflicted = true
+			writeConflict(&result, ourChunk, theirChunk, ourLabel, theirLabel)
+		}
+		if j == len(baseLines) {
+			break
+		}
+		i, o, t = j, nextO, nextT
+	}
+	return result.String(), conflicted
+}
+
+// For every line of base find the position of the same line in other text,
+// or -1 if the line was removed or changed.
+func matchLines(base, other []string) []int {
+	matches := make([]int, len(base))
+	for i := range matches {
+		matches[i] = -1
+	}
+	// Nothing to match against, e.g. for files added on both sides.
+	if len(base) == 0 || len(other) == 0 {
+		return matches
+	}
+	for _, e := range diff.Myers(base, other) {
+		if e.Op == diff.Equal {
+			matches[e.OldLine] = e.NewLine
+		}
+	}
+	return matches
+}
+
+func equalLines(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func writeLines(b *strings.Builder, lines []string) {
+	for _, line := range lines {
+		b.WriteString(line)
+	}
+}
+
+func writeConflict(b *strings.Builder, ours, theirs []string, ourLabel, theirLabel string) {
+	b.WriteString(strings.Repeat("<", markerSize) + " " + ourLabel + "\n")
+	writeTerminatedLines(b, ours)
+	b.WriteString(strings.Repeat("=", markerSize) + "\n")
+	writeTerminatedLines(b, theirs)
+	b.WriteString(strings.Repeat(">", markerSize) + " " + theirLabel + "\n")
+}
+
+// Write lines making sure that the last one ends with a line feed, so that
+// a conflict marker following it starts on its own line.
+func writeTerminatedLines(b *strings.Builder, lines []string) {
+	writeLines(b, lines)
+	if len(lines) > 0 && !strings.HasSuffix(lines[len(lines)-1], "\n") {
+		b.WriteString("\n")
+	}
+}
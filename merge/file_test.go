@@ -0,0 +1,33 @@
+package merge
+
+import "testing"
+
+func TestMergeText(t *testing.T) {
+	tests := []struct {
+		name               string
+		base, ours, theirs string
+		want               string
+		wantConflicted     bool
+	}{
+		{"all empty", "", "", "", "", false},
+		{"added on their side only", "", "", "x\n", "x\n", false},
+		{"added on our side only", "", "x\n", "", "x\n", false},
+		{"same addition", "", "x\n", "x\n", "x\n", false},
+		{"different additions", "", "x\n", "y\n", "<<<<<<< ours\nx\n=======\ny\n>>>>>>> theirs\n", true},
+		{"emptied on our side", "a\n", "", "a\n", "", false},
+		{"emptied on one side, changed on the other", "a\n", "", "b\n", "<<<<<<< ours\n=======\nb\n>>>>>>> theirs\n", true},
+		{"changes in different places", "a\nb\nc\nd\ne\n", "A\nb\nc\nd\ne\n", "a\nb\nc\nd\nE\n", "A\nb\nc\nd\nE\n", false},
+		{"same change", "a\nb\nc\n", "a\nB\nc\n", "a\nB\nc\n", "a\nB\nc\n", false},
+		{"conflicting changes", "a\nb\nc\n", "a\nB\nc\n", "a\nX\nc\n", "a\n<<<<<<< ours\nB\n=======\nX\n>>>>>>> theirs\nc\n", true},
+		{"no final line feed in conflict", "a\n", "b", "c", "<<<<<<< ours\nb\n=======\nc\n>>>>>>> theirs\n", true},
+		{"deleted and kept", "a\nb\nc\n", "a\nc\n", "a\nb\nc\nd\n", "a\nc\nd\n", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, conflicted := MergeText(tt.base, tt.ours, tt.theirs, "ours", "theirs")
+			if got != tt.want || conflicted != tt.wantConflicted {
+				t.Errorf("MergeText(%q, %q, %q) = %q, %v, want %q, %v", tt.base, tt.ours, tt.theirs, got, conflicted, tt.want, tt.wantConflicted)
+			}
+		})
+	}
+}
@@ -0,0 +1,230 @@
+package merge
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/antoniszczepanik/gggit/diff"
+	"github.com/antoniszczepanik/gggit/objects"
+)
+
+type ConflictKind string
+
+const (
+	ContentConflict      ConflictKind = "content"
+	AddAddConflict       ConflictKind = "add/add"
+	ModifyDeleteConflict ConflictKind = "modify/delete"
+	ModeConflict         ConflictKind = "mode"
+	// A file on one side and a directory on the other.
+	FileDirectoryConflict ConflictKind = "file/directory"
+)
+
+// A path that could not be merged automatically. Missing versions are nil.
+type Conflict struct {
+	Path   string
+	Kind   ConflictKind
+	Base   *objects.TreeEntry
+	Ours   *objects.TreeEntry
+	Theirs *objects.TreeEntry
+	// Content that should be put in working directory, with conflict
+	// markers for conflicting regions of text files.
+	Content string
+	// Path content is written to. It differs from Path for file/directory
+	// conflicts, where the directory takes the place of the file.
+	WorkPath string
+}
+
+type Result struct {
+	// Cleanly merged files keyed by slash separated paths.
+	Entries   map[string]objects.TreeEntry
+	Conflicts []Conflict
+}
+
+// Merge two flattened trees with a common ancestor. Blobs of cleanly merged
+// files are written to the object database.
+func MergeTrees(base, ours, theirs map[string]objects.TreeEntry, ourLabel, theirLabel string) (*Result, error) {
+	paths := make(map[string]bool)
+	for _, tree := range []map[string]objects.TreeEntry{base, ours, theirs} {
+		for path := range tree {
+			paths[path] = true
+		}
+	}
+	result := &Result{Entries: make(map[string]objects.TreeEntry)}
+	for path := range paths {
+		b, o, t := lookup(base, path), lookup(ours, path), lookup(theirs, path)
+		switch {
+		case sameEntry(o, t), sameEntry(b, t):
+			if o != nil {
+				result.Entries[path] = *o
+			}
+		case sameEntry(b, o):
+			if t != nil {
+				result.Entries[path] = *t
+			}
+		case o == nil || t == nil:
+			c := Conflict{Path: path, Kind: ModifyDeleteConflict, Base: b, Ours: o, Theirs: t}
+			modified := o
+			if modified == nil {
+				modified = t
+			}
+			content, err := diff.EntryContent(*modified)
+			if err != nil {
+				return nil, err
+			}
+			c.Content = content
+			result.Conflicts = append(result.Conflicts, c)
+		default:
+			merged, conflict, err := mergeEntries(path, b, *o, *t, ourLabel, theirLabel)
+			if err != nil {
+				return nil, err
+			}
+			if conflict != nil {
+				result.Conflicts = append(result.Conflicts, *conflict)
+			} else {
+				result.Entries[path] = merged
+			}
+		}
+	}
+	if err := markFileDirectoryConflicts(result, base, ours, theirs, ourLabel, theirLabel); err != nil {
+		return nil, err
+	}
+	sort.Slice(result.Conflicts, func(i, j int) bool {
+		return result.Conflicts[i].Path < result.Conflicts[j].Path
+	})
+	return result, nil
+}
+
+// Turn merged files that are also directories of other merged paths into
+// file/directory conflicts. Like git, their content is left next to the
+// directory, named after the side the file comes from.
+func markFileDirectoryConflicts(result *Result, base, ours, theirs map[string]objects.TreeEntry, ourLabel, theirLabel string) error {
+	dirs := make(map[string]bool)
+	addDirs := func(path string) {
+		for i := strings.LastIndex(path, "/"); i != -1; i = strings.LastIndex(path, "/") {
+			path = path[:i]
+			dirs[path] = true
+		}
+	}
+	for path := range result.Entries {
+		addDirs(path)
+	}
+	for _, c := range result.Conflicts {
+		addDirs(c.Path)
+	}
+	workPath := func(path string, ours *objects.TreeEntry) string {
+		label := theirLabel
+		if ours != nil {
+			label = ourLabel
+		}
+		return path + "~" + strings.ReplaceAll(label, "/", "_")
+	}
+	for path, e := range result.Entries {
+		if !dirs[path] {
+			continue
+		}
+		content, err := diff.EntryContent(e)
+		if err != nil {
+			return err
+		}
+		o := lookup(ours, path)
+		result.Conflicts = append(result.Conflicts, Conflict{
+			Path:     path,
+			Kind:     FileDirectoryConflict,
+			Base:     lookup(base, path),
+			Ours:     o,
+			Theirs:   lookup(theirs, path),
+			Content:  content,
+			WorkPath: workPath(path, o),
+		})
+		delete(result.Entries, path)
+	}
+	for i := range result.Conflicts {
+		c := &result.Conflicts[i]
+		switch {
+		case c.WorkPath != "":
+		case dirs[c.Path]:
+			c.Kind, c.WorkPath = FileDirectoryConflict, workPath(c.Path, c.Ours)
+		default:
+			c.WorkPath = c.Path
+		}
+	}
+	return nil
+}
+
+// Merge two versions of a file changed on both sides.
+func mergeEntries(path string, b *objects.TreeEntry, o, t objects.TreeEntry, ourLabel, theirLabel string) (objects.TreeEntry, *Conflict, error) {
+	conflict := &Conflict{Path: path, Kind: ContentConflict, Base: b, Ours: &o, Theirs: &t}
+	if b == nil {
+		conflict.Kind = AddAddConflict
+	}
+	mode, modeOk := mergeModes(b, o, t)
+	ourContent, err := diff.EntryContent(o)
+	if err != nil {
+		return objects.TreeEntry{}, nil, err
+	}
+	if o.Hash == t.Hash {
+		if !modeOk {
+			conflict.Kind = ModeConflict
+			conflict.Content = ourContent
+			return objects.TreeEntry{}, conflict, nil
+		}
+		return objects.TreeEntry{Mode: mode, Hash: o.Hash, Name: o.Name}, nil, nil
+	}
+
+	theirContent, err := diff.EntryContent(t)
+	if err != nil {
+		return objects.TreeEntry{}, nil, err
+	}
+	baseContent := ""
+	if b != nil {
+		if baseContent, err = diff.EntryContent(*b); err != nil {
+			return objects.TreeEntry{}, nil, err
+		}
+	}
+	// Binary files cannot be merged, ours are kept in working directory.
+	if diff.IsBinary(baseContent) || diff.IsBinary(ourContent) || diff.IsBinary(theirContent) {
+		conflict.Content = ourContent
+		return objects.TreeEntry{}, conflict, nil
+	}
+	merged, conflicted := MergeText(baseContent, ourContent, theirContent, ourLabel, theirLabel)
+	if conflicted || !modeOk {
+		conflict.Content = merged
+		return objects.TreeEntry{}, conflict, nil
+	}
+	blob := objects.NewBlob(merged)
+	if err := blob.Write(); err != nil {
+		return objects.TreeEntry{}, nil, err
+	}
+	e, err := objects.NewTreeEntry(mode, o.Name, blob)
+	return e, nil, err
+}
+
+// Pick the mode changed on one of the sides. Returns false if it was changed
+// differently on both sides.
+func mergeModes(b *objects.TreeEntry, o, t objects.TreeEntry) (string, bool) {
+	switch {
+	case o.Mode == t.Mode:
+		return o.Mode, true
+	case b != nil && b.Mode == o.Mode:
+		return t.Mode, true
+	case b != nil && b.Mode == t.Mode:
+		return o.Mode, true
+	}
+	return o.Mode, false
+}
+
+func lookup(tree map[string]objects.TreeEntry, path string) *objects.TreeEntry {
+	e, ok := tree[path]
+	if !ok {
+		return nil
+	}
+	return &e
+}
+
+// Compare two possibly missing entries.
+func sameEntry(a, b *objects.TreeEntry) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	return a.Mode == b.Mode && a.Hash == b.Hash
+}
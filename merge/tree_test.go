@@ -0,0 +1,136 @@
+package merge
+
+import (
+	"testing"
+
+	"github.com/antoniszczepanik/gggit/internal/testrepo"
+	"github.com/antoniszczepanik/gggit/objects"
+)
+
+func blobEntry(t *testing.T, name, content string) objects.TreeEntry {
+	t.Helper()
+	e, err := objects.NewTreeEntry(objects.ModeRegular, name, objects.NewBlob(content))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return e
+}
+
+func TestMergeTreesAddAdd(t *testing.T) {
+	testrepo.Init(t)
+	tests := []struct {
+		name         string
+		ours, theirs string
+		want         string
+		wantConflict bool
+	}{
+		{"empty on our side", "", "x\n", "x\n", false},
+		{"empty on their side", "x\n", "", "x\n", false},
+		{"same content", "x\n", "x\n", "x\n", false},
+		{"different content", "x\n", "y\n", "<<<<<<< ours\nx\n=======\ny\n>>>>>>> theirs\n", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			base := map[string]objects.TreeEntry{"a": blobEntry(t, "a", "a\n")}
+			ours := map[string]objects.TreeEntry{"a": base["a"], "e": blobEntry(t, "e", tt.ours)}
+			theirs := map[string]objects.TreeEntry{"a": base["a"], "e": blobEntry(t, "e", tt.theirs)}
+			result, err := MergeTrees(base, ours, theirs, "ours", "theirs")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.wantConflict {
+				if len(result.Conflicts) != 1 {
+					t.Fatalf("got conflicts %v, want one", result.Conflicts)
+				}
+				c := result.Conflicts[0]
+				if c.Path != "e" || c.Kind != AddAddConflict || c.Content != tt.want {
+					t.Errorf("got conflict at %s of kind %s with %q, want add/add at e with %q", c.Path, c.Kind, c.Content, tt.want)
+				}
+				return
+			}
+			if len(result.Conflicts) != 0 {
+				t.Fatalf("got conflicts %v, want none", result.Conflicts)
+			}
+			want := blobEntry(t, "e", tt.want)
+			if got := result.Entries["e"]; got.Hash != want.Hash || got.Mode != want.Mode {
+				t.Errorf("got entry %s %s, want %s %s", got.Mode, got.Hash, want.Mode, want.Hash)
+			}
+			if err := objects.Exists(want.Hash); err != nil && tt.ours != tt.theirs {
+				t.Errorf("merged blob was not written: %v", err)
+			}
+		})
+	}
+}
+
+func TestMergeTreesFileDirectory(t *testing.T) {
+	testrepo.Init(t)
+	file := blobEntry(t, "d", "file\n")
+	nested := blobEntry(t, "x", "x\n")
+	tests := []struct {
+		name         string
+		base         map[string]objects.TreeEntry
+		ours, theirs map[string]objects.TreeEntry
+		wantWorkPath string
+		wantOurs     bool
+	}{
+		{
+			name:         "file added by us",
+			ours:         map[string]objects.TreeEntry{"d": file},
+			theirs:       map[string]objects.TreeEntry{"d/x": nested},
+			wantWorkPath: "d~ours",
+			wantOurs:     true,
+		},
+		{
+			name:         "file added by them",
+			ours:         map[string]objects.TreeEntry{"d/x": nested},
+			theirs:       map[string]objects.TreeEntry{"d": file},
+			wantWorkPath: "d~feature_x",
+		},
+		{
+			name:         "file modified by us, replaced by a directory by them",
+			base:         map[string]objects.TreeEntry{"d": blobEntry(t, "d", "old\n")},
+			ours:         map[string]objects.TreeEntry{"d": file},
+			theirs:       map[string]objects.TreeEntry{"d/x": nested},
+			wantWorkPath: "d~ours",
+			wantOurs:     true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := MergeTrees(tt.base, tt.ours, tt.theirs, "ours", "feature/x")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(result.Conflicts) != 1 {
+				t.Fatalf("got conflicts %v, want one", result.Conflicts)
+			}
+			c := result.Conflicts[0]
+			if c.Path != "d" || c.Kind != FileDirectoryConflict || c.WorkPath != tt.wantWorkPath || c.Content != "file\n" {
+				t.Errorf("got %s conflict at %s written to %s with %q, want file/directory at d written to %s",
+					c.Kind, c.Path, c.WorkPath, c.Content, tt.wantWorkPath)
+			}
+			if (c.Ours != nil) != tt.wantOurs || (c.Theirs != nil) == tt.wantOurs {
+				t.Errorf("file is staged on the wrong side")
+			}
+			if _, ok := result.Entries["d"]; ok {
+				t.Errorf("file d is merged cleanly")
+			}
+			if got := result.Entries["d/x"]; got.Hash != nested.Hash {
+				t.Errorf("d/x is merged as %s, want %s", got.Hash, nested.Hash)
+			}
+		})
+	}
+}
+
+func TestMergeTreesWorkPath(t *testing.T) {
+	testrepo.Init(t)
+	base := map[string]objects.TreeEntry{"a": blobEntry(t, "a", "a\n")}
+	ours := map[string]objects.TreeEntry{"a": blobEntry(t, "a", "ours\n")}
+	result, err := MergeTrees(base, ours, nil, "ours", "theirs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Conflicts) != 1 || result.Conflicts[0].WorkPath != "a" {
+		t.Errorf("got conflicts %v, want a modify/delete one written to a", result.Conflicts)
+	}
+}
@@ -1,13 +1,30 @@
 package objects
 
 import (
+	"io"
 	"os"
+	"strings"
 )
 
 const BlobObject ObjectType = "blob"
 
+// Blob content is held in memory only when it is given explicitly. Blobs of
+// files and stored blobs are read lazily, and can be streamed with Open, so
+// that large files never have to fit in memory.
 type Blob struct {
 	content string
+	// Path of a file the content is read from.
+	path string
+	// Hash of a stored blob the content is read from.
+	hash string
+}
+
+// Object whose content can be streamed rather than held in memory.
+type StreamObject interface {
+	Object
+	// Open content for reading, together with its size. Caller is
+	// responsible for closing it.
+	Open() (io.ReadCloser, int64, error)
 }
 
 func NewBlob(content string) Blob {
@@ -15,6 +32,14 @@ func NewBlob(content string) Blob {
 }
 
 func NewBlobFromFile(filepath string) (Blob, error) {
+	fi, err := os.Stat(filepath)
+	if err != nil {
+		return Blob{}, err
+	}
+	if fi.Mode().IsRegular() {
+		return Blob{path: filepath}, nil
+	}
+	// Size of pipes and the like is not known upfront.
 	content, err := os.ReadFile(filepath)
 	if err != nil {
 		return Blob{}, err
@@ -22,8 +47,66 @@ func NewBlobFromFile(filepath string) (Blob, error) {
 	return NewBlob(string(content)), nil
 }
 
+// Create a blob for a file as it is stored in trees. Symlinks are not
+// followed, their blobs contain the path they point at.
+func NewBlobFromPath(path string, fi os.FileInfo) (Blob, error) {
+	if fi.Mode()&os.ModeSymlink != 0 {
+		target, err := os.Readlink(path)
+		if err != nil {
+			return Blob{}, err
+		}
+		return NewBlob(target), nil
+	}
+	return NewBlobFromFile(path)
+}
+
+// Read the whole content into memory. Prefer Open for blobs which might be
+// large.
 func (b Blob) GetContent() (string, error) {
-	return b.content, nil
+	if b.path == "" && b.hash == "" {
+		return b.content, nil
+	}
+	r, _, err := b.Open()
+	if err != nil {
+		return "", err
+	}
+	defer r.Close()
+	var sb strings.Builder
+	if _, err := io.Copy(&sb, r); err != nil {
+		return "", err
+	}
+	return sb.String(), nil
+}
+
+func (b Blob) Open() (io.ReadCloser, int64, error) {
+	switch {
+	case b.path != "":
+		f, err := os.Open(b.path)
+		if err != nil {
+			return nil, 0, err
+		}
+		// Size is taken from the open file, so that it matches content
+		// read from it unless the file is modified meanwhile.
+		fi, err := f.Stat()
+		if err != nil {
+			f.Close()
+			return nil, 0, err
+		}
+		return f, fi.Size(), nil
+	case b.hash != "":
+		_, size, r, err := Open(b.hash)
+		return r, size, err
+	}
+	return io.NopCloser(strings.NewReader(b.content)), int64(len(b.content)), nil
+}
+
+// Get size of the content, without reading it.
+func (b Blob) Size() (int64, error) {
+	r, size, err := b.Open()
+	if err != nil {
+		return 0, err
+	}
+	return size, r.Close()
 }
 
 func (b Blob) GetType() ObjectType {
@@ -1,33 +1,50 @@
 package objects
 
 import (
+	"errors"
 	"fmt"
 	"strings"
 	"time"
+
 	"github.com/antoniszczepanik/gggit/common"
+	"github.com/antoniszczepanik/gggit/config"
 )
 
 const CommitObject ObjectType = "commit"
 
 type Commit struct {
-	TreeHash   string
-	ParentHash string
-	Author     common.Author
-	Time       time.Time
+	TreeHash string
+	// Hashes of parent commits. Root commits have none, merge commits have
+	// more than one.
+	Parents []string
+	Author  common.Author
+	// Time the change was authored at, in author's time zone.
+	Time      time.Time
+	Committer common.Author
+	// Time the commit was created at, in committer's time zone.
+	CommitTime time.Time
 	Msg        string
 }
 
 func (c Commit) GetContent() (string, error) {
 	content := fmt.Sprintf("tree %s\n", c.TreeHash)
-	if c.ParentHash != "" {
-		content += fmt.Sprintf("parent %s\n", c.ParentHash)
+	for _, parent := range c.Parents {
+		content += fmt.Sprintf("parent %s\n", parent)
 	}
-	content += fmt.Sprintf(
-		"author %s <%s> %s\n\n", c.Author.Name, c.Author.Email, c.Time.Format(time.RFC822Z))
+	content += fmt.Sprintf("author %s\n", formatAuthor(c.Author, c.Time))
+	content += fmt.Sprintf("committer %s\n\n", formatAuthor(c.Committer, c.CommitTime))
 	content += fmt.Sprintf("%s\n", c.Msg)
 	return content, nil
 }
 
+// Get hash of the first parent, or an empty string for root commits.
+func (c Commit) FirstParent() string {
+	if len(c.Parents) == 0 {
+		return ""
+	}
+	return c.Parents[0]
+}
+
 func (c Commit) GetType() ObjectType {
 	return CommitObject
 }
@@ -51,78 +68,103 @@ func ReadCommit(hash string) (Commit, error) {
 	return parseCommit(content)
 }
 
+// Parse commit content. Headers end at the first empty line, everything
+// after it is the message, so that parsing is the exact inverse of
+// GetContent.
 func parseCommit(content string) (Commit, error) {
 	var (
-		tree, parent, message string
-		author                common.Author
-		err                   error
-		t                     time.Time
+		c   Commit
+		err error
 	)
-	lines := strings.Split(content, "\n")
-	isMessage := false
-	for _, line := range lines {
-		if line == "" {
-			isMessage = true
-			continue
+	headers, message := content, ""
+	if i := strings.Index(content, "\n\n"); i != -1 {
+		headers, message = content[:i], content[i+2:]
+	}
+	for _, line := range strings.Split(headers, "\n") {
+		values := strings.SplitN(line, " ", 2)
+		if len(values) != 2 {
+			return Commit{}, fmt.Errorf("malformed commit header %q", line)
 		}
-		if !isMessage {
-			values := strings.SplitN(line, " ", 2)
-			if len(values) == 2 {
-				switch values[0] {
-				case "tree":
-					tree = values[1]
-				case "parent":
-					parent = values[1]
-				case "author":
-					author, t, err = parseAuthor(values[1])
-					if err != nil {
-						return Commit{}, err
-					}
-				}
+		switch values[0] {
+		case "tree":
+			c.TreeHash = values[1]
+		case "parent":
+			if len(values[1]) != 40 {
+				return Commit{}, fmt.Errorf("malformed parent hash %q", values[1])
+			}
+			c.Parents = append(c.Parents, values[1])
+		case "author":
+			c.Author, c.Time, err = parseAuthor(values[1])
+			if err != nil {
+				return Commit{}, err
+			}
+		case "committer":
+			c.Committer, c.CommitTime, err = parseAuthor(values[1])
+			if err != nil {
+				return Commit{}, err
 			}
-		} else {
-			message += line
 		}
 	}
-	return Commit{
-		TreeHash:   tree,
-		ParentHash: parent,
-		Author:     author,
-		Time:       t,
-		Msg:        message,
-	}, nil
+	if c.TreeHash == "" {
+		return Commit{}, errors.New("commit does not point at a tree")
+	}
+	// Commits created before committer was recorded separately.
+	if c.Committer == (common.Author{}) {
+		c.Committer, c.CommitTime = c.Author, c.Time
+	}
+	c.Msg = strings.TrimSuffix(message, "\n")
+	return c, nil
+}
+
+// Format identity and time as "Name <email> <unix seconds> <+hhmm>".
+func formatAuthor(a common.Author, t time.Time) string {
+	return fmt.Sprintf("%s <%s> %s", a.Name, a.Email, common.FormatTimestamp(t))
 }
 
+// Parse an author or committer line value. Time is expected to be unix
+// seconds followed by time zone offset. Older commits recorded it in RFC 822
+// format, which is still accepted.
 func parseAuthor(value string) (common.Author, time.Time, error) {
-	email_start := strings.Index(value, "<")
-	email_end := strings.Index(value, ">")
-	if email_start == -1 || email_end == -1 || email_end < email_start {
+	emailStart := strings.Index(value, "<")
+	emailEnd := strings.LastIndex(value, ">")
+	if emailStart == -1 || emailEnd == -1 || emailEnd < emailStart {
 		return common.Author{}, time.Time{}, fmt.Errorf("did not find email delims (<>) in %s", value)
 	}
 
-	name := strings.Trim(value[:email_start], " ")
-	email := value[email_start+1 : email_end]
+	name := strings.Trim(value[:emailStart], " ")
+	email := value[emailStart+1 : emailEnd]
+	date := strings.TrimSpace(value[emailEnd+1:])
 
-	t, err := time.Parse(time.RFC822Z, value[email_end+2:])
+	var t time.Time
+	var err error
+	if fields := strings.Fields(date); len(fields) == 2 {
+		t, err = common.ParseTimestamp(fields[0], fields[1])
+	} else {
+		t, err = time.Parse(time.RFC822Z, date)
+	}
 	if err != nil {
 		return common.Author{}, time.Time{}, fmt.Errorf("could not parse time: %w", err)
 	}
 	return common.Author{Name: name, Email: email}, t, nil
 }
 
-func CreateCommitObject(treeHash string, parentHash string, message string) (Commit, error) {
-	author, err := common.GetAuthorFromConfig()
+func CreateCommitObject(treeHash string, parents []string, message string) (Commit, error) {
+	now := time.Now().Truncate(time.Second)
+	author, authorTime, err := config.GetIdentity(common.AuthorRole, now)
 	if err != nil {
 		return Commit{}, err
 	}
+	committer, commitTime, err := config.GetIdentity(common.CommitterRole, now)
 	if err != nil {
 		return Commit{}, err
 	}
 	return Commit{
 		TreeHash:   treeHash,
-		ParentHash: parentHash,
+		Parents:    parents,
 		Author:     author,
-		Time:       time.Now(),
+		Time:       authorTime,
+		Committer:  committer,
+		CommitTime: commitTime,
 		Msg:        message,
 	}, nil
 }
@@ -0,0 +1,183 @@
+package objects
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+// Deltas consist of sizes of the base and of the result, as little endian
+// base-128 varints, followed by instructions. An instruction with the
+// highest bit set copies a range of the base: bits 0-3 tell which of 4
+// offset bytes follow, bits 4-6 which of 3 size bytes do, and zero size means
+// 0x10000. Any other non-zero instruction inserts as many following bytes.
+const (
+	// Length of blocks of the base looked up when creating a delta.
+	deltaBlockSize = 16
+	maxDeltaCopy   = 0x10000
+	maxDeltaInsert = 0x7f
+)
+
+var errCorruptDelta = errors.New("corrupt delta")
+
+// Apply a delta to its base.
+func applyDelta(base, delta []byte) ([]byte, error) {
+	r := bytes.NewReader(delta)
+	baseSize, err := binary.ReadUvarint(r)
+	if err != nil || baseSize != uint64(len(base)) {
+		return nil, errCorruptDelta
+	}
+	resultSize, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, errCorruptDelta
+	}
+	result := make([]byte, 0, resultSize)
+	for r.Len() > 0 {
+		op, _ := r.ReadByte()
+		switch {
+		case op&0x80 != 0:
+			var offset, size uint64
+			for i := 0; i < 7; i++ {
+				if op&(1<<i) == 0 {
+					continue
+				}
+				b, err := r.ReadByte()
+				if err != nil {
+					return nil, errCorruptDelta
+				}
+				if i < 4 {
+					offset |= uint64(b) << (8 * i)
+				} else {
+					size |= uint64(b) << (8 * (i - 4))
+				}
+			}
+			if size == 0 {
+				size = 0x10000
+			}
+			if offset+size > uint64(len(base)) {
+				return nil, errCorruptDelta
+			}
+			result = append(result, base[offset:offset+size]...)
+		case op != 0:
+			data := make([]byte, op)
+			if _, err := io.ReadFull(r, data); err != nil {
+				return nil, errCorruptDelta
+			}
+			result = append(result, data...)
+		default:
+			return nil, errCorruptDelta
+		}
+	}
+	if uint64(len(result)) != resultSize {
+		return nil, errCorruptDelta
+	}
+	return result, nil
+}
+
+// Index of blocks of a delta base, created once to compute deltas against
+// many targets.
+type deltaIndex struct {
+	base []byte
+	// Offset of the first occurrence of every aligned block.
+	blocks map[string]int
+}
+
+func newDeltaIndex(base []byte) *deltaIndex {
+	di := &deltaIndex{base: base, blocks: make(map[string]int, len(base)/deltaBlockSize)}
+	for i := 0; i+deltaBlockSize <= len(base); i += deltaBlockSize {
+		block := string(base[i : i+deltaBlockSize])
+		if _, ok := di.blocks[block]; !ok {
+			di.blocks[block] = i
+		}
+	}
+	return di
+}
+
+// Create a delta turning the base into target. Returns nil if the delta
+// would not be shorter than limit.
+func (di *deltaIndex) delta(target []byte, limit int) []byte {
+	var out bytes.Buffer
+	writeUvarint(&out, uint64(len(di.base)))
+	writeUvarint(&out, uint64(len(target)))
+	var insert []byte
+	for i := 0; i < len(target); {
+		if out.Len()+len(insert) >= limit {
+			return nil
+		}
+		offset, ok := -1, false
+		if i+deltaBlockSize <= len(target) {
+			offset, ok = di.blocks[string(target[i:i+deltaBlockSize])]
+		}
+		if !ok {
+			insert = append(insert, target[i])
+			i++
+			continue
+		}
+		// Extend the match forwards, and backwards over pending inserts.
+		start, n := i, deltaBlockSize
+		for offset+n < len(di.base) && start+n < len(target) && di.base[offset+n] == target[start+n] {
+			n++
+		}
+		for len(insert) > 0 && offset > 0 && di.base[offset-1] == insert[len(insert)-1] {
+			insert = insert[:len(insert)-1]
+			offset--
+			start--
+			n++
+		}
+		writeInserts(&out, insert)
+		insert = insert[:0]
+		writeCopies(&out, offset, n)
+		i = start + n
+	}
+	writeInserts(&out, insert)
+	if out.Len() >= limit {
+		return nil
+	}
+	return out.Bytes()
+}
+
+func writeUvarint(w *bytes.Buffer, v uint64) {
+	buf := make([]byte, binary.MaxVarintLen64)
+	w.Write(buf[:binary.PutUvarint(buf, v)])
+}
+
+func writeInserts(w *bytes.Buffer, data []byte) {
+	for len(data) > 0 {
+		n := len(data)
+		if n > maxDeltaInsert {
+			n = maxDeltaInsert
+		}
+		w.WriteByte(byte(n))
+		w.Write(data[:n])
+		data = data[n:]
+	}
+}
+
+func writeCopies(w *bytes.Buffer, offset, size int) {
+	for size > 0 {
+		n := size
+		if n > maxDeltaCopy {
+			n = maxDeltaCopy
+		}
+		op := byte(0x80)
+		var args []byte
+		for i := 0; i < 4; i++ {
+			if b := byte(offset >> (8 * i)); b != 0 {
+				op |= 1 << i
+				args = append(args, b)
+			}
+		}
+		// Copies of 0x10000 bytes are encoded as zero size.
+		for i := 0; i < 3 && n != maxDeltaCopy; i++ {
+			if b := byte(n >> (8 * i)); b != 0 {
+				op |= 1 << (4 + i)
+				args = append(args, b)
+			}
+		}
+		w.WriteByte(op)
+		w.Write(args)
+		offset += n
+		size -= n
+	}
+}
@@ -0,0 +1,111 @@
+package objects
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+)
+
+// Lines of text, different enough for blocks of the base not to repeat.
+func deltaText(r *rand.Rand, lines int) []byte {
+	var b bytes.Buffer
+	for i := 0; i < lines; i++ {
+		for j := r.Intn(60); j >= 0; j-- {
+			b.WriteByte(byte('a' + r.Intn(26)))
+		}
+		b.WriteByte('\n')
+	}
+	return b.Bytes()
+}
+
+func concat(parts ...[]byte) []byte {
+	return bytes.Join(parts, nil)
+}
+
+func TestDeltaRoundTrip(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	base := deltaText(r, 200)
+	middle := len(base) / 2
+	// Long enough for copies of more than 0x10000 bytes and offsets taking
+	// more than two bytes.
+	large := deltaText(r, 10000)
+	tests := []struct {
+		name         string
+		base, target []byte
+	}{
+		{"identical", base, base},
+		{"empty target", base, nil},
+		{"empty base", nil, base},
+		{"both empty", nil, nil},
+		{"prepended", base, concat([]byte("new first line\n"), base)},
+		{"appended", base, concat(base, []byte("new last line\n"))},
+		{"inserted", base, concat(base[:middle], []byte("inserted\n"), base[middle:])},
+		{"removed", base, concat(base[:middle], base[middle+100:])},
+		{"reordered", base, concat(base[middle:], base[:middle])},
+		{"long insert", base, concat(base[:middle], deltaText(r, 20), base[middle:])},
+		{"unrelated", base, deltaText(r, 200)},
+		{"large copy", large, concat([]byte("x"), large)},
+		{"far offset", large, concat(large[len(large)-1000:], large[:1000])},
+	}
+	for _, test := range tests {
+		delta := newDeltaIndex(test.base).delta(test.target, len(test.target)+1000)
+		if delta == nil {
+			t.Fatalf("%s: no delta created", test.name)
+		}
+		result, err := applyDelta(test.base, delta)
+		if err != nil {
+			t.Fatalf("%s: apply: %v", test.name, err)
+		}
+		if !bytes.Equal(result, test.target) {
+			t.Errorf("%s: delta does not recreate the target", test.name)
+		}
+	}
+}
+
+func TestDeltaIsSmall(t *testing.T) {
+	r := rand.New(rand.NewSource(2))
+	base := deltaText(r, 200)
+	target := concat(base[:100], []byte("changed"), base[100:])
+	delta := newDeltaIndex(base).delta(target, len(target))
+	if delta == nil || len(delta) > 50 {
+		t.Errorf("delta of a small change takes %d bytes", len(delta))
+	}
+}
+
+func TestDeltaLimit(t *testing.T) {
+	r := rand.New(rand.NewSource(3))
+	base, target := deltaText(r, 100), deltaText(r, 100)
+	if delta := newDeltaIndex(base).delta(target, len(target)); delta != nil {
+		t.Errorf("got a %d byte delta of unrelated content, limit was %d", len(delta), len(target))
+	}
+	delta := newDeltaIndex(base).delta(base, 1000)
+	if delta == nil {
+		t.Fatal("no delta of identical content")
+	}
+	if again := newDeltaIndex(base).delta(base, len(delta)); again != nil {
+		t.Errorf("got a %d byte delta, limit was %d", len(again), len(delta))
+	}
+}
+
+func TestApplyCorruptDelta(t *testing.T) {
+	base := []byte("0123456789")
+	tests := []struct {
+		name  string
+		delta []byte
+	}{
+		{"empty", nil},
+		{"wrong base size", []byte{9, 1, 1, 'x'}},
+		{"missing result size", []byte{10}},
+		{"zero instruction", []byte{10, 1, 0}},
+		{"truncated insert", []byte{10, 3, 3, 'x'}},
+		{"truncated copy", []byte{10, 3, 0x91, 0}},
+		{"copy past base", []byte{10, 3, 0x91, 8, 3}},
+		{"result too short", []byte{10, 3, 1, 'x'}},
+		{"result too long", []byte{10, 1, 2, 'x', 'y'}},
+	}
+	for _, test := range tests {
+		if _, err := applyDelta(base, test.delta); err != errCorruptDelta {
+			t.Errorf("%s: got error %v, want %v", test.name, err, errCorruptDelta)
+		}
+	}
+}
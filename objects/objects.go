@@ -1,6 +1,7 @@
 package objects
 
 import (
+	"bufio"
 	"compress/zlib"
 	"crypto/sha1"
 	"errors"
@@ -8,9 +9,13 @@ import (
 	"io"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/antoniszczepanik/gggit/common"
+	"github.com/antoniszczepanik/gggit/config"
 )
 
 type ObjectType string
@@ -25,14 +30,75 @@ type Object interface {
 
 // Generic write object method.
 func Write(o Object) error {
+	_, err := writeObject(o)
+	return err
+}
+
+// Write an object, returning its hash.
+func writeObject(o Object) (string, error) {
 	if err := IsEmpty(o); err != nil {
-		return err
+		return "", err
 	}
-	objectDir, err := common.GetGitSubdir("objects")
-	if err != nil {
-		return err
+	if err := common.CheckWritable(); err != nil {
+		return "", err
 	}
 	hash, err := CalculateHash(o)
+	if err != nil {
+		return "", err
+	}
+	// Packed objects are not written loose again.
+	if packed, err := freshenPacked(hash); err != nil {
+		return "", err
+	} else if packed {
+		return hash, nil
+	}
+	r, err := openRawContent(o)
+	if err != nil {
+		return "", err
+	}
+	defer r.Close()
+	return hash, writeLoose(hash, r)
+}
+
+// Config key making loose objects synced to disk before they are renamed
+// into place, so that they survive a power loss, at a cost of speed.
+const FsyncObjectFilesKey = "core.fsyncObjectFiles"
+
+var (
+	fsyncObjects     bool
+	fsyncObjectsErr  error
+	fsyncObjectsOnce sync.Once
+)
+
+func fsyncObjectFiles() (bool, error) {
+	fsyncObjectsOnce.Do(func() {
+		var c *config.Config
+		c, fsyncObjectsErr = config.Load()
+		if fsyncObjectsErr != nil {
+			return
+		}
+		fsyncObjects, fsyncObjectsErr = c.GetBool(FsyncObjectFilesKey, false)
+	})
+	return fsyncObjects, fsyncObjectsErr
+}
+
+// Temporary files objects are written to. Those left behind by a crash are
+// removed by RemoveTempFiles.
+const (
+	looseTempPrefix = "tmp_obj_"
+	packTempPrefix  = "tmp_pack_"
+	idxTempPrefix   = "tmp_idx_"
+)
+
+// Store raw object content in a loose object file. It is written to
+// a temporary file first and renamed into place once complete, so that
+// a crash never leaves a truncated object behind. Existing objects are
+// never rewritten, they cannot change, but their modification time is
+// updated, so that pruning does not remove them right after they become
+// referenced again. Content is hashed as it is written, so a file modified
+// since its hash was calculated is not stored under a wrong name.
+func writeLoose(hash string, r io.Reader) error {
+	objectDir, err := common.GetGitSubdir("objects")
 	if err != nil {
 		return err
 	}
@@ -41,72 +107,235 @@ func Write(o Object) error {
 		return err
 	}
 	objectSubDirPath := filepath.Join(objectDir, objectSubDir)
-	if _, err := os.ReadDir(objectSubDirPath); os.IsNotExist(err) {
-		err = os.Mkdir(objectSubDirPath, 0755)
-		if err != nil {
-			return err
+	objectFileName := filepath.Join(objectSubDirPath, objectName)
+	// Like git, write the object again if it cannot be freshened.
+	if _, err := os.Stat(objectFileName); err == nil {
+		if freshen(objectFileName) == nil {
+			return nil
 		}
+	} else if !os.IsNotExist(err) {
+		return err
 	}
-	objectFileName := filepath.Join(objectSubDirPath, objectName)
-
-	// Skip if file already exists.
-	if _, err := os.Stat(objectFileName); os.IsExist(err) {
-		return nil
+	if err := os.MkdirAll(objectSubDirPath, 0755); err != nil {
+		return err
 	}
-	// Otherwise create a file.
-	f, err := os.Create(objectFileName)
+	// Temporary files live outside of object subdirectories, so that they
+	// are never mistaken for objects.
+	f, err := os.CreateTemp(objectDir, looseTempPrefix)
 	if err != nil {
 		return err
 	}
-	// Compress and write file contents.
-	w := zlib.NewWriter(f)
-	defer w.Close()
-	rawContent, err := constructRawContent(o)
+	tmpPath := f.Name()
+	h := sha1.New()
+	err = writeCompressed(f, io.TeeReader(r, h))
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if actual := fmt.Sprintf("%x", h.Sum(nil)); err == nil && actual != hash {
+		err = fmt.Errorf("content changed while being written, it now hashes to %s", actual)
+	}
+	if err == nil {
+		err = os.Chmod(tmpPath, 0644)
+	}
+	if err == nil {
+		err = os.Rename(tmpPath, objectFileName)
+	}
 	if err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("write object %s: %w", hash, err)
+	}
+	return nil
+}
+
+// Set modification time of a file to now.
+func freshen(path string) error {
+	now := time.Now()
+	return os.Chtimes(path, now, now)
+}
+
+// Compress raw object content into a file, syncing it if configured to.
+func writeCompressed(f *os.File, r io.Reader) error {
+	w := zlib.NewWriter(f)
+	if _, err := io.Copy(w, r); err != nil {
+		w.Close()
 		return err
 	}
-	_, err = w.Write([]byte(rawContent))
+	if err := w.Close(); err != nil {
+		return err
+	}
+	fsync, err := fsyncObjectFiles()
 	if err != nil {
 		return err
 	}
+	if fsync {
+		return f.Sync()
+	}
 	return nil
 }
 
+// Read an object. Blobs are not read into memory, their content is read
+// when asked for.
 func Read(hash string) (Object, error) {
-	rawContent, err := getObjectRawContent(hash)
+	objectType, _, r, err := Open(hash)
 	if err != nil {
 		return nil, err
 	}
-	objectType, _, content, err := splitRawContent(rawContent)
+	defer r.Close()
+	if objectType == BlobObject {
+		return Blob{hash: hash}, nil
+	}
+	content, err := io.ReadAll(r)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("read object %s: %w", hash, err)
 	}
 	switch objectType {
-	case BlobObject:
-		return parseBlob(content)
 	case TreeObject:
-		return parseTree(content)
+		return parseTree(string(content))
 	case CommitObject:
-		return parseCommit(content)
+		return parseCommit(string(content))
+	case TagObject:
+		return parseTag(string(content))
 	default:
 		return nil, fmt.Errorf("unexpected object type %s", objectType)
 	}
 }
 
-// Print object contents by hash name.
+// Read type of an object, without reading its content.
+func ReadType(hash string) (ObjectType, error) {
+	objectType, _, r, err := Open(hash)
+	if err != nil {
+		return "", err
+	}
+	return objectType, r.Close()
+}
+
+// Print object contents by hash name, streaming them.
 func PrintObject(hash string) error {
-	rawContent, err := getObjectRawContent(hash)
+	_, _, r, err := Open(hash)
 	if err != nil {
 		return err
 	}
-	_, _, content, err := splitRawContent(rawContent)
+	defer r.Close()
+	_, err = io.Copy(os.Stdout, r)
+	return err
+}
+
+// Open an object for reading its content, returning its type and size.
+// Objects are decompressed as they are read, so that they never have to fit
+// in memory, except for packed ones which have to be rebuilt from deltas.
+// Caller is responsible for closing the reader.
+func Open(hash string) (ObjectType, int64, io.ReadCloser, error) {
+	objectDir, err := common.GetGitSubdir("objects")
 	if err != nil {
-		return err
+		return "", 0, nil, err
 	}
-	fmt.Print(content)
-	return nil
+	objectSubDir, objectName, err := common.SplitHash(hash)
+	if err != nil {
+		return "", 0, nil, err
+	}
+	f, err := os.Open(filepath.Join(objectDir, objectSubDir, objectName))
+	if os.IsNotExist(err) {
+		objectType, size, r, ok, err := openPacked(hash)
+		if err != nil {
+			return "", 0, nil, err
+		}
+		if !ok {
+			return "", 0, nil, fmt.Errorf("object %s does not exist", hash)
+		}
+		return objectType, size, r, nil
+	} else if err != nil {
+		return "", 0, nil, err
+	}
+	// Compressed data is read through a byte reader, so that decompression
+	// does not read past its end, and trailing garbage can be found.
+	fr := bufio.NewReader(f)
+	zr, err := zlib.NewReader(fr)
+	if err != nil {
+		f.Close()
+		return "", 0, nil, err
+	}
+	br := bufio.NewReader(zr)
+	header, err := br.ReadString(0)
+	if err == nil {
+		var objectType ObjectType
+		var size int
+		if objectType, size, err = parseHeader(header); err == nil {
+			r := &sizedReader{r: br, n: int64(size)}
+			return objectType, int64(size), &looseReader{r: r, fr: fr, zr: zr, f: f}, nil
+		}
+	} else if err == io.EOF {
+		err = errors.New("no null byte in raw content")
+	}
+	zr.Close()
+	f.Close()
+	return "", 0, nil, fmt.Errorf("read object %s: %w", hash, err)
+}
+
+type looseReader struct {
+	r io.Reader
+	// Compressed data, which must end where decompression does.
+	fr *bufio.Reader
+	zr io.ReadCloser
+	f  *os.File
+}
+
+func (l *looseReader) Read(p []byte) (int, error) {
+	n, err := l.r.Read(p)
+	if err == io.EOF {
+		if _, extraErr := l.fr.ReadByte(); extraErr == nil {
+			return n, errors.New("garbage at end of loose object")
+		} else if extraErr != io.EOF {
+			return n, extraErr
+		}
+	}
+	return n, err
+}
+
+func (l *looseReader) Close() error {
+	err := l.zr.Close()
+	if closeErr := l.f.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// Reader of exactly n bytes, failing if there are fewer or more of them,
+// e.g. if an object header does not match its content, or a file is
+// modified while being read.
+type sizedReader struct {
+	r io.Reader
+	n int64
+}
+
+func (s *sizedReader) Read(p []byte) (int, error) {
+	if s.n == 0 {
+		// Reading past the end lets compressed readers verify their
+		// checksums.
+		var extra [1]byte
+		n, err := s.r.Read(extra[:])
+		if n > 0 {
+			return 0, errors.New("content is longer than its recorded size")
+		}
+		if err != nil && err != io.EOF {
+			return 0, err
+		}
+		return 0, io.EOF
+	}
+	if int64(len(p)) > s.n {
+		p = p[:s.n]
+	}
+	n, err := s.r.Read(p)
+	s.n -= int64(n)
+	if err == io.EOF {
+		if s.n > 0 {
+			return n, errors.New("content is shorter than its recorded size")
+		}
+		err = nil
+	}
+	return n, err
 }
 
+// Read a loose object, falling back to packs if there is none.
 func getObjectRawContent(hash string) (string, error) {
 	objectDir, err := common.GetGitSubdir("objects")
 	if err != nil {
@@ -116,19 +345,21 @@ func getObjectRawContent(hash string) (string, error) {
 	if err != nil {
 		return "", err
 	}
-	objectSubDirPath := filepath.Join(objectDir, objectSubDir)
-	if _, err := os.Stat(objectSubDirPath); os.IsNotExist(err) {
-		return "", fmt.Errorf("object %s does not exist", hash)
-	}
-
-	objectPath := filepath.Join(objectSubDirPath, objectName)
-	if _, err := os.Stat(objectPath); os.IsNotExist(err) {
-		return "", fmt.Errorf("object %s does not exist", hash)
-	}
+	objectPath := filepath.Join(objectDir, objectSubDir, objectName)
 	f, err := os.Open(objectPath)
-	if err != nil {
+	if os.IsNotExist(err) {
+		rawContent, ok, err := readPacked(hash)
+		if err != nil {
+			return "", err
+		}
+		if !ok {
+			return "", fmt.Errorf("object %s does not exist", hash)
+		}
+		return rawContent, nil
+	} else if err != nil {
 		return "", err
 	}
+	defer f.Close()
 	r, err := zlib.NewReader(f)
 	if err != nil {
 		return "", err
@@ -141,16 +372,43 @@ func getObjectRawContent(hash string) (string, error) {
 	return string(rawContent), nil
 }
 
-// Calculate hash of an object.
+// Calculate hash of an object, streaming its content if possible.
 func CalculateHash(o Object) (string, error) {
 	if err := IsEmpty(o); err != nil {
 		return "", err
 	}
-	rawContent, err := constructRawContent(o)
+	r, err := openRawContent(o)
 	if err != nil {
 		return "", err
 	}
-	return fmt.Sprintf("%x", sha1.Sum([]byte(rawContent))), nil
+	defer r.Close()
+	h := sha1.New()
+	if _, err := io.Copy(h, r); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%x", h.Sum(nil)), nil
+}
+
+// Get raw object content, header followed by actual content, as a stream.
+// Content of stream objects is never held in memory as a whole.
+func openRawContent(o Object) (io.ReadCloser, error) {
+	s, ok := o.(StreamObject)
+	if !ok {
+		rawContent, err := constructRawContent(o)
+		if err != nil {
+			return nil, err
+		}
+		return io.NopCloser(strings.NewReader(rawContent)), nil
+	}
+	content, size, err := s.Open()
+	if err != nil {
+		return nil, err
+	}
+	header := fmt.Sprintf(HeaderFmt, o.GetType(), size)
+	return struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(strings.NewReader(header), &sizedReader{r: content, n: size}), content}, nil
 }
 
 // Construct header of an object.
@@ -193,6 +451,10 @@ func (o EmptyObjectError) Error() string {
 
 // Check if object was properly initialized.
 func IsEmpty(o Object) error {
+	// Empty files are perfectly valid blobs, no need to read them.
+	if o.GetType() == BlobObject {
+		return nil
+	}
 	content, err := o.GetContent()
 	if err != nil {
 		return err
@@ -223,15 +485,53 @@ func Exists(hash string) error {
 	if err != nil {
 		return err
 	}
-	objectSubDirPath := filepath.Join(objectDir, objectSubDir)
-	if _, err := os.Stat(objectSubDirPath); os.IsNotExist(err) {
+	objectFileName := filepath.Join(objectDir, objectSubDir, objectName)
+	_, err = os.Stat(objectFileName)
+	if !os.IsNotExist(err) {
 		return err
 	}
-	objectFileName := filepath.Join(objectSubDirPath, objectName)
-	if _, err := os.Stat(objectFileName); os.IsNotExist(err) {
-		return err
+	if packed, packErr := isPacked(hash); packErr != nil {
+		return packErr
+	} else if packed {
+		return nil
 	}
-	return nil
+	return err
+}
+
+// Find hashes of all objects, loose and packed, starting with a prefix of
+// at least two hex characters.
+func FindByPrefix(prefix string) ([]string, error) {
+	if len(prefix) < 2 {
+		return nil, errors.New("hash prefix too short")
+	}
+	objectDir, err := common.GetGitSubdir("objects")
+	if err != nil {
+		return nil, err
+	}
+	dirEntries, err := os.ReadDir(filepath.Join(objectDir, prefix[:2]))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	packed, err := findPackedByPrefix(prefix)
+	if err != nil {
+		return nil, err
+	}
+	found := make(map[string]bool)
+	var hashes []string
+	for _, e := range dirEntries {
+		if hash := prefix[:2] + e.Name(); strings.HasPrefix(hash, prefix) && !found[hash] {
+			found[hash] = true
+			hashes = append(hashes, hash)
+		}
+	}
+	for _, hash := range packed {
+		if !found[hash] {
+			found[hash] = true
+			hashes = append(hashes, hash)
+		}
+	}
+	sort.Strings(hashes)
+	return hashes, nil
 }
 
 // Split raw object content into object type, size and actual content.
@@ -245,6 +545,10 @@ func splitRawContent(rawContent string) (ObjectType, int, string, error) {
 	if err != nil {
 		return "", 0, "", err
 	}
+	if objectSize != len(content) {
+		// Type is still returned, so that corrupt objects can be described.
+		return objectType, 0, "", fmt.Errorf("object header says %d bytes, content has %d", objectSize, len(content))
+	}
 	return objectType, objectSize, content, nil
 }
 
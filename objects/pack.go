@@ -0,0 +1,520 @@
+package objects
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/antoniszczepanik/gggit/common"
+)
+
+// Packfile layout (all integers are big endian):
+//
+//	header:  "PACK" | version uint32 | object count uint32
+//	object:  type and size varint | [base offset varint or base hash] | zlib data
+//	trailer: sha1 checksum of everything above
+//
+// Objects are looked up by their hash in accompanying .idx files.
+const (
+	packDirName    = "pack"
+	packSignature  = "PACK"
+	idxSignature   = "\377tOc"
+	idxFanoutCount = 256
+)
+
+// Types of packed objects, as encoded in their headers.
+const (
+	packCommit   = 1
+	packTree     = 2
+	packBlob     = 3
+	packTag      = 4
+	packOfsDelta = 6
+	packRefDelta = 7
+)
+
+var packTypes = map[byte]ObjectType{
+	packCommit: CommitObject,
+	packTree:   TreeObject,
+	packBlob:   BlobObject,
+	packTag:    TagObject,
+}
+
+// Longest delta chain followed before a pack is considered corrupt.
+const maxDeltaDepth = 1000
+
+type pack struct {
+	path string
+	f    *os.File
+	// Sorted raw hashes of packed objects, 20 bytes each.
+	hashes  []byte
+	offsets []int64
+}
+
+// Packs of a pack directory, as they were when it was last scanned.
+type packDir struct {
+	packs []*pack
+	// Modification time of the directory, which changes whenever packs are
+	// added or removed, and time of the scan.
+	modTime time.Time
+	scanned time.Time
+}
+
+// Changes made within that time before a scan might not have changed
+// modification time of the directory on file systems with coarse
+// timestamps, so such scans are not trusted.
+const packDirRacyTime = time.Second
+
+var (
+	packsMu sync.Mutex
+	// Packs opened so far, keyed by path of their pack directory.
+	openPacks = make(map[string]*packDir)
+)
+
+// Get packs of the current repository. Pack directory is scanned again only
+// if asked to, e.g. after an object was not found in packs known so far,
+// and only if it changed since it was last scanned.
+func getPacks(rescan bool) ([]*pack, error) {
+	objectDir, err := common.GetGitSubdir("objects")
+	if err != nil {
+		return nil, err
+	}
+	dirPath := filepath.Join(objectDir, packDirName)
+	packsMu.Lock()
+	defer packsMu.Unlock()
+	dir, ok := openPacks[dirPath]
+	if ok && !rescan {
+		return dir.packs, nil
+	}
+	var modTime time.Time
+	if fi, err := os.Stat(dirPath); err == nil {
+		modTime = fi.ModTime()
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+	if ok && modTime.Equal(dir.modTime) && modTime.Before(dir.scanned.Add(-packDirRacyTime)) {
+		return dir.packs, nil
+	}
+	scanned := time.Now()
+	idxPaths, err := filepath.Glob(filepath.Join(dirPath, "pack-*.idx"))
+	if err != nil {
+		return nil, err
+	}
+	known := make(map[string]*pack)
+	if ok {
+		for _, p := range dir.packs {
+			known[p.path] = p
+		}
+	}
+	var packs []*pack
+	for _, idxPath := range idxPaths {
+		packPath := strings.TrimSuffix(idxPath, ".idx") + ".pack"
+		if p, ok := known[packPath]; ok {
+			packs = append(packs, p)
+			delete(known, packPath)
+			continue
+		}
+		p, err := openPack(packPath, idxPath)
+		if errors.Is(err, os.ErrNotExist) {
+			// Pack is being written or removed right now.
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		packs = append(packs, p)
+	}
+	for _, p := range known {
+		p.f.Close()
+	}
+	openPacks[dirPath] = &packDir{packs: packs, modTime: modTime, scanned: scanned}
+	return packs, nil
+}
+
+func openPack(packPath, idxPath string) (*pack, error) {
+	idx, err := os.ReadFile(idxPath)
+	if err != nil {
+		return nil, err
+	}
+	p := &pack{path: packPath}
+	if err := p.parseIndex(idx); err != nil {
+		return nil, fmt.Errorf("%s: %w", idxPath, err)
+	}
+	if p.f, err = os.Open(packPath); err != nil {
+		return nil, err
+	}
+	header := make([]byte, 12)
+	if _, err := io.ReadFull(p.f, header); err != nil || string(header[:4]) != packSignature {
+		p.f.Close()
+		return nil, fmt.Errorf("%s: bad pack signature", packPath)
+	}
+	if version := binary.BigEndian.Uint32(header[4:8]); version != 2 && version != 3 {
+		p.f.Close()
+		return nil, fmt.Errorf("%s: unsupported pack version %d", packPath, version)
+	}
+	return p, nil
+}
+
+// Parse a version 1 or 2 pack index.
+func (p *pack) parseIndex(idx []byte) error {
+	version := 1
+	if bytes.HasPrefix(idx, []byte(idxSignature)) {
+		if len(idx) < 8 {
+			return errors.New("pack index is truncated")
+		}
+		if version = int(binary.BigEndian.Uint32(idx[4:8])); version != 2 {
+			return fmt.Errorf("unsupported pack index version %d", version)
+		}
+		idx = idx[8:]
+	}
+	if len(idx) < idxFanoutCount*4 {
+		return errors.New("pack index is truncated")
+	}
+	count := int(binary.BigEndian.Uint32(idx[(idxFanoutCount-1)*4:]))
+	idx = idx[idxFanoutCount*4:]
+	p.offsets = make([]int64, count)
+	if version == 1 {
+		// Entries are offsets followed by hashes.
+		if len(idx) < count*24 {
+			return errors.New("pack index is truncated")
+		}
+		p.hashes = make([]byte, 0, count*20)
+		for i := 0; i < count; i++ {
+			entry := idx[i*24 : (i+1)*24]
+			p.offsets[i] = int64(binary.BigEndian.Uint32(entry))
+			p.hashes = append(p.hashes, entry[4:]...)
+		}
+		return nil
+	}
+	// Hashes, CRC32 checksums and offsets are stored in separate tables.
+	// Offsets with the highest bit set point into a table of large ones.
+	if len(idx) < count*28 {
+		return errors.New("pack index is truncated")
+	}
+	p.hashes = idx[:count*20]
+	offsets := idx[count*24 : count*28]
+	large := idx[count*28:]
+	for i := 0; i < count; i++ {
+		offset := binary.BigEndian.Uint32(offsets[i*4:])
+		if offset&0x80000000 == 0 {
+			p.offsets[i] = int64(offset)
+			continue
+		}
+		j := int(offset & 0x7fffffff)
+		if len(large) < (j+1)*8 {
+			return errors.New("pack index is truncated")
+		}
+		p.offsets[i] = int64(binary.BigEndian.Uint64(large[j*8:]))
+	}
+	return nil
+}
+
+func (p *pack) count() int {
+	return len(p.offsets)
+}
+
+func (p *pack) hashAt(i int) string {
+	return hex.EncodeToString(p.hashes[i*20 : (i+1)*20])
+}
+
+// Find position of the first object with hash not lower than a hex prefix.
+func (p *pack) search(prefix string) int {
+	return sort.Search(p.count(), func(i int) bool {
+		return p.hashAt(i) >= prefix
+	})
+}
+
+// Get offset of an object in the pack.
+func (p *pack) find(hash string) (int64, bool) {
+	i := p.search(hash)
+	if i < p.count() && p.hashAt(i) == hash {
+		return p.offsets[i], true
+	}
+	return 0, false
+}
+
+// Open an object at an offset for reading, returning its type and size.
+// Objects stored whole are decompressed as they are read, so that they
+// never have to fit in memory. Deltas are applied in memory, large blobs
+// are never stored as deltas though.
+func (p *pack) open(offset int64) (ObjectType, int64, io.ReadCloser, error) {
+	r := bufio.NewReader(io.NewSectionReader(p.f, offset, 1<<62))
+	packType, size, err := readPackHeader(r)
+	if err != nil {
+		return "", 0, nil, fmt.Errorf("%s: object at %d: %w", p.path, offset, err)
+	}
+	if objectType, ok := packTypes[packType]; ok {
+		zr, err := zlib.NewReader(r)
+		if err != nil {
+			return "", 0, nil, fmt.Errorf("%s: object at %d: %w", p.path, offset, err)
+		}
+		return objectType, size, struct {
+			io.Reader
+			io.Closer
+		}{&sizedReader{r: zr, n: size}, zr}, nil
+	}
+	objectType, content, err := p.readAt(offset)
+	if err != nil {
+		return "", 0, nil, err
+	}
+	return objectType, int64(len(content)), io.NopCloser(bytes.NewReader(content)), nil
+}
+
+// Read an object at an offset, applying all deltas it is based on.
+func (p *pack) readAt(offset int64) (ObjectType, []byte, error) {
+	var deltas [][]byte
+	for depth := 0; ; depth++ {
+		if depth > maxDeltaDepth {
+			return "", nil, fmt.Errorf("%s: delta chain too long", p.path)
+		}
+		r := bufio.NewReader(io.NewSectionReader(p.f, offset, 1<<62))
+		packType, size, err := readPackHeader(r)
+		if err != nil {
+			return "", nil, fmt.Errorf("%s: object at %d: %w", p.path, offset, err)
+		}
+		var base []byte
+		var baseType ObjectType
+		switch packType {
+		case packOfsDelta:
+			distance, err := readOffsetDistance(r)
+			if err != nil {
+				return "", nil, err
+			}
+			if distance <= 0 || distance > offset {
+				return "", nil, fmt.Errorf("%s: invalid delta base offset at %d", p.path, offset)
+			}
+			delta, err := inflate(r, size)
+			if err != nil {
+				return "", nil, err
+			}
+			deltas = append(deltas, delta)
+			offset -= distance
+			continue
+		case packRefDelta:
+			baseHash := make([]byte, 20)
+			if _, err := io.ReadFull(r, baseHash); err != nil {
+				return "", nil, err
+			}
+			delta, err := inflate(r, size)
+			if err != nil {
+				return "", nil, err
+			}
+			deltas = append(deltas, delta)
+			// Base might be stored anywhere, in this pack or outside of it.
+			var rawBase string
+			if rawBase, err = getObjectRawContent(hex.EncodeToString(baseHash)); err != nil {
+				return "", nil, err
+			}
+			var content string
+			if baseType, _, content, err = splitRawContent(rawBase); err != nil {
+				return "", nil, err
+			}
+			base = []byte(content)
+		default:
+			var ok bool
+			if baseType, ok = packTypes[packType]; !ok {
+				return "", nil, fmt.Errorf("%s: unknown object type %d at %d", p.path, packType, offset)
+			}
+			if base, err = inflate(r, size); err != nil {
+				return "", nil, err
+			}
+		}
+		// Deltas were collected from the outermost one.
+		for i := len(deltas) - 1; i >= 0; i-- {
+			if base, err = applyDelta(base, deltas[i]); err != nil {
+				return "", nil, fmt.Errorf("%s: %w", p.path, err)
+			}
+		}
+		return baseType, base, nil
+	}
+}
+
+// Read type and size of a packed object. Size is stored in 4 bits of the
+// first byte, followed by 7 bits of every next byte, least significant
+// first.
+func readPackHeader(r io.ByteReader) (byte, int64, error) {
+	c, err := r.ReadByte()
+	if err != nil {
+		return 0, 0, err
+	}
+	packType := (c >> 4) & 7
+	size := int64(c & 0x0f)
+	for shift := 4; c&0x80 != 0; shift += 7 {
+		if c, err = r.ReadByte(); err != nil {
+			return 0, 0, err
+		}
+		size |= int64(c&0x7f) << shift
+	}
+	return packType, size, nil
+}
+
+// Read distance to the base of an offset delta. Unlike sizes, it is stored
+// most significant bits first, with every continuation adding one.
+func readOffsetDistance(r io.ByteReader) (int64, error) {
+	c, err := r.ReadByte()
+	if err != nil {
+		return 0, err
+	}
+	distance := int64(c & 0x7f)
+	for c&0x80 != 0 {
+		if c, err = r.ReadByte(); err != nil {
+			return 0, err
+		}
+		distance = ((distance + 1) << 7) | int64(c&0x7f)
+	}
+	return distance, nil
+}
+
+func inflate(r io.Reader, size int64) ([]byte, error) {
+	zr, err := zlib.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+	content := make([]byte, size)
+	if _, err := io.ReadFull(zr, content); err != nil {
+		return nil, fmt.Errorf("inflate packed object: %w", err)
+	}
+	return content, nil
+}
+
+type PackedObject struct {
+	Hash string
+	// Bytes the object takes in its pack.
+	Size int64
+	// Packed objects are as old as their pack.
+	ModTime time.Time
+}
+
+// List objects of all packs. Objects stored in many packs are listed once
+// for each of them.
+func ListPackedObjects() ([]PackedObject, error) {
+	packs, err := getPacks(true)
+	if err != nil {
+		return nil, err
+	}
+	var packed []PackedObject
+	for _, p := range packs {
+		fi, err := p.f.Stat()
+		if err != nil {
+			return nil, err
+		}
+		// Objects end where the next one starts, the last one where the
+		// trailing checksum does.
+		ends := append([]int64(nil), p.offsets...)
+		sort.Slice(ends, func(i, j int) bool { return ends[i] < ends[j] })
+		ends = append(ends, fi.Size()-20)
+		for i := 0; i < p.count(); i++ {
+			end := ends[sort.Search(len(ends), func(j int) bool { return ends[j] > p.offsets[i] })]
+			packed = append(packed, PackedObject{Hash: p.hashAt(i), Size: end - p.offsets[i], ModTime: fi.ModTime()})
+		}
+	}
+	return packed, nil
+}
+
+// Read raw content of a packed object. Reports false if none of the packs
+// contains it.
+func readPacked(hash string) (string, bool, error) {
+	for _, rescan := range []bool{false, true} {
+		packs, err := getPacks(rescan)
+		if err != nil {
+			return "", false, err
+		}
+		for _, p := range packs {
+			offset, ok := p.find(hash)
+			if !ok {
+				continue
+			}
+			objectType, content, err := p.readAt(offset)
+			if err != nil {
+				return "", false, err
+			}
+			return fmt.Sprintf(HeaderFmt, objectType, len(content)) + string(content), true, nil
+		}
+	}
+	return "", false, nil
+}
+
+// Open a packed object for reading, see pack.open. Reports false if none of
+// the packs contains it.
+func openPacked(hash string) (ObjectType, int64, io.ReadCloser, bool, error) {
+	for _, rescan := range []bool{false, true} {
+		packs, err := getPacks(rescan)
+		if err != nil {
+			return "", 0, nil, false, err
+		}
+		for _, p := range packs {
+			offset, ok := p.find(hash)
+			if !ok {
+				continue
+			}
+			objectType, size, r, err := p.open(offset)
+			if err != nil {
+				return "", 0, nil, false, err
+			}
+			return objectType, size, r, true, nil
+		}
+	}
+	return "", 0, nil, false, nil
+}
+
+// Check if an object is packed, updating modification time of its pack, as
+// packed objects are as old as their pack. Like git, reports the object as
+// not packed if the pack cannot be freshened, so that it is written loose.
+func freshenPacked(hash string) (bool, error) {
+	for _, rescan := range []bool{false, true} {
+		packs, err := getPacks(rescan)
+		if err != nil {
+			return false, err
+		}
+		for _, p := range packs {
+			if _, ok := p.find(hash); ok && freshen(p.path) == nil {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+func isPacked(hash string) (bool, error) {
+	for _, rescan := range []bool{false, true} {
+		packs, err := getPacks(rescan)
+		if err != nil {
+			return false, err
+		}
+		for _, p := range packs {
+			if _, ok := p.find(hash); ok {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+// Find hashes of packed objects starting with a prefix.
+func findPackedByPrefix(prefix string) ([]string, error) {
+	packs, err := getPacks(true)
+	if err != nil {
+		return nil, err
+	}
+	var hashes []string
+	for _, p := range packs {
+		for i := p.search(prefix); i < p.count(); i++ {
+			hash := p.hashAt(i)
+			if !strings.HasPrefix(hash, prefix) {
+				break
+			}
+			hashes = append(hashes, hash)
+		}
+	}
+	return hashes, nil
+}
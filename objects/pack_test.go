@@ -0,0 +1,245 @@
+package objects
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/antoniszczepanik/gggit/common"
+	"github.com/antoniszczepanik/gggit/config"
+	"github.com/antoniszczepanik/gggit/internal/testrepo"
+)
+
+// Make a temporary repository the current one, closing its packs before
+// it is removed.
+func initRepo(t *testing.T) {
+	t.Helper()
+	testrepo.Init(t)
+	// Runs before the working directory is restored.
+	t.Cleanup(closePacks)
+}
+
+// Close packs of the current repository and forget about them.
+func closePacks() {
+	objectDir, err := common.GetGitSubdir("objects")
+	if err != nil {
+		return
+	}
+	packDir := filepath.Join(objectDir, packDirName)
+	packsMu.Lock()
+	defer packsMu.Unlock()
+	if dir, ok := openPacks[packDir]; ok {
+		for _, p := range dir.packs {
+			p.f.Close()
+		}
+	}
+	delete(openPacks, packDir)
+}
+
+type testObject struct {
+	hash       string
+	objectType ObjectType
+	content    []byte
+}
+
+func writeTestObject(t *testing.T, o Object) testObject {
+	t.Helper()
+	if err := o.Write(); err != nil {
+		t.Fatal(err)
+	}
+	hash, err := CalculateHash(o)
+	if err != nil {
+		t.Fatal(err)
+	}
+	content, err := o.GetContent()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return testObject{hash: hash, objectType: o.GetType(), content: []byte(content)}
+}
+
+// Write blobs sharing most of their content, so that they are packed as
+// deltas, a tree of them and a few small, unrelated blobs.
+func writeTestObjects(t *testing.T) []testObject {
+	t.Helper()
+	r := rand.New(rand.NewSource(1))
+	base := deltaText(r, 300)
+	var written []testObject
+	entries := make(map[string]TreeEntry)
+	for i := 0; i < 20; i++ {
+		at := r.Intn(len(base))
+		content := string(base[:at]) + fmt.Sprintf("version %d\n", i) + string(base[at:])
+		base = []byte(content)
+		o := writeTestObject(t, NewBlob(content))
+		written = append(written, o)
+		entries["file"+strconv.Itoa(i)] = TreeEntry{Mode: ModeRegular, Hash: o.hash}
+	}
+	for _, content := range []string{"", "a\n", "small blob\n"} {
+		written = append(written, writeTestObject(t, NewBlob(content)))
+	}
+	tree, err := NewTreeFromEntries(entries)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return append(written, writeTestObject(t, tree))
+}
+
+// Find the pack just written among packs of the current repository.
+func findPack(t *testing.T, name string) *pack {
+	t.Helper()
+	packs, err := getPacks(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range packs {
+		if filepath.Base(p.path) == name+".pack" {
+			return p
+		}
+	}
+	t.Fatalf("pack %s not found", name)
+	return nil
+}
+
+func checkPacked(t *testing.T, p *pack, objects []testObject) {
+	t.Helper()
+	if p.count() != len(objects) {
+		t.Errorf("pack has %d objects, want %d", p.count(), len(objects))
+	}
+	for _, o := range objects {
+		offset, ok := p.find(o.hash)
+		if !ok {
+			t.Errorf("%s not in pack", o.hash)
+			continue
+		}
+		objectType, content, err := p.readAt(offset)
+		if err != nil {
+			t.Errorf("read %s: %v", o.hash, err)
+			continue
+		}
+		if objectType != o.objectType || !bytes.Equal(content, o.content) {
+			t.Errorf("%s read back as a different %s", o.hash, objectType)
+		}
+		objectType, size, r, err := p.open(offset)
+		if err != nil {
+			t.Errorf("open %s: %v", o.hash, err)
+			continue
+		}
+		content, err = io.ReadAll(r)
+		r.Close()
+		if err != nil {
+			t.Errorf("stream %s: %v", o.hash, err)
+			continue
+		}
+		if objectType != o.objectType || size != int64(len(o.content)) || !bytes.Equal(content, o.content) {
+			t.Errorf("%s streamed as a different %s", o.hash, objectType)
+		}
+	}
+}
+
+func TestPackRoundTrip(t *testing.T) {
+	tests := []struct {
+		name       string
+		opts       PackOptions
+		wantDeltas bool
+	}{
+		{"default", DefaultPackOptions, true},
+		{"ref deltas", PackOptions{Window: 10, Depth: 50, RefDeltas: true}, true},
+		{"short chains", PackOptions{Window: 10, Depth: 1}, true},
+		{"no window", PackOptions{Window: 0, Depth: 50}, false},
+		{"no depth", PackOptions{Window: 10, Depth: 0}, false},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			initRepo(t)
+			objects := writeTestObjects(t)
+			var hashes []string
+			for _, o := range objects {
+				hashes = append(hashes, o.hash)
+			}
+			// Duplicates are packed once.
+			hashes = append(hashes, hashes[0])
+			stats, err := WritePack(hashes, test.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if stats.Objects != len(objects) {
+				t.Errorf("packed %d objects, want %d", stats.Objects, len(objects))
+			}
+			if (stats.Deltas > 0) != test.wantDeltas {
+				t.Errorf("packed %d deltas", stats.Deltas)
+			}
+			checkPacked(t, findPack(t, stats.Name), objects)
+		})
+	}
+}
+
+func TestPackBigFiles(t *testing.T) {
+	initRepo(t)
+	localConfig, err := config.ScopePath(config.LocalScope)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := config.Set(localConfig, BigFileThresholdKey, "1000"); err != nil {
+		t.Fatal(err)
+	}
+	r := rand.New(rand.NewSource(2))
+	base := deltaText(r, 300)
+	objects := []testObject{
+		writeTestObject(t, NewBlob(string(base))),
+		writeTestObject(t, NewBlob(string(base)+"appended\n")),
+		writeTestObject(t, NewBlob(string(base[:900]))),
+		writeTestObject(t, NewBlob(string(base[:900])+"appended\n")),
+	}
+	stats, err := WritePack([]string{objects[0].hash, objects[1].hash, objects[2].hash, objects[3].hash}, DefaultPackOptions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Only the blobs below the threshold are stored as a delta.
+	if stats.Deltas != 1 {
+		t.Errorf("packed %d deltas, want 1", stats.Deltas)
+	}
+	checkPacked(t, findPack(t, stats.Name), objects)
+}
+
+func TestGetPacksRescansChangedDirectory(t *testing.T) {
+	initRepo(t)
+	objects := writeTestObjects(t)
+	first, err := WritePack([]string{objects[0].hash}, DefaultPackOptions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	objectDir, err := common.GetGitSubdir("objects")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dirPath := filepath.Join(objectDir, packDirName)
+	// Old enough for its modification time to be trusted.
+	old := time.Now().Add(-time.Hour)
+	if err := os.Chtimes(dirPath, old, old); err != nil {
+		t.Fatal(err)
+	}
+	findPack(t, first.Name)
+	scanned := openPacks[dirPath].scanned
+	// Objects which are not packed do not make unchanged directory scanned.
+	if packed, err := isPacked(objects[1].hash); err != nil || packed {
+		t.Fatalf("object is packed: %v, %v", packed, err)
+	}
+	if openPacks[dirPath].scanned != scanned {
+		t.Errorf("unchanged pack directory was scanned again")
+	}
+	second, err := WritePack([]string{objects[1].hash}, DefaultPackOptions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if packed, err := isPacked(objects[1].hash); err != nil || !packed {
+		t.Errorf("object of a new pack is not found: %v, %v", packed, err)
+	}
+	findPack(t, second.Name)
+}
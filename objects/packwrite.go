@@ -0,0 +1,582 @@
+package objects
+
+import (
+	"bytes"
+	"compress/zlib"
+	"crypto/sha1"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/antoniszczepanik/gggit/common"
+	"github.com/antoniszczepanik/gggit/config"
+)
+
+type PackOptions struct {
+	// Number of preceding objects tried as delta bases of each object.
+	Window int
+	// Longest chain of deltas created.
+	Depth int
+	// Refer to delta bases by their hash rather than their offset.
+	RefDeltas bool
+}
+
+var DefaultPackOptions = PackOptions{Window: 10, Depth: 50}
+
+type PackStats struct {
+	// Name of the pack, "pack-<checksum>".
+	Name    string
+	Objects int
+	Deltas  int
+}
+
+// Objects smaller than that are never stored as deltas.
+const minDeltaSize = 50
+
+// Config key with size of blobs, in bytes, which are too large to be stored
+// as deltas or to be delta bases. They are streamed into packs instead, so
+// that they never have to fit in memory.
+const BigFileThresholdKey = "core.bigFileThreshold"
+
+const DefaultBigFileThreshold = 512 << 20
+
+// Get size of blobs never stored as deltas, from configuration.
+func BigFileThreshold() (int64, error) {
+	c, err := config.Load()
+	if err != nil {
+		return 0, err
+	}
+	n, err := c.GetInt(BigFileThresholdKey, DefaultBigFileThreshold)
+	if err != nil {
+		return 0, err
+	}
+	if n < 0 {
+		return 0, fmt.Errorf("%s cannot be negative", BigFileThresholdKey)
+	}
+	return int64(n), nil
+}
+
+// Order of object types in a pack, which keeps objects of the same type
+// together.
+var packOrder = map[ObjectType]int{CommitObject: 0, TagObject: 1, TreeObject: 2, BlobObject: 3}
+
+var packCodes = map[ObjectType]byte{
+	CommitObject: packCommit,
+	TreeObject:   packTree,
+	BlobObject:   packBlob,
+	TagObject:    packTag,
+}
+
+type packEntry struct {
+	hash       string
+	objectType ObjectType
+	size       int64
+	// Content is read only while the entry is considered for deltas.
+	content []byte
+	// Entry this one is stored as a delta of, if any.
+	base   *packEntry
+	delta  []byte
+	depth  int
+	offset int64
+	crc    uint32
+	index  *deltaIndex
+}
+
+// Write objects into a new pack with an index. Objects of the same type
+// are stored as deltas of similar ones where that saves space.
+func WritePack(hashes []string, opts PackOptions) (PackStats, error) {
+	if err := common.CheckWritable(); err != nil {
+		return PackStats{}, err
+	}
+	objectDir, err := common.GetGitSubdir("objects")
+	if err != nil {
+		return PackStats{}, err
+	}
+	packDir := filepath.Join(objectDir, packDirName)
+	if err := os.MkdirAll(packDir, 0755); err != nil {
+		return PackStats{}, err
+	}
+	threshold, err := BigFileThreshold()
+	if err != nil {
+		return PackStats{}, err
+	}
+	entries, err := loadPackEntries(hashes)
+	if err != nil {
+		return PackStats{}, err
+	}
+	deltas, err := findDeltas(entries, opts, threshold)
+	if err != nil {
+		return PackStats{}, err
+	}
+	stats := PackStats{Objects: len(entries), Deltas: deltas}
+
+	packFile, err := os.CreateTemp(packDir, packTempPrefix)
+	if err != nil {
+		return PackStats{}, err
+	}
+	defer os.Remove(packFile.Name())
+	checksum, err := writePackData(packFile, entries, opts)
+	if closeErr := packFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return PackStats{}, fmt.Errorf("write pack: %w", err)
+	}
+	stats.Name = "pack-" + hex.EncodeToString(checksum)
+
+	idxFile, err := os.CreateTemp(packDir, idxTempPrefix)
+	if err != nil {
+		return PackStats{}, err
+	}
+	defer os.Remove(idxFile.Name())
+	err = writePackIndex(idxFile, entries, checksum)
+	if closeErr := idxFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return PackStats{}, fmt.Errorf("write pack index: %w", err)
+	}
+	// Readers look for index files, so the pack has to be in place first.
+	packPath := filepath.Join(packDir, stats.Name)
+	if err := os.Rename(packFile.Name(), packPath+".pack"); err != nil {
+		return PackStats{}, err
+	}
+	if err := os.Rename(idxFile.Name(), packPath+".idx"); err != nil {
+		return PackStats{}, err
+	}
+	return stats, nil
+}
+
+// Get types and sizes of objects to be packed, without reading their
+// content.
+func loadPackEntries(hashes []string) ([]*packEntry, error) {
+	seen := make(map[string]bool)
+	var entries []*packEntry
+	for _, hash := range hashes {
+		if seen[hash] {
+			continue
+		}
+		seen[hash] = true
+		objectType, size, r, err := Open(hash)
+		if err != nil {
+			return nil, err
+		}
+		if err := r.Close(); err != nil {
+			return nil, err
+		}
+		if _, ok := packCodes[objectType]; !ok {
+			return nil, fmt.Errorf("unexpected object type %s", objectType)
+		}
+		entries = append(entries, &packEntry{hash: hash, objectType: objectType, size: size})
+	}
+	// Larger objects go first, so that smaller ones, which are usually
+	// their later versions, are stored as deltas.
+	sort.Slice(entries, func(i, j int) bool {
+		a, b := entries[i], entries[j]
+		if a.objectType != b.objectType {
+			return packOrder[a.objectType] < packOrder[b.objectType]
+		}
+		if a.size != b.size {
+			return a.size > b.size
+		}
+		return a.hash < b.hash
+	})
+	return entries, nil
+}
+
+// Find the best delta base for each entry among preceding ones. Content is
+// read only when a delta is tried, and held in memory only while the entry
+// is within the window. Entries larger than threshold are never read.
+// Returns number of entries stored as deltas.
+func findDeltas(entries []*packEntry, opts PackOptions, threshold int64) (int, error) {
+	deltas := 0
+	for i, e := range entries {
+		// Entries out of the window are not tried as bases anymore.
+		if j := i - opts.Window - 1; j >= 0 {
+			entries[j].content, entries[j].index = nil, nil
+		}
+		if !e.deltaCandidate(threshold) {
+			continue
+		}
+		// A delta is worth it only if it halves the object.
+		limit := e.size / 2
+		for j := i - 1; j >= 0 && j >= i-opts.Window; j-- {
+			base := entries[j]
+			if base.objectType != e.objectType || base.depth >= opts.Depth || !base.deltaCandidate(threshold) {
+				continue
+			}
+			// Like git, do not even try bases much larger than the object.
+			if e.size < base.size/32 {
+				continue
+			}
+			if err := e.load(); err != nil {
+				return 0, err
+			}
+			if err := base.load(); err != nil {
+				return 0, err
+			}
+			if base.index == nil {
+				base.index = newDeltaIndex(base.content)
+			}
+			if delta := base.index.delta(e.content, int(limit)); delta != nil {
+				e.base, e.delta, e.depth = base, delta, base.depth+1
+				limit = int64(len(delta))
+			}
+		}
+		if e.base != nil {
+			deltas++
+		}
+	}
+	// Content is read again when it is written, let it go.
+	for _, e := range entries {
+		e.content, e.index = nil, nil
+	}
+	return deltas, nil
+}
+
+func (e *packEntry) deltaCandidate(threshold int64) bool {
+	return e.size >= minDeltaSize && e.size <= threshold
+}
+
+// Read content of an entry into memory, unless it is there already.
+func (e *packEntry) load() error {
+	if e.content != nil {
+		return nil
+	}
+	_, size, r, err := Open(e.hash)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	content := make([]byte, size)
+	if _, err := io.ReadFull(r, content); err != nil {
+		return fmt.Errorf("read object %s: %w", e.hash, err)
+	}
+	e.content = content
+	return nil
+}
+
+// Write header, entries and checksum of a pack. Returns the checksum.
+func writePackData(w io.Writer, entries []*packEntry, opts PackOptions) ([]byte, error) {
+	sum := sha1.New()
+	cw := &countingWriter{w: io.MultiWriter(w, sum)}
+	header := make([]byte, 12)
+	copy(header, packSignature)
+	binary.BigEndian.PutUint32(header[4:], 2)
+	binary.BigEndian.PutUint32(header[8:], uint32(len(entries)))
+	if _, err := cw.Write(header); err != nil {
+		return nil, err
+	}
+	for _, e := range entries {
+		e.offset = cw.n
+		crc := crc32.NewIEEE()
+		ew := io.MultiWriter(cw, crc)
+		var err error
+		if e.base == nil {
+			err = writePackObject(ew, e)
+		} else if opts.RefDeltas {
+			baseHash, _ := hex.DecodeString(e.base.hash)
+			err = writePackEntry(ew, packRefDelta, int64(len(e.delta)), baseHash, bytes.NewReader(e.delta))
+		} else {
+			err = writePackEntry(ew, packOfsDelta, int64(len(e.delta)), offsetDistance(e.offset-e.base.offset), bytes.NewReader(e.delta))
+		}
+		if err != nil {
+			return nil, err
+		}
+		e.crc = crc.Sum32()
+	}
+	checksum := sum.Sum(nil)
+	if _, err := w.Write(checksum); err != nil {
+		return nil, err
+	}
+	return checksum, nil
+}
+
+// Write an object stored whole, streaming its content.
+func writePackObject(w io.Writer, e *packEntry) error {
+	_, size, r, err := Open(e.hash)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	return writePackEntry(w, packCodes[e.objectType], size, nil, r)
+}
+
+// Write type and size header, followed by data identifying delta base, if
+// any, and compressed data of given size.
+func writePackEntry(w io.Writer, code byte, size int64, baseRef []byte, data io.Reader) error {
+	header := []byte{code<<4 | byte(size&0x0f)}
+	for size >>= 4; size > 0; size >>= 7 {
+		header[len(header)-1] |= 0x80
+		header = append(header, byte(size&0x7f))
+	}
+	if _, err := w.Write(append(header, baseRef...)); err != nil {
+		return err
+	}
+	zw := zlib.NewWriter(w)
+	if _, err := io.Copy(zw, data); err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+// Encode distance to the base of an offset delta, see readOffsetDistance.
+func offsetDistance(distance int64) []byte {
+	encoded := []byte{byte(distance & 0x7f)}
+	for distance >>= 7; distance > 0; distance >>= 7 {
+		distance--
+		encoded = append([]byte{0x80 | byte(distance&0x7f)}, encoded...)
+	}
+	return encoded
+}
+
+// Write a version 2 index of pack entries.
+func writePackIndex(w io.Writer, entries []*packEntry, packChecksum []byte) error {
+	sorted := append([]*packEntry(nil), entries...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].hash < sorted[j].hash })
+
+	var buf bytes.Buffer
+	buf.WriteString(idxSignature)
+	binary.Write(&buf, binary.BigEndian, uint32(2))
+	var fanout [idxFanoutCount]uint32
+	for _, e := range sorted {
+		first, _ := hex.DecodeString(e.hash[:2])
+		for i := int(first[0]); i < idxFanoutCount; i++ {
+			fanout[i]++
+		}
+	}
+	binary.Write(&buf, binary.BigEndian, fanout)
+	for _, e := range sorted {
+		rawHash, _ := hex.DecodeString(e.hash)
+		buf.Write(rawHash)
+	}
+	for _, e := range sorted {
+		binary.Write(&buf, binary.BigEndian, e.crc)
+	}
+	var large []uint64
+	for _, e := range sorted {
+		if e.offset < 0x80000000 {
+			binary.Write(&buf, binary.BigEndian, uint32(e.offset))
+			continue
+		}
+		binary.Write(&buf, binary.BigEndian, uint32(0x80000000|len(large)))
+		large = append(large, uint64(e.offset))
+	}
+	binary.Write(&buf, binary.BigEndian, large)
+	buf.Write(packChecksum)
+	idxChecksum := sha1.Sum(buf.Bytes())
+	buf.Write(idxChecksum[:])
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+	return n, err
+}
+
+// List hashes of all loose objects.
+func ListLoose() ([]string, error) {
+	objectDir, err := common.GetGitSubdir("objects")
+	if err != nil {
+		return nil, err
+	}
+	dirEntries, err := os.ReadDir(objectDir)
+	if err != nil {
+		return nil, err
+	}
+	var hashes []string
+	for _, d := range dirEntries {
+		if !d.IsDir() || len(d.Name()) != 2 || !isHex(d.Name()) {
+			continue
+		}
+		files, err := os.ReadDir(filepath.Join(objectDir, d.Name()))
+		if err != nil {
+			return nil, err
+		}
+		for _, f := range files {
+			if hash := d.Name() + f.Name(); len(hash) == 40 && isHex(hash) {
+				hashes = append(hashes, hash)
+			}
+		}
+	}
+	return hashes, nil
+}
+
+// List hashes of all packed objects, sorted.
+func ListPacked() ([]string, error) {
+	packs, err := getPacks(true)
+	if err != nil {
+		return nil, err
+	}
+	seen := make(map[string]bool)
+	var hashes []string
+	for _, p := range packs {
+		for i := 0; i < p.count(); i++ {
+			if hash := p.hashAt(i); !seen[hash] {
+				seen[hash] = true
+				hashes = append(hashes, hash)
+			}
+		}
+	}
+	sort.Strings(hashes)
+	return hashes, nil
+}
+
+// List names of all packs, e.g. "pack-<checksum>".
+func ListPacks() ([]string, error) {
+	packs, err := getPacks(true)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, p := range packs {
+		names = append(names, strings.TrimSuffix(filepath.Base(p.path), ".pack"))
+	}
+	return names, nil
+}
+
+// Remove a pack and its index. The index goes first, so that readers never
+// find an index without its pack.
+func RemovePack(name string) error {
+	objectDir, err := common.GetGitSubdir("objects")
+	if err != nil {
+		return err
+	}
+	packPath := filepath.Join(objectDir, packDirName, name)
+	if err := os.Remove(packPath + ".idx"); err != nil {
+		return err
+	}
+	if err := os.Remove(packPath + ".pack"); err != nil {
+		return err
+	}
+	_, err = getPacks(true)
+	return err
+}
+
+// Remove loose objects which are stored in packs as well. Returns number of
+// removed objects.
+func PrunePacked() (int, error) {
+	loose, err := ListLoose()
+	if err != nil {
+		return 0, err
+	}
+	removed := 0
+	for _, hash := range loose {
+		packed, err := isPacked(hash)
+		if err != nil {
+			return removed, err
+		}
+		if !packed {
+			continue
+		}
+		if err := RemoveLoose(hash); err != nil {
+			return removed, err
+		}
+		removed++
+	}
+	return removed, nil
+}
+
+// Get file info of a loose object.
+func StatLoose(hash string) (os.FileInfo, error) {
+	objectDir, err := common.GetGitSubdir("objects")
+	if err != nil {
+		return nil, err
+	}
+	objectSubDir, objectName, err := common.SplitHash(hash)
+	if err != nil {
+		return nil, err
+	}
+	return os.Stat(filepath.Join(objectDir, objectSubDir, objectName))
+}
+
+// Store a copy of an object as a loose one, with given modification time.
+// It lets packed objects outlive their pack.
+func Loosen(hash string, modTime time.Time) error {
+	objectType, size, r, err := Open(hash)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	header := fmt.Sprintf(HeaderFmt, objectType, size)
+	if err := writeLoose(hash, io.MultiReader(strings.NewReader(header), r)); err != nil {
+		return err
+	}
+	objectDir, err := common.GetGitSubdir("objects")
+	if err != nil {
+		return err
+	}
+	return os.Chtimes(filepath.Join(objectDir, hash[:2], hash[2:]), modTime, modTime)
+}
+
+// Remove a loose object, together with its directory once it is empty.
+func RemoveLoose(hash string) error {
+	objectDir, err := common.GetGitSubdir("objects")
+	if err != nil {
+		return err
+	}
+	objectSubDir, objectName, err := common.SplitHash(hash)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(filepath.Join(objectDir, objectSubDir, objectName)); err != nil {
+		return err
+	}
+	// Fails for directories which still hold other objects.
+	os.Remove(filepath.Join(objectDir, objectSubDir))
+	return nil
+}
+
+// Remove temporary files of objects and packs last modified before expire,
+// left behind by writers which crashed. Younger ones might still be written
+// to.
+func RemoveTempFiles(expire time.Time) error {
+	objectDir, err := common.GetGitSubdir("objects")
+	if err != nil {
+		return err
+	}
+	for _, pattern := range []string{
+		filepath.Join(objectDir, looseTempPrefix+"*"),
+		filepath.Join(objectDir, packDirName, packTempPrefix+"*"),
+		filepath.Join(objectDir, packDirName, idxTempPrefix+"*"),
+	} {
+		paths, err := filepath.Glob(pattern)
+		if err != nil {
+			return err
+		}
+		for _, path := range paths {
+			fi, err := os.Stat(path)
+			if os.IsNotExist(err) {
+				continue
+			} else if err != nil {
+				return err
+			}
+			if !fi.ModTime().Before(expire) {
+				continue
+			}
+			if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func isHex(s string) bool {
+	_, err := hex.DecodeString(s)
+	return err == nil
+}
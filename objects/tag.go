@@ -0,0 +1,108 @@
+package objects
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/antoniszczepanik/gggit/common"
+	"github.com/antoniszczepanik/gggit/config"
+)
+
+const TagObject ObjectType = "tag"
+
+// Annotated tag, pointing at another object together with a name, who
+// created it and a message.
+type Tag struct {
+	Object string
+	// Type of the object the tag points at.
+	Type   ObjectType
+	Name   string
+	Tagger common.Author
+	// Time the tag was created at, in tagger's time zone.
+	Time time.Time
+	Msg  string
+}
+
+func (t Tag) GetContent() (string, error) {
+	content := fmt.Sprintf("object %s\ntype %s\ntag %s\n", t.Object, t.Type, t.Name)
+	content += fmt.Sprintf("tagger %s\n\n", formatAuthor(t.Tagger, t.Time))
+	content += fmt.Sprintf("%s\n", t.Msg)
+	return content, nil
+}
+
+func (t Tag) GetType() ObjectType {
+	return TagObject
+}
+
+func (t Tag) Write() error {
+	return Write(t)
+}
+
+func ReadTag(hash string) (Tag, error) {
+	rawContent, err := getObjectRawContent(hash)
+	if err != nil {
+		return Tag{}, err
+	}
+	objectType, _, content, err := splitRawContent(rawContent)
+	if err != nil {
+		return Tag{}, err
+	}
+	if objectType != TagObject {
+		return Tag{}, fmt.Errorf("could not read tag %s: invalid object type '%s'", hash, objectType)
+	}
+	return parseTag(content)
+}
+
+// Parse tag content, which is laid out just like commit content.
+func parseTag(content string) (Tag, error) {
+	var (
+		t   Tag
+		err error
+	)
+	headers, message := content, ""
+	if i := strings.Index(content, "\n\n"); i != -1 {
+		headers, message = content[:i], content[i+2:]
+	}
+	for _, line := range strings.Split(headers, "\n") {
+		values := strings.SplitN(line, " ", 2)
+		if len(values) != 2 {
+			return Tag{}, fmt.Errorf("malformed tag header %q", line)
+		}
+		switch values[0] {
+		case "object":
+			t.Object = values[1]
+		case "type":
+			t.Type = ObjectType(values[1])
+		case "tag":
+			t.Name = values[1]
+		case "tagger":
+			t.Tagger, t.Time, err = parseAuthor(values[1])
+			if err != nil {
+				return Tag{}, err
+			}
+		}
+	}
+	if t.Object == "" || t.Type == "" || t.Name == "" {
+		return Tag{}, errors.New("tag is missing object, type or name")
+	}
+	t.Msg = strings.TrimSuffix(message, "\n")
+	return t, nil
+}
+
+func CreateTagObject(object string, objectType ObjectType, name, message string) (Tag, error) {
+	now := time.Now().Truncate(time.Second)
+	tagger, tagTime, err := config.GetIdentity(common.CommitterRole, now)
+	if err != nil {
+		return Tag{}, err
+	}
+	return Tag{
+		Object: object,
+		Type:   objectType,
+		Name:   name,
+		Tagger: tagger,
+		Time:   tagTime,
+		Msg:    message,
+	}, nil
+}
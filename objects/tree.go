@@ -1,21 +1,23 @@
 package objects
 
 import (
+	"context"
 	"errors"
 	"fmt"
-	"io"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 
 	"github.com/antoniszczepanik/gggit/common"
+	"github.com/antoniszczepanik/gggit/ignore"
 )
 
 const TreeObject ObjectType = "tree"
 
-type Tree []treeEntry
+type Tree []TreeEntry
 
-type treeEntry struct {
+type TreeEntry struct {
 	Mode  string
 	Hash  string
 	Name  string
@@ -24,13 +26,70 @@ type treeEntry struct {
 
 const treeEntryFmt = "%s %s %s\t%s"
 
+// File modes of tree entries.
+const (
+	ModeTree       = "040000"
+	ModeRegular    = "100644"
+	ModeExecutable = "100755"
+	ModeSymlink    = "120000"
+	// Submodule commits, which are found only in git's own repositories.
+	ModeGitlink = "160000"
+)
+
+// Get type of object a tree entry with given mode points at.
+func TypeFromMode(mode string) ObjectType {
+	switch mode {
+	case ModeTree:
+		return TreeObject
+	case ModeGitlink:
+		return CommitObject
+	}
+	return BlobObject
+}
+
+// Get mode a file should be stored with. Files executable by their owner
+// are stored as executable, any other permission bits are dropped.
+func ModeFromFileInfo(fi os.FileInfo) string {
+	switch {
+	case fi.IsDir():
+		return ModeTree
+	case fi.Mode()&os.ModeSymlink != 0:
+		return ModeSymlink
+	case fi.Mode()&0100 != 0:
+		return ModeExecutable
+	}
+	return ModeRegular
+}
+
+// Create a tree entry, calculating hash of the object it points at.
+func NewTreeEntry(mode, name string, o Object) (TreeEntry, error) {
+	hash, err := CalculateHash(o)
+	if err != nil {
+		return TreeEntry{}, err
+	}
+	return TreeEntry{Mode: mode, Hash: hash, Name: name, Entry: o}, nil
+}
+
+// Serialize tree in the format of the current repository.
 func (t Tree) GetContent() (string, error) {
-	content := ""
 	for _, e := range t {
-		if e.Mode == "" || e.Hash == "" || e.Name == "" || e.Entry == nil {
+		if e.Mode == "" || e.Hash == "" || e.Name == "" {
 			return "", errors.New("cannot get content of tree with missing attributes")
 		}
-		entryContent := fmt.Sprintf(treeEntryFmt+"\n", e.Mode, e.Entry.GetType(), e.Hash, e.Name)
+	}
+	format, err := CurrentTreeFormat()
+	if err != nil {
+		return "", err
+	}
+	if format == GitTreeFormat {
+		return encodeGitTree(t)
+	}
+	content := ""
+	for _, e := range t {
+		if strings.ContainsAny(e.Name, "\t\n") {
+			return "", fmt.Errorf("name %q cannot be stored in %s tree format, use %s format", e.Name, TextTreeFormat, GitTreeFormat)
+		}
+		entryContent := fmt.Sprintf(treeEntryFmt+"\n", e.Mode, TypeFromMode(e.Mode), e.Hash, e.Name)
 		content += entryContent
 	}
 	return content, nil
@@ -50,6 +109,9 @@ func (t Tree) Write() error {
 		if Exists(tEntry.Hash) == nil {
 			continue
 		}
+		if tEntry.Entry == nil {
+			return fmt.Errorf("object %s of %s is missing", tEntry.Hash, tEntry.Name)
+		}
 		if err := tEntry.Entry.Write(); err != nil {
 			return err
 		}
@@ -57,117 +119,194 @@ func (t Tree) Write() error {
 	return nil
 }
 
-// Write out tree entries to working directory aka. checokut.
-// atPath is a path of a directory tree objects should be written to.
-// func (t Tree) UpdateWorkdir(atPath string) error {
-//	for _, tEntry := range t {
-//		entry := tEntry.Entry
-//		entryType := entry.GetType()
-//		if entryType == blob {
-//			_, err := entry.GetContent()
-//			if err != nil {
-//				return err
-//			}
-//			fmt.Printf("Would write contents to %s\n", atPath + tEntry.Name)
-//		} else if entryType == tree {
-//			if err := entry.UpdateWorkdir(atPath+tEntry.Name); err != nil {
-//				return err
-//			}
-//		}
-//	}
-//	return nil
-//}
+func ReadTree(hash string) (Tree, error) {
+	o, err := Read(hash)
+	if err != nil {
+		return Tree{}, err
+	}
+	t, ok := o.(Tree)
+	if !ok {
+		return Tree{}, fmt.Errorf("object %s is a %s, not a tree", hash, o.GetType())
+	}
+	return t, nil
+}
 
-func parseTree(contents string) (Tree, error) {
-	var (
-		t         Tree
-		entryMode string
-		entryType string
-		entryHash string
-		entryName string
-	)
-	rawEntries := strings.Split(contents, "\n")
-	for _, rawEntry := range rawEntries {
-		r := strings.NewReader(rawEntry)
-		_, err := fmt.Fscanf(r, treeEntryFmt, &entryMode, &entryType, &entryHash, &entryName)
-		if err == io.EOF {
-			break
+// Recursively collect all non-tree entries keyed by their slash separated
+// path relative to the root of the tree.
+func (t Tree) Flatten() (map[string]TreeEntry, error) {
+	entries := make(map[string]TreeEntry)
+	if err := t.flatten("", entries); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+func (t Tree) flatten(prefix string, entries map[string]TreeEntry) error {
+	for _, e := range t {
+		if e.Mode != ModeTree {
+			entries[prefix+e.Name] = e
+			continue
+		}
+		subtree, ok := e.Entry.(Tree)
+		if !ok {
+			var err error
+			subtree, err = ReadTree(e.Hash)
+			if err != nil {
+				return err
+			}
+		}
+		if err := subtree.flatten(prefix+e.Name+"/", entries); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Build a tree out of entries keyed by slash separated paths, creating all
+// intermediate subtrees. It is the inverse of Flatten.
+func NewTreeFromEntries(entries map[string]TreeEntry) (Tree, error) {
+	paths := make([]string, 0, len(entries))
+	for path := range entries {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	return newTreeFromSortedEntries(entries, paths, "")
+}
+
+// Build a tree out of sorted paths that all share the same prefix.
+func newTreeFromSortedEntries(entries map[string]TreeEntry, paths []string, prefix string) (Tree, error) {
+	var t Tree
+	for i := 0; i < len(paths); {
+		name := strings.TrimPrefix(paths[i], prefix)
+		slash := strings.Index(name, "/")
+		if slash == -1 {
+			e := entries[paths[i]]
+			e.Name = name
+			t = append(t, e)
+			i++
+			continue
 		}
+		// Gather all entries inside of this subdirectory.
+		dirName := name[:slash]
+		dirPrefix := prefix + dirName + "/"
+		j := i
+		for j < len(paths) && strings.HasPrefix(paths[j], dirPrefix) {
+			j++
+		}
+		subtree, err := newTreeFromSortedEntries(entries, paths[i:j], dirPrefix)
 		if err != nil {
-			return Tree{}, err
+			return nil, err
 		}
-		entryObj, err := Read(entryHash)
+		e, err := NewTreeEntry(ModeTree, dirName, subtree)
 		if err != nil {
-			return Tree{}, err
+			return nil, err
+		}
+		t = append(t, e)
+		i = j
+	}
+	// Entries have to be ordered by their name, just like entries of trees
+	// built from a working directory.
+	sort.SliceStable(t, func(i, j int) bool { return t[i].Name < t[j].Name })
+	// A file and a directory of the same name cannot both be stored.
+	for i := 1; i < len(t); i++ {
+		if t[i].Name == t[i-1].Name {
+			return nil, fmt.Errorf("%s is both a file and a directory", prefix+t[i].Name)
 		}
-		t = append(t, treeEntry{Mode: entryMode, Hash: entryHash, Name: entryName, Entry: entryObj})
 	}
 	return t, nil
 }
 
-var ErrEmptyTree = errors.New("cannot create an empty tree")
-
-func NewTreeFromDirectory(dirpath string) (Tree, error) {
-	if fi, err := os.Stat(dirpath); err != nil || !fi.IsDir() {
-		return Tree{}, errors.New("cannot create tree from a file")
+// Find an entry by slash separated path relative to the root of the tree.
+func (t Tree) Find(path string) (TreeEntry, bool, error) {
+	name, rest := path, ""
+	if i := strings.Index(path, "/"); i != -1 {
+		name, rest = path[:i], path[i+1:]
 	}
-	dirEntries, err := os.ReadDir(dirpath)
+	for _, e := range t {
+		if e.Name != name {
+			continue
+		}
+		if rest == "" {
+			return e, true, nil
+		}
+		if e.Mode != ModeTree {
+			return TreeEntry{}, false, nil
+		}
+		subtree, ok := e.Entry.(Tree)
+		if !ok {
+			var err error
+			subtree, err = ReadTree(e.Hash)
+			if err != nil {
+				return TreeEntry{}, false, err
+			}
+		}
+		return subtree.Find(rest)
+	}
+	return TreeEntry{}, false, nil
+}
+
+// Parse tree in the format of the current repository. Objects entries point
+// at are not read, subtrees are read only when needed.
+func parseTree(contents string) (Tree, error) {
+	format, err := CurrentTreeFormat()
 	if err != nil {
 		return Tree{}, err
 	}
-	// Ignore directories without any entries.
-	if len(dirEntries) == 0 {
-		return Tree{}, ErrEmptyTree
+	if format == GitTreeFormat {
+		return decodeGitTree(contents)
 	}
+	return decodeTextTree(contents)
+}
+
+// Decode text tree entries, without reading objects they point at. Names
+// extend to the end of the line, so they may contain spaces.
+func decodeTextTree(contents string) (Tree, error) {
 	var t Tree
-	for _, dirEntry := range dirEntries {
-		dirEntryPath := filepath.Join(dirpath, dirEntry.Name())
+	for _, line := range strings.Split(strings.TrimSuffix(contents, "\n"), "\n") {
+		if line == "" {
+			break
+		}
 		var (
-			object Object
-			mode   string
-			err    error
+			entryMode string
+			entryType string
+			entryHash string
 		)
-		// TODO: I hate this if. Refactor it, please!
-		if dirEntry.IsDir() {
-			// TODO: Should be handled by .gitignore not hardcoded.
-			if dirEntry.Name() == common.GitDirName {
-				continue
-			}
-			object, err = NewTreeFromDirectory(dirEntryPath)
-			// Once more: we skip empty trees.
-			if errors.Is(err, ErrEmptyTree) {
-				continue
-			} else if err != nil {
-				return Tree{}, err
-			}
-			mode = "040000" // directory aka tree
-		} else {
-			object, err = NewBlobFromFile(dirEntryPath)
-			if err != nil {
-				return Tree{}, err
-			}
-			// TODO: Handle all permission bits properly.
-			// 100755 - executable
-			// 120000 - symlink
-			mode = "100644" // normal file
+		tab := strings.Index(line, "\t")
+		if tab == -1 {
+			return Tree{}, fmt.Errorf("malformed tree entry %q", line)
 		}
-		hash, err := CalculateHash(object)
-		if err != nil {
-			return Tree{}, err
+		if _, err := fmt.Sscanf(line[:tab], "%s %s %s", &entryMode, &entryType, &entryHash); err != nil {
+			return Tree{}, fmt.Errorf("malformed tree entry %q: %w", line, err)
+		}
+		if ObjectType(entryType) != TypeFromMode(entryMode) {
+			return Tree{}, fmt.Errorf("tree entry %q has type %s, but mode of a %s", line, entryType, TypeFromMode(entryMode))
 		}
-		t = append(t, treeEntry{
-			Mode:  mode,
-			Hash:  hash,
-			Name:  dirEntry.Name(),
-			Entry: object,
-		})
+		t = append(t, TreeEntry{Mode: entryMode, Hash: entryHash, Name: line[tab+1:]})
 	}
 	return t, nil
 }
 
-// Assumes caller verified that path points at a directory.
-func HashTree(path string, write bool) (string, error) {
-	t, err := NewTreeFromDirectory(path)
+var ErrEmptyTree = errors.New("cannot create an empty tree")
+
+// Assumes caller verified that path points at a directory. Inside
+// a repository ignored paths are skipped. Files are hashed, and written,
+// by as many workers as configured with core.parallelism.
+func HashTree(ctx context.Context, path string, write bool) (string, error) {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	var m *ignore.Matcher
+	if repoRoot, err := common.GetRepoRoot(path); err == nil {
+		if m, err = ignore.New(repoRoot); err != nil {
+			return "", err
+		}
+	}
+	workers, err := Parallelism()
+	if err != nil {
+		return "", err
+	}
+	t, err := BuildTreeFromDirectory(ctx, path, m, workers, write)
 	if errors.Is(err, ErrEmptyTree) {
 		return "", errors.New("directory is empty")
 	} else if err != nil {
@@ -0,0 +1,95 @@
+package objects
+
+import (
+	"testing"
+
+	"github.com/antoniszczepanik/gggit/internal/testrepo"
+)
+
+func TestNewTreeFromEntries(t *testing.T) {
+	testrepo.Init(t)
+	blob := func(content string) TreeEntry {
+		e, err := NewTreeEntry(ModeRegular, "", NewBlob(content))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return e
+	}
+	tests := []struct {
+		name    string
+		paths   []string
+		wantErr bool
+	}{
+		{"flat", []string{"a", "b"}, false},
+		{"nested", []string{"a", "d/x", "d/y/z", "d-x", "d.txt"}, false},
+		{"file and directory", []string{"d", "d/x"}, true},
+		{"file and nested directory", []string{"a/d", "a/d/x/y"}, true},
+	}
+	for _, test := range tests {
+		entries := make(map[string]TreeEntry)
+		for _, path := range test.paths {
+			entries[path] = blob(path)
+		}
+		tree, err := NewTreeFromEntries(entries)
+		if test.wantErr {
+			if err == nil {
+				t.Errorf("%s: built a tree with a file and a directory of the same name", test.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		flat, err := tree.Flatten()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(flat) != len(entries) {
+			t.Errorf("%s: tree has %d files, want %d", test.name, len(flat), len(entries))
+		}
+		for path, e := range entries {
+			if flat[path].Hash != e.Hash {
+				t.Errorf("%s: %s has hash %s, want %s", test.name, path, flat[path].Hash, e.Hash)
+			}
+		}
+	}
+}
+
+func TestReadTreeIsLazy(t *testing.T) {
+	testrepo.Init(t)
+	file, err := NewTreeEntry(ModeRegular, "file", NewBlob("content\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tree, err := NewTreeFromEntries(map[string]TreeEntry{"file": file, "dir/file": file})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Only the root tree is written, objects it points at are missing.
+	if err := Write(tree); err != nil {
+		t.Fatal(err)
+	}
+	hash, err := CalculateHash(tree)
+	if err != nil {
+		t.Fatal(err)
+	}
+	read, err := ReadTree(hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(read) != 2 {
+		t.Fatalf("read %d entries, want 2", len(read))
+	}
+	for i, e := range read {
+		if e.Name != tree[i].Name || e.Hash != tree[i].Hash {
+			t.Errorf("read entry %s %s, want %s %s", e.Name, e.Hash, tree[i].Name, tree[i].Hash)
+		}
+		if e.Entry != nil {
+			t.Errorf("object of entry %s was read", e.Name)
+		}
+	}
+	if _, _, err := read.Find("dir/file"); err == nil {
+		t.Errorf("found an entry of a missing subtree")
+	}
+}
@@ -0,0 +1,223 @@
+package objects
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
+
+	"github.com/antoniszczepanik/gggit/config"
+	"github.com/antoniszczepanik/gggit/ignore"
+)
+
+// Config key with number of files read and hashed concurrently when
+// building trees out of directories. Zero, the default, uses all CPUs.
+const ParallelismKey = "core.parallelism"
+
+// Get number of workers hashing files, from configuration.
+func Parallelism() (int, error) {
+	c, err := config.Load()
+	if err != nil {
+		return 0, err
+	}
+	n, err := c.GetInt(ParallelismKey, 0)
+	if err != nil {
+		return 0, err
+	}
+	if n < 0 {
+		return 0, fmt.Errorf("%s cannot be negative", ParallelismKey)
+	}
+	if n == 0 {
+		n = runtime.NumCPU()
+	}
+	return n, nil
+}
+
+// Build a tree from contents of a directory, skipping ignored paths, with
+// files read, hashed and, if asked to, written by a pool of workers. Nil
+// matcher skips only the git directory. The directory is walked first, so
+// that entries end up in the same order, and the tree hashes the same,
+// whatever the number of workers.
+func BuildTreeFromDirectory(ctx context.Context, dirpath string, m *ignore.Matcher, workers int, write bool) (Tree, error) {
+	if fi, err := os.Stat(dirpath); err != nil || !fi.IsDir() {
+		return Tree{}, errors.New("cannot create tree from a file")
+	}
+	var files []*pendingEntry
+	root, err := walkDirectory(ctx, dirpath, m, &files)
+	if err != nil {
+		return Tree{}, err
+	}
+	// Ignore directories without any entries.
+	if root == nil {
+		return Tree{}, ErrEmptyTree
+	}
+	if err := hashFiles(ctx, files, workers, write); err != nil {
+		return Tree{}, err
+	}
+	return root.tree()
+}
+
+// Write blobs of files, given by their paths and infos, with a pool of
+// workers. Returns hashes of the blobs in the same order.
+func WriteBlobs(ctx context.Context, paths []string, infos []os.FileInfo, workers int) ([]string, error) {
+	files := make([]*pendingEntry, len(paths))
+	for i, path := range paths {
+		blob, err := NewBlobFromPath(path, infos[i])
+		if err != nil {
+			return nil, err
+		}
+		files[i] = &pendingEntry{name: path, blob: blob}
+	}
+	if err := hashFiles(ctx, files, workers, true); err != nil {
+		return nil, err
+	}
+	hashes := make([]string, len(files))
+	for i, file := range files {
+		hashes[i] = file.hash
+	}
+	return hashes, nil
+}
+
+// Directory entry whose hash is not known yet. Directories have their
+// pending entries, files a blob to be hashed.
+type pendingEntry struct {
+	name    string
+	mode    string
+	entries []*pendingEntry
+	blob    Blob
+	hash    string
+}
+
+// Collect entries of a directory, appending files to be hashed. Returns nil
+// for directories without any entries, even nested ones.
+func walkDirectory(ctx context.Context, dirpath string, m *ignore.Matcher, files *[]*pendingEntry) (*pendingEntry, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	dirEntries, err := os.ReadDir(dirpath)
+	if err != nil {
+		return nil, err
+	}
+	dir := &pendingEntry{mode: ModeTree}
+	for _, dirEntry := range dirEntries {
+		dirEntryPath := filepath.Join(dirpath, dirEntry.Name())
+		ignored, err := m.IsIgnoredFile(dirEntryPath, dirEntry.IsDir())
+		if err != nil {
+			return nil, err
+		} else if ignored {
+			continue
+		}
+		// Unlike os.Stat, entry info describes symlinks themselves.
+		fi, err := dirEntry.Info()
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case dirEntry.IsDir():
+			subdir, err := walkDirectory(ctx, dirEntryPath, m, files)
+			if err != nil {
+				return nil, err
+			}
+			// Once more: we skip empty trees.
+			if subdir == nil {
+				continue
+			}
+			subdir.name = dirEntry.Name()
+			dir.entries = append(dir.entries, subdir)
+		case fi.Mode().IsRegular() || fi.Mode()&os.ModeSymlink != 0:
+			blob, err := NewBlobFromPath(dirEntryPath, fi)
+			if err != nil {
+				return nil, err
+			}
+			file := &pendingEntry{name: dirEntry.Name(), mode: ModeFromFileInfo(fi), blob: blob}
+			dir.entries = append(dir.entries, file)
+			*files = append(*files, file)
+		default:
+			// Sockets, devices and the like cannot be stored.
+		}
+	}
+	if len(dir.entries) == 0 {
+		return nil, nil
+	}
+	return dir, nil
+}
+
+// Hash, and write if asked to, files with given number of workers. The first
+// error stops all of them.
+func hashFiles(ctx context.Context, files []*pendingEntry, workers int, write bool) error {
+	if workers < 1 {
+		workers = 1
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var (
+		wg       sync.WaitGroup
+		errOnce  sync.Once
+		firstErr error
+	)
+	jobs := make(chan *pendingEntry)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for file := range jobs {
+				if err := file.hashFile(ctx, write); err != nil {
+					errOnce.Do(func() { firstErr = err })
+					cancel()
+				}
+			}
+		}()
+	}
+feed:
+	for _, file := range files {
+		select {
+		case jobs <- file:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(jobs)
+	wg.Wait()
+	if firstErr != nil {
+		return firstErr
+	}
+	// Cancelled by the caller rather than by a failed worker.
+	return ctx.Err()
+}
+
+func (e *pendingEntry) hashFile(ctx context.Context, write bool) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	var err error
+	if write {
+		e.hash, err = writeObject(e.blob)
+	} else {
+		e.hash, err = CalculateHash(e.blob)
+	}
+	return err
+}
+
+// Turn hashed entries of a directory into a tree, hashing its subtrees.
+func (e *pendingEntry) tree() (Tree, error) {
+	t := make(Tree, 0, len(e.entries))
+	for _, entry := range e.entries {
+		if entry.mode != ModeTree {
+			t = append(t, TreeEntry{Mode: entry.mode, Hash: entry.hash, Name: entry.name, Entry: entry.blob})
+			continue
+		}
+		subtree, err := entry.tree()
+		if err != nil {
+			return nil, err
+		}
+		hash, err := CalculateHash(subtree)
+		if err != nil {
+			return nil, err
+		}
+		t = append(t, TreeEntry{Mode: ModeTree, Hash: hash, Name: entry.name, Entry: subtree})
+	}
+	return t, nil
+}
@@ -0,0 +1,117 @@
+package objects
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/antoniszczepanik/gggit/config"
+	"github.com/antoniszczepanik/gggit/internal/testrepo"
+)
+
+// Create nested directories with files of varying content, including empty
+// ones, an executable and a symlink.
+func writeTestDirectory(t *testing.T, root string) {
+	t.Helper()
+	for i := 0; i < 200; i++ {
+		path := filepath.Join(root, fmt.Sprintf("d%d", i%7), fmt.Sprintf("s%d", i%3), fmt.Sprintf("f%d", i))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		content := fmt.Sprintf("file %d\n", i)
+		if i%10 == 0 {
+			content = ""
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(root, "run"), []byte("#!/bin/sh\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("run", filepath.Join(root, "link")); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func setParallelism(t *testing.T, workers int) {
+	t.Helper()
+	path, err := config.ScopePath(config.LocalScope)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := config.Set(path, ParallelismKey, strconv.Itoa(workers)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestHashTreeParallelism(t *testing.T) {
+	root := testrepo.Init(t)
+	dir := filepath.Join(root, "dir")
+	writeTestDirectory(t, dir)
+	var want string
+	for _, workers := range []int{1, 2, 8, 64} {
+		setParallelism(t, workers)
+		for _, write := range []bool{false, true} {
+			hash, err := HashTree(context.Background(), dir, write)
+			if err != nil {
+				t.Fatalf("%d workers: %v", workers, err)
+			}
+			if want == "" {
+				want = hash
+			} else if hash != want {
+				t.Errorf("%d workers, write %v: tree hashes to %s, want %s", workers, write, hash, want)
+			}
+		}
+	}
+	// All objects were written, the tree can be read back whole.
+	tree, err := ReadTree(want)
+	if err != nil {
+		t.Fatal(err)
+	}
+	files, err := tree.Flatten()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for path, e := range files {
+		if err := Exists(e.Hash); err != nil {
+			t.Errorf("blob of %s: %v", path, err)
+		}
+	}
+}
+
+func TestWriteBlobsParallelism(t *testing.T) {
+	root := testrepo.Init(t)
+	writeTestDirectory(t, root)
+	var paths []string
+	var infos []os.FileInfo
+	err := filepath.Walk(root, func(path string, fi os.FileInfo, err error) error {
+		if err != nil || fi.IsDir() {
+			return err
+		}
+		paths = append(paths, path)
+		infos = append(infos, fi)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := WriteBlobs(context.Background(), paths, infos, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, workers := range []int{2, 8, 64} {
+		hashes, err := WriteBlobs(context.Background(), paths, infos, workers)
+		if err != nil {
+			t.Fatalf("%d workers: %v", workers, err)
+		}
+		for i := range hashes {
+			if hashes[i] != want[i] {
+				t.Errorf("%d workers: %s hashes to %s, want %s", workers, paths[i], hashes[i], want[i])
+			}
+		}
+	}
+}
@@ -0,0 +1,138 @@
+package objects
+
+import (
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/antoniszczepanik/gggit/common"
+	"github.com/antoniszczepanik/gggit/config"
+)
+
+type TreeFormat string
+
+const (
+	// Human readable "<mode> <type> <hash>\t<name>" lines. Names cannot
+	// contain tabs or new lines.
+	TextTreeFormat TreeFormat = "text"
+	// Git's "<mode> <name>\0<20 byte hash>" entries in git's order, so that
+	// trees, and hence commits, hash identically to those of git.
+	GitTreeFormat TreeFormat = "git"
+)
+
+// Config key selecting tree format of a repository.
+const TreeFormatKey = "extensions.treeFormat"
+
+var (
+	treeFormat     TreeFormat
+	treeFormatErr  error
+	treeFormatOnce sync.Once
+)
+
+// Get format trees of the current repository are stored in. It is read
+// once, as it cannot change during repository lifetime, and only from the
+// repository's own configuration, as it describes the repository rather
+// than preferences of its user. Git's own repositories always use git
+// format.
+func CurrentTreeFormat() (TreeFormat, error) {
+	treeFormatOnce.Do(func() {
+		if common.IsForeignRepo() {
+			treeFormat = GitTreeFormat
+			return
+		}
+		path, err := config.ScopePath(config.LocalScope)
+		if err != nil {
+			// Outside of a repository, trees can only be hashed.
+			treeFormat = TextTreeFormat
+			return
+		}
+		var c *config.Config
+		c, treeFormatErr = config.LoadFile(path, config.LocalScope)
+		if treeFormatErr != nil {
+			return
+		}
+		var format string
+		format, treeFormatErr = c.Get(TreeFormatKey, string(TextTreeFormat))
+		treeFormat, treeFormatErr = ParseTreeFormat(format)
+	})
+	return treeFormat, treeFormatErr
+}
+
+// Check that tree format of the current repository can be changed, which is
+// only the case before any objects are stored, as existing trees would no
+// longer be readable.
+func CheckTreeFormatChangeable() error {
+	loose, err := ListLoose()
+	if err != nil {
+		return err
+	}
+	packs, err := ListPacks()
+	if err != nil {
+		return err
+	}
+	if len(loose) > 0 || len(packs) > 0 {
+		return fmt.Errorf("cannot change %s of a repository which already has objects", TreeFormatKey)
+	}
+	return nil
+}
+
+func ParseTreeFormat(format string) (TreeFormat, error) {
+	switch TreeFormat(strings.ToLower(format)) {
+	case TextTreeFormat:
+		return TextTreeFormat, nil
+	case GitTreeFormat:
+		return GitTreeFormat, nil
+	}
+	return "", fmt.Errorf("unknown tree format %q", format)
+}
+
+// Encode entries in git's binary format. Git stores tree modes without
+// a leading zero and sorts entries as if names of trees ended with a slash.
+func encodeGitTree(t Tree) (string, error) {
+	sorted := append(Tree{}, t...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return gitSortName(sorted[i]) < gitSortName(sorted[j])
+	})
+	var b strings.Builder
+	for _, e := range sorted {
+		rawHash, err := hex.DecodeString(e.Hash)
+		if err != nil || len(rawHash) != 20 {
+			return "", fmt.Errorf("invalid hash %q of tree entry %s", e.Hash, e.Name)
+		}
+		fmt.Fprintf(&b, "%s %s\x00", strings.TrimPrefix(e.Mode, "0"), e.Name)
+		b.Write(rawHash)
+	}
+	return b.String(), nil
+}
+
+func gitSortName(e TreeEntry) string {
+	if e.Mode == ModeTree {
+		return e.Name + "/"
+	}
+	return e.Name
+}
+
+// Decode git's binary tree entries, without reading objects they point at.
+func decodeGitTree(content string) (Tree, error) {
+	var t Tree
+	for len(content) > 0 {
+		space := strings.IndexByte(content, ' ')
+		nul := strings.IndexByte(content, 0)
+		if space == -1 || nul == -1 || nul < space || len(content) < nul+21 {
+			return nil, fmt.Errorf("malformed tree entry %q", content)
+		}
+		mode := content[:space]
+		if len(mode) == 5 {
+			mode = "0" + mode
+		}
+		t = append(t, TreeEntry{
+			Mode: mode,
+			Name: content[space+1 : nul],
+			Hash: hex.EncodeToString([]byte(content[nul+1 : nul+21])),
+		})
+		content = content[nul+21:]
+	}
+	return t, nil
+}
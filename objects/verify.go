@@ -0,0 +1,197 @@
+package objects
+
+import (
+	"crypto/sha1"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Read an object verifying that its content hashes to its name, and parse
+// it strictly. Unlike Read, objects that trees point at are never read, so
+// that missing ones can be told apart from corrupt trees. Type is returned
+// whenever the header could be read, even if the object is corrupt.
+func Verify(hash string) (ObjectType, Object, error) {
+	objectType, size, r, err := Open(hash)
+	if err != nil {
+		return "", nil, err
+	}
+	defer r.Close()
+	if objectType == BlobObject {
+		return objectType, Blob{hash: hash}, verifyStream(hash, objectType, size, r)
+	}
+	var sb strings.Builder
+	if err := verifyStream(hash, objectType, size, io.TeeReader(r, &sb)); err != nil {
+		return objectType, nil, err
+	}
+	content := sb.String()
+	var o Object
+	switch objectType {
+	case BlobObject:
+		o, err = parseBlob(content)
+	case TreeObject:
+		o, err = parseTreeStrict(content)
+	case CommitObject:
+		if err = checkCommit(content); err == nil {
+			o, err = parseCommit(content)
+		}
+	case TagObject:
+		if err = checkTag(content); err == nil {
+			o, err = parseTag(content)
+		}
+	default:
+		err = fmt.Errorf("unexpected object type %s", objectType)
+	}
+	return objectType, o, err
+}
+
+// Hash content of an object as it is read, so that blobs never have to fit
+// in memory.
+func verifyStream(hash string, objectType ObjectType, size int64, r io.Reader) error {
+	h := sha1.New()
+	fmt.Fprintf(h, HeaderFmt, objectType, size)
+	if _, err := io.Copy(h, r); err != nil {
+		return err
+	}
+	if actual := fmt.Sprintf("%x", h.Sum(nil)); actual != hash {
+		return fmt.Errorf("content hashes to %s", actual)
+	}
+	return nil
+}
+
+// Decode a tree without reading its entries and check that they could have
+// been written by us: known modes, valid hashes and names, in order.
+func parseTreeStrict(content string) (Tree, error) {
+	format, err := CurrentTreeFormat()
+	if err != nil {
+		return nil, err
+	}
+	var t Tree
+	if format == GitTreeFormat {
+		t, err = decodeGitTree(content)
+	} else {
+		t, err = decodeTextTree(content)
+	}
+	if err != nil {
+		return nil, err
+	}
+	for i, e := range t {
+		switch e.Mode {
+		case ModeTree, ModeRegular, ModeExecutable, ModeSymlink, ModeGitlink:
+		default:
+			return nil, fmt.Errorf("entry %q has unknown mode %s", e.Name, e.Mode)
+		}
+		if !isHash(e.Hash) {
+			return nil, fmt.Errorf("entry %q has invalid hash %q", e.Name, e.Hash)
+		}
+		if e.Name == "" || e.Name == "." || e.Name == ".." || strings.ContainsAny(e.Name, "/\x00") {
+			return nil, fmt.Errorf("entry has invalid name %q", e.Name)
+		}
+		if i == 0 {
+			continue
+		}
+		prev := t[i-1]
+		if prev.Name == e.Name {
+			return nil, fmt.Errorf("duplicate entry %q", e.Name)
+		}
+		ordered := prev.Name < e.Name
+		if format == GitTreeFormat {
+			ordered = gitSortName(prev) < gitSortName(e)
+		}
+		if !ordered {
+			return nil, fmt.Errorf("entry %q is out of order", e.Name)
+		}
+	}
+	return t, nil
+}
+
+// Check that commit headers start with a tree, parents, author and
+// committer, in that order. Any other headers may follow.
+func checkCommit(content string) error {
+	lines, err := headerLines(content)
+	if err != nil {
+		return err
+	}
+	value, lines, err := expectHeader(lines, "tree")
+	if err != nil {
+		return err
+	}
+	if !isHash(value) {
+		return fmt.Errorf("invalid tree hash %q", value)
+	}
+	for len(lines) > 0 && strings.HasPrefix(lines[0], "parent ") {
+		if value = strings.TrimPrefix(lines[0], "parent "); !isHash(value) {
+			return fmt.Errorf("invalid parent hash %q", value)
+		}
+		lines = lines[1:]
+	}
+	for _, key := range []string{"author", "committer"} {
+		if value, lines, err = expectHeader(lines, key); err != nil {
+			return err
+		}
+		if _, _, err := parseAuthor(value); err != nil {
+			return fmt.Errorf("invalid %s: %w", key, err)
+		}
+	}
+	return nil
+}
+
+// Check that tag headers start with an object, its type, tag name and,
+// except for very old tags, a tagger.
+func checkTag(content string) error {
+	lines, err := headerLines(content)
+	if err != nil {
+		return err
+	}
+	value, lines, err := expectHeader(lines, "object")
+	if err != nil {
+		return err
+	}
+	if !isHash(value) {
+		return fmt.Errorf("invalid object hash %q", value)
+	}
+	if value, lines, err = expectHeader(lines, "type"); err != nil {
+		return err
+	}
+	switch ObjectType(value) {
+	case BlobObject, TreeObject, CommitObject, TagObject:
+	default:
+		return fmt.Errorf("invalid object type %q", value)
+	}
+	if value, lines, err = expectHeader(lines, "tag"); err != nil {
+		return err
+	}
+	if value == "" {
+		return errors.New("empty tag name")
+	}
+	if len(lines) > 0 && strings.HasPrefix(lines[0], "tagger ") {
+		if _, _, err := parseAuthor(strings.TrimPrefix(lines[0], "tagger ")); err != nil {
+			return fmt.Errorf("invalid tagger: %w", err)
+		}
+	}
+	return nil
+}
+
+// Split headers of a commit or a tag, which have to be followed by an empty
+// line, into lines.
+func headerLines(content string) ([]string, error) {
+	end := strings.Index(content, "\n\n")
+	if end == -1 {
+		return nil, errors.New("no empty line after headers")
+	}
+	return strings.Split(content[:end], "\n"), nil
+}
+
+// Get value of the first header line, which has to have given key.
+func expectHeader(lines []string, key string) (string, []string, error) {
+	if len(lines) == 0 || !strings.HasPrefix(lines[0], key+" ") {
+		return "", nil, fmt.Errorf("missing %s header", key)
+	}
+	return strings.TrimPrefix(lines[0], key+" "), lines[1:], nil
+}
+
+// Check that s is a full, lower case hash.
+func isHash(s string) bool {
+	return len(s) == 40 && isHex(s) && strings.ToLower(s) == s
+}
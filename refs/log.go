@@ -0,0 +1,319 @@
+package refs
+
+import (
+	"bufio"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/user"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/antoniszczepanik/gggit/common"
+	"github.com/antoniszczepanik/gggit/config"
+)
+
+const (
+	logsDirName = "logs"
+	headLogFile = logsDirName + "/HEAD"
+	checkoutMsg = "checkout: moving from "
+)
+
+// Hash recorded in logs for refs that did not exist before or after an
+// update. Ref updates expect it for refs that must not exist yet.
+const ZeroHash = "0000000000000000000000000000000000000000"
+
+// Record a move of HEAD in its log.
+func LogHeadUpdate(oldHash, newHash, msg string) error {
+	return LogRefUpdate("HEAD", oldHash, newHash, msg)
+}
+
+// Append an update of a ref, given by its full name or "HEAD", to its log,
+// one "<old> <new> <identity> <time>\t<msg>" line per update. Missing
+// hashes are recorded as zeros.
+func LogRefUpdate(refName, oldHash, newHash, msg string) error {
+	logPath, err := common.GetGitFilePath(logsDirName + "/" + refName)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(logPath), 0755); err != nil {
+		return err
+	}
+	who, when := logIdentity()
+	if oldHash == "" {
+		oldHash = ZeroHash
+	}
+	if newHash == "" {
+		newHash = ZeroHash
+	}
+	f, err := os.OpenFile(logPath, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	entry := LogEntry{Old: oldHash, New: newHash, Who: who, Time: when, Msg: msg}
+	if _, err := f.WriteString(entry.String()); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// Single update of a ref, as recorded in its log.
+type LogEntry struct {
+	Old  string
+	New  string
+	Who  common.Author
+	Time time.Time
+	Msg  string
+}
+
+// Format entry as a line of a log, including the line feed.
+func (e LogEntry) String() string {
+	return fmt.Sprintf("%s %s %s <%s> %s\t%s\n", e.Old, e.New, e.Who.Name, e.Who.Email, common.FormatTimestamp(e.Time), e.Msg)
+}
+
+func parseLogEntry(line string) (LogEntry, error) {
+	header, msg := line, ""
+	if tab := strings.Index(line, "\t"); tab != -1 {
+		header, msg = line[:tab], line[tab+1:]
+	}
+	fields := strings.SplitN(header, " ", 3)
+	if len(fields) < 3 || len(fields[0]) != len(ZeroHash) || len(fields[1]) != len(ZeroHash) {
+		return LogEntry{}, fmt.Errorf("malformed log entry %q", line)
+	}
+	emailStart := strings.Index(fields[2], "<")
+	emailEnd := strings.LastIndex(fields[2], ">")
+	if emailStart == -1 || emailEnd < emailStart {
+		return LogEntry{}, fmt.Errorf("malformed log entry %q", line)
+	}
+	date := strings.Fields(fields[2][emailEnd+1:])
+	if len(date) != 2 {
+		return LogEntry{}, fmt.Errorf("malformed log entry %q", line)
+	}
+	when, err := common.ParseTimestamp(date[0], date[1])
+	if err != nil {
+		return LogEntry{}, err
+	}
+	return LogEntry{
+		Old: fields[0],
+		New: fields[1],
+		Who: common.Author{
+			Name:  strings.TrimSpace(fields[2][:emailStart]),
+			Email: fields[2][emailStart+1 : emailEnd],
+		},
+		Time: when,
+		Msg:  msg,
+	}, nil
+}
+
+// Read log of a ref, given by its full name or "HEAD", most recent entry
+// first. Refs without a log have no entries.
+func ReadLog(refName string) ([]LogEntry, error) {
+	f, err := common.GetGitFile(logsDirName + "/" + refName)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var entries []LogEntry
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if scanner.Text() == "" {
+			continue
+		}
+		e, err := parseLogEntry(scanner.Text())
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	for i, j := 0, len(entries)-1; i < j; i, j = i+1, j-1 {
+		entries[i], entries[j] = entries[j], entries[i]
+	}
+	return entries, nil
+}
+
+// List full names of refs that have logs, with "HEAD" first if it has one.
+func ListLogs() ([]string, error) {
+	logsDir, err := common.GetGitFilePath(logsDirName)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	err = filepath.WalkDir(logsDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		name, err := filepath.Rel(logsDir, path)
+		if err != nil {
+			return err
+		}
+		names = append(names, filepath.ToSlash(name))
+		return nil
+	})
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(names, func(i, j int) bool {
+		return names[i] == "HEAD" && names[j] != "HEAD"
+	})
+	return names, nil
+}
+
+// Config key with the time before which log entries are expired.
+const ReflogExpireKey = "gc.reflogExpire"
+
+const DefaultReflogExpire = "90.days.ago"
+
+// Get time before which log entries are expired, from configuration unless
+// given explicitly.
+func ReflogExpire(value string) (time.Time, error) {
+	if value == "" {
+		c, err := config.Load()
+		if err != nil {
+			return time.Time{}, err
+		}
+		if value, err = c.Get(ReflogExpireKey, DefaultReflogExpire); err != nil {
+			return time.Time{}, err
+		}
+	}
+	return common.ParseApproxDate(value, time.Now())
+}
+
+// Remove entries recorded before given time from log of a ref, unless
+// dryRun is set. Returns number of expired entries.
+func ExpireLog(refName string, before time.Time, dryRun bool) (int, error) {
+	entries, err := ReadLog(refName)
+	if err != nil {
+		return 0, err
+	}
+	var kept strings.Builder
+	expired := 0
+	// Entries are most recent first, the log is oldest first.
+	for i := len(entries) - 1; i >= 0; i-- {
+		if entries[i].Time.Before(before) {
+			expired++
+			continue
+		}
+		kept.WriteString(entries[i].String())
+	}
+	if expired == 0 || dryRun {
+		return expired, nil
+	}
+	if err := common.CheckWritable(); err != nil {
+		return 0, err
+	}
+	logPath, err := common.GetGitFilePath(logsDirName + "/" + refName)
+	if err != nil {
+		return 0, err
+	}
+	tmpPath := logPath + ".lock"
+	if err := os.WriteFile(tmpPath, []byte(kept.String()), 0644); err != nil {
+		return 0, err
+	}
+	if err := os.Rename(tmpPath, logPath); err != nil {
+		os.Remove(tmpPath)
+		return 0, err
+	}
+	return expired, nil
+}
+
+// Collect hashes recorded in all logs, old and new ones alike.
+func LoggedHashes() ([]string, error) {
+	logsDir, err := common.GetGitFilePath(logsDirName)
+	if err != nil {
+		return nil, err
+	}
+	var hashes []string
+	err = filepath.WalkDir(logsDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			fields := strings.SplitN(scanner.Text(), " ", 3)
+			if len(fields) < 3 {
+				continue
+			}
+			for _, hash := range fields[:2] {
+				if hash != ZeroHash {
+					hashes = append(hashes, hash)
+				}
+			}
+		}
+		return scanner.Err()
+	})
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	return hashes, err
+}
+
+// Log entries should not fail just because identity is not configured, fall
+// back to the system user in such case.
+func logIdentity() (common.Author, time.Time) {
+	now := time.Now().Truncate(time.Second)
+	who, when, err := config.GetIdentity(common.CommitterRole, now)
+	if err == nil {
+		return who, when
+	}
+	name := "unknown"
+	if u, err := user.Current(); err == nil {
+		name = u.Username
+	}
+	host, err := os.Hostname()
+	if err != nil {
+		host = "localhost"
+	}
+	return common.Author{Name: name, Email: name + "@" + host}, now
+}
+
+// Get names of branches HEAD was switched away from, most recent first.
+// Detached HEAD is recorded as a commit hash.
+func CheckoutHistory() ([]string, error) {
+	f, err := common.GetGitFile(headLogFile)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var history []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+		tab := strings.Index(line, "\t")
+		if tab == -1 || !strings.HasPrefix(line[tab+1:], checkoutMsg) {
+			continue
+		}
+		move := strings.TrimPrefix(line[tab+1:], checkoutMsg)
+		if to := strings.Index(move, " to "); to != -1 {
+			history = append(history, move[:to])
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	for i, j := 0, len(history)-1; i < j; i, j = i+1, j-1 {
+		history[i], history[j] = history[j], history[i]
+	}
+	return history, nil
+}
+
+// Record switching HEAD from one branch or commit to another.
+func LogCheckout(oldHash, newHash, from, to string) error {
+	return LogHeadUpdate(oldHash, newHash, checkoutMsg+from+" to "+to)
+}
@@ -0,0 +1,74 @@
+package refs
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/antoniszczepanik/gggit/common"
+)
+
+const (
+	mergeHeadFile = "MERGE_HEAD"
+	mergeMsgFile  = "MERGE_MSG"
+)
+
+var ErrNoMergeInProgress = errors.New("there is no merge in progress")
+
+// Record commit being merged and the default message for a merge commit,
+// so that it can be concluded by a commit once conflicts are resolved.
+func StartMerge(commitHash, msg string) error {
+	mergeHeadPath, err := common.GetGitFilePath(mergeHeadFile)
+	if err != nil {
+		return err
+	}
+	mergeMsgPath, err := common.GetGitFilePath(mergeMsgFile)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(mergeHeadPath, []byte(commitHash+"\n"), 0644); err != nil {
+		return fmt.Errorf("write merge head: %w", err)
+	}
+	if err := os.WriteFile(mergeMsgPath, []byte(msg), 0644); err != nil {
+		return fmt.Errorf("write merge message: %w", err)
+	}
+	return nil
+}
+
+// Get hash of commit being merged and the default merge commit message.
+func ReadMergeHead() (string, string, error) {
+	mergeHeadPath, err := common.GetGitFilePath(mergeHeadFile)
+	if err != nil {
+		return "", "", err
+	}
+	content, err := os.ReadFile(mergeHeadPath)
+	if os.IsNotExist(err) {
+		return "", "", ErrNoMergeInProgress
+	} else if err != nil {
+		return "", "", err
+	}
+	mergeMsgPath, err := common.GetGitFilePath(mergeMsgFile)
+	if err != nil {
+		return "", "", err
+	}
+	msg, err := os.ReadFile(mergeMsgPath)
+	if err != nil && !os.IsNotExist(err) {
+		return "", "", err
+	}
+	return strings.TrimSpace(string(content)), string(msg), nil
+}
+
+// Remove merge state once the merge is concluded.
+func FinishMerge() error {
+	for _, name := range []string{mergeHeadFile, mergeMsgFile} {
+		path, err := common.GetGitFilePath(name)
+		if err != nil {
+			return err
+		}
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,40 @@
+package refs
+
+import (
+	"bufio"
+	"os"
+	"strings"
+
+	"github.com/antoniszczepanik/gggit/common"
+)
+
+// Refs can be stored together in a single file, one "<hash> <refname>" per
+// line, instead of a file each. Lines starting with '#' are comments, those
+// starting with '^' hold objects annotated tags above them peel to. Loose
+// refs take precedence over packed ones.
+const packedRefsFile = "packed-refs"
+
+// Read all packed refs, keyed by their full names.
+func readPackedRefs() (map[string]string, error) {
+	f, err := common.GetGitFile(packedRefsFile)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	packed := make(map[string]string)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" || line[0] == '#' || line[0] == '^' {
+			continue
+		}
+		space := strings.Index(line, " ")
+		if space == -1 {
+			continue
+		}
+		packed[line[space+1:]] = line[:space]
+	}
+	return packed, scanner.Err()
+}
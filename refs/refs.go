@@ -5,8 +5,11 @@ import (
 	"regexp"
 	"fmt"
 	"io"
+	"io/fs"
 	"os"
 	"path/filepath"
+	"sort"
+	"strings"
 
 	"github.com/antoniszczepanik/gggit/common"
 	"github.com/antoniszczepanik/gggit/objects"
@@ -17,7 +20,7 @@ var ErrMissingRef = errors.New("HEAD points to a missing ref")
 var ErrDetachedHead = errors.New("HEAD is in detached mode")
 
 var refRegex = regexp.MustCompile(
-	`ref: refs/(?P<type>heads|tags|remotes)/(?P<name>[a-zA-Z1-9-_]+$)`,
+	`^ref: refs/(?P<type>heads|tags|remotes)/(?P<name>\S+)$`,
 )
 
 type headPointer struct {
@@ -42,7 +45,7 @@ func (hp headPointer) hash() (string, error) {
 }
 
 func (hp headPointer) detached() (bool, error) {
-	if len(hp.content) < len("ref: refs/heads/a\n") {
+	if len(strings.TrimSpace(hp.content)) < len("ref: refs/heads/a") {
 		return false, errors.New("head points to invalid ref")
 	}
 	if hp.content[:5] == "ref: " {
@@ -86,7 +89,8 @@ func readHeadPointer() (headPointer, error) {
 
 // Parse from contents of HEAD file into ref type and ref name.
 func parseRef(headContent string) (string, string, error) {
-	match := refRegex.FindStringSubmatch(headContent)
+	// Git terminates HEAD with a line feed, gggit does not.
+	match := refRegex.FindStringSubmatch(strings.TrimSpace(headContent))
 	if match == nil || len(match) != 3 {
 		fmt.Printf("Cannot parse head content: %s\n", headContent)
 		return "", "", fmt.Errorf("parse head content: %s", headContent)
@@ -118,25 +122,21 @@ func GetHeadCommitHash() (string, error) {
 
 var ErrBranchWithoutHash = errors.New("branch does not have any commits yet")
 
-// Returns empty string if ref does not exist yet.
+// Returns ErrBranchWithoutHash if ref does not exist yet.
 func ReadBranchHash(branchName string) (string, error) {
-	branchRefPath := getRefPath(branchName)
-	ref, err := common.GetGitFile(branchRefPath)
-	if err != nil{
+	hash, err := ReadRef(getRefPath(branchName))
+	if err == ErrRefNotFound {
 		return "", ErrBranchWithoutHash
 	}
-	defer ref.Close()
-
-	content, err := io.ReadAll(ref)
-	if err != nil {
-		return "", err
-	}
-	return removeLastChar(string(content)), nil
+	return hash, err
 }
 
 // Create new ref and return it's pointer. Caller is responsible for closing
 // the file.
 func CreateNewRef(name string) (*os.File, error) {
+	if err := common.CheckWritable(); err != nil {
+		return nil, err
+	}
 	headsDir, err := common.GetGitSubdir("refs/heads")
 	if err != nil {
 		return nil, err
@@ -149,55 +149,131 @@ func CreateNewRef(name string) (*os.File, error) {
 	return newRefFile, nil
 }
 
-// Point branch pointer at commit.
-func PointBranchAt(branchName, commitHash string) error {
-	branchRefPath := getRefPath(branchName)
-	branchRefPathAbs, err := common.GetGitFilePath(branchRefPath)
-	if err != nil {
+// Point branch pointer at commit, if it points at oldHash, recording the
+// update with given reason in logs of the branch and, if it is checked out,
+// of HEAD. See RefUpdate for special values of oldHash.
+func PointBranchAt(branchName, commitHash, oldHash, msg string) error {
+	if err := UpdateRef(getRefPath(branchName), commitHash, oldHash, msg); err != nil {
 		return fmt.Errorf("point branch at commit: %w", err)
 	}
+	return nil
+}
 
-	f, err := os.Create(branchRefPathAbs)
-	if err != nil {
-		return fmt.Errorf("overwrite branch pointer file: %w", err)
-	}
-	defer f.Close()
+func PointHeadAtBranch(branchName string) error {
+	return writeRef("HEAD", fmt.Sprintf("ref: %s", getRefPath(branchName)))
+}
 
-	_, err = f.Write([]byte(fmt.Sprintf("%s\n", commitHash)))
-	if err != nil {
-		return err
-	}
+// Point HEAD directly at a commit, detaching it from any branch.
+func DetachHead(commitHash string) error {
+	return writeRef("HEAD", commitHash+"\n")
+}
 
+// Move detached HEAD to a commit, if it points at oldHash, recording the
+// update with given reason in its log.
+func MoveDetachedHead(commitHash, oldHash, msg string) error {
+	if err := UpdateRef("HEAD", commitHash, oldHash, msg); err != nil {
+		return fmt.Errorf("point HEAD at commit: %w", err)
+	}
 	return nil
 }
 
-func PointHeadAtBranch(branchName string) error {
-	headPath, err := common.GetGitFilePath("HEAD")
-	if err != nil {
-		return err
+var ErrRefNotFound = errors.New("ref does not exist")
+
+// Longest chain of symbolic refs followed.
+const maxSymrefDepth = 5
+
+// Read hash a ref points at, by its full name, e.g. "refs/heads/master".
+// Packed refs are read if there is no loose one. Symbolic refs, like
+// "refs/remotes/origin/HEAD", are followed.
+func ReadRef(refName string) (string, error) {
+	return readRef(refName, 0)
+}
+
+func readRef(refName string, depth int) (string, error) {
+	if depth > maxSymrefDepth {
+		return "", fmt.Errorf("too many levels of symbolic refs at %s", refName)
 	}
-	f, err := os.Create(headPath)
+	refPath, err := common.GetGitFilePath(refName)
 	if err != nil {
-		return err
+		return "", err
 	}
-	defer f.Close()
-	_, err = f.Write([]byte(fmt.Sprintf("ref: %s", getRefPath(branchName))))
+	if fi, err := os.Stat(refPath); os.IsNotExist(err) || (err == nil && fi.IsDir()) {
+		packed, err := readPackedRefs()
+		if err != nil {
+			return "", err
+		}
+		if hash, ok := packed[refName]; ok {
+			return hash, nil
+		}
+		return "", ErrRefNotFound
+	}
+	content, err := os.ReadFile(refPath)
 	if err != nil {
-		return err
+		return "", err
 	}
-	return nil
+	value := strings.TrimSpace(string(content))
+	if target := strings.TrimPrefix(value, "ref: "); target != value {
+		return readRef(target, depth+1)
+	}
+	return value, nil
 }
 
 func Exists(branchName string) bool {
-	branchRefPath := getRefPath(branchName)
-	branchRefPathAbs, err := common.GetGitFilePath(branchRefPath)
+	_, err := ReadRef(getRefPath(branchName))
+	return err == nil
+}
+
+// List names of all branches, sorted.
+func ListBranches() ([]string, error) {
+	return listRefs("refs/heads")
+}
+
+// List full names of all refs, e.g. "refs/heads/master", sorted.
+func ListAllRefs() ([]string, error) {
+	names, err := listRefs("refs")
+	for i := range names {
+		names[i] = "refs/" + names[i]
+	}
+	return names, err
+}
+
+// List names of refs in a directory, loose and packed, relative to it and
+// sorted.
+func listRefs(dir string) ([]string, error) {
+	refsDir, err := common.GetGitFilePath(dir)
 	if err != nil {
-		return false
+		return nil, err
+	}
+	found := make(map[string]bool)
+	err = filepath.WalkDir(refsDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		name, err := filepath.Rel(refsDir, path)
+		if err != nil {
+			return err
+		}
+		found[filepath.ToSlash(name)] = true
+		return nil
+	})
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	packed, err := readPackedRefs()
+	if err != nil {
+		return nil, err
+	}
+	for refName := range packed {
+		if name := strings.TrimPrefix(refName, dir+"/"); name != refName {
+			found[name] = true
+		}
 	}
-	if _, err := os.Stat(branchRefPathAbs); os.IsNotExist(err) {
-		return false
+	names := make([]string, 0, len(found))
+	for name := range found {
+		names = append(names, name)
 	}
-	return true
+	sort.Strings(names)
+	return names, nil
 }
 
 func getRefPath(branchName string) string {
@@ -0,0 +1,33 @@
+package refs
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/antoniszczepanik/gggit/internal/testrepo"
+)
+
+func TestMoveDetachedHead(t *testing.T) {
+	testrepo.Init(t)
+	if err := DetachHead(hashA); err != nil {
+		t.Fatal(err)
+	}
+	var moved *RefMovedError
+	if err := MoveDetachedHead(hashB, hashB, "commit: stale"); !errors.As(err, &moved) {
+		t.Errorf("got error %v, want HEAD to have moved", err)
+	}
+	if err := MoveDetachedHead(hashB, hashA, "commit: detached"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := GetCurrentBranch(); err != ErrDetachedHead {
+		t.Errorf("got error %v, want HEAD to stay detached", err)
+	}
+	checkRef(t, "HEAD", hashB)
+	log, err := ReadLog("HEAD")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(log) != 1 || log[0].Old != hashA || log[0].New != hashB || log[0].Msg != "commit: detached" {
+		t.Errorf("got log %v, want a single move from %s to %s", log, hashA, hashB)
+	}
+}
@@ -0,0 +1,126 @@
+package refs
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/antoniszczepanik/gggit/common"
+)
+
+const tagsDir = "refs/tags"
+
+var ErrTagNotFound = errors.New("tag not found")
+
+// List names of all tags, sorted.
+func ListTags() ([]string, error) {
+	return listRefs(tagsDir)
+}
+
+// Read hash of an object a tag points at, which is either a tag object for
+// annotated tags, or any other object for lightweight ones.
+func ReadTagHash(name string) (string, error) {
+	refName, err := tagRefName(name)
+	if err != nil {
+		return "", err
+	}
+	hash, err := ReadRef(refName)
+	if err == ErrRefNotFound {
+		return "", ErrTagNotFound
+	}
+	return hash, err
+}
+
+func TagExists(name string) bool {
+	_, err := ReadTagHash(name)
+	return err == nil
+}
+
+// Create or overwrite a tag.
+func PointTagAt(name, hash string) error {
+	if err := common.CheckWritable(); err != nil {
+		return err
+	}
+	refName, err := tagRefName(name)
+	if err != nil {
+		return err
+	}
+	return writeRef(refName, hash+"\n")
+}
+
+func DeleteTag(name string) error {
+	if err := common.CheckWritable(); err != nil {
+		return err
+	}
+	refName, err := tagRefName(name)
+	if err != nil {
+		return err
+	}
+	tagPath, err := common.GetGitFilePath(refName)
+	if err != nil {
+		return err
+	}
+	tagsRoot, err := common.GetGitFilePath(tagsDir)
+	if err != nil {
+		return err
+	}
+	if !strings.HasPrefix(tagPath, tagsRoot+string(filepath.Separator)) {
+		return fmt.Errorf("tag '%s' is outside of %s", name, tagsDir)
+	}
+	if err := os.Remove(tagPath); os.IsNotExist(err) {
+		return ErrTagNotFound
+	} else if err != nil {
+		return err
+	}
+	// Prune directories of hierarchical tag names, e.g. "release/v1".
+	for dir := filepath.Dir(tagPath); dir != tagsRoot; dir = filepath.Dir(dir) {
+		if os.Remove(dir) != nil {
+			break
+		}
+	}
+	return nil
+}
+
+// Get full name of the ref of a tag. Invalid names are refused, so that
+// tags never point outside of the tags directory.
+func tagRefName(name string) (string, error) {
+	if err := ValidateRefName(name); err != nil {
+		return "", err
+	}
+	return tagsDir + "/" + name, nil
+}
+
+// Check that a name can be used for a branch or a tag. Rules are a subset of
+// those of git check-ref-format.
+func ValidateRefName(name string) error {
+	invalid := func(reason string) error {
+		return fmt.Errorf("'%s' is not a valid ref name: %s", name, reason)
+	}
+	switch {
+	case name == "" || name == "@":
+		return invalid("name is empty or reserved")
+	case strings.HasPrefix(name, "-"):
+		return invalid("name starts with a dash")
+	case strings.HasPrefix(name, "/") || strings.HasSuffix(name, "/") || strings.Contains(name, "//"):
+		return invalid("empty path component")
+	case strings.Contains(name, "..") || strings.Contains(name, "@{"):
+		return invalid("name contains '..' or '@{'")
+	case strings.HasSuffix(name, ".") || strings.HasSuffix(name, ".lock"):
+		return invalid("name ends with '.' or '.lock'")
+	case strings.ContainsAny(name, " ~^:?*[\\\x7f"):
+		return invalid("name contains a forbidden character")
+	}
+	for _, component := range strings.Split(name, "/") {
+		if strings.HasPrefix(component, ".") {
+			return invalid("path component starts with '.'")
+		}
+	}
+	for _, c := range name {
+		if c < ' ' {
+			return invalid("name contains a control character")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,243 @@
+package refs
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/antoniszczepanik/gggit/common"
+)
+
+var ErrRefLocked = errors.New("ref is locked, another gggit process may be running")
+
+// Returned when a ref does not have the value an update expected, because
+// someone else moved it in the meantime.
+type RefMovedError struct {
+	Ref      string
+	Expected string
+	// Current hash, empty if the ref does not exist.
+	Actual string
+}
+
+func (e *RefMovedError) Error() string {
+	switch {
+	case e.Expected == ZeroHash:
+		return fmt.Sprintf("ref %s already exists at %s", e.Ref, e.Actual)
+	case e.Actual == "":
+		return fmt.Sprintf("ref %s does not exist, expected it at %s", e.Ref, e.Expected)
+	}
+	return fmt.Sprintf("ref %s moved: expected it at %s, but it is at %s", e.Ref, e.Expected, e.Actual)
+}
+
+type RefUpdate struct {
+	// Full name of the ref, e.g. "refs/heads/master", or "HEAD".
+	Ref string
+	New string
+	// Hash the ref is expected to point at, ZeroHash if it must not exist
+	// yet, or empty to update it whatever it points at.
+	Old string
+	// Reason recorded in the log of the ref.
+	Msg string
+}
+
+// Set of ref updates applied all together or not at all.
+type Transaction struct {
+	updates []RefUpdate
+}
+
+func (t *Transaction) Update(refName, newHash, oldHash, msg string) {
+	t.updates = append(t.updates, RefUpdate{Ref: refName, New: newHash, Old: oldHash, Msg: msg})
+}
+
+// Apply all updates. Every ref is locked and checked against its expected
+// value before any of them is written, so a ref which moved or is being
+// updated by another process fails the whole transaction and leaves all
+// refs untouched. Each ref is written to its lock file, synced and renamed
+// into place, so it is never seen partially written. Should any rename
+// fail, refs renamed before it are put back. Logs are appended only once
+// all refs are in place.
+func (t *Transaction) Commit() error {
+	if err := common.CheckWritable(); err != nil {
+		return err
+	}
+	updates := append([]RefUpdate{}, t.updates...)
+	// Always lock in the same order, so that concurrent transactions fail
+	// the same way.
+	sort.SliceStable(updates, func(i, j int) bool { return updates[i].Ref < updates[j].Ref })
+	for i, u := range updates {
+		if i > 0 && updates[i-1].Ref == u.Ref {
+			return fmt.Errorf("ref %s updated more than once in a transaction", u.Ref)
+		}
+		if len(u.New) != len(ZeroHash) || u.New == ZeroHash {
+			return fmt.Errorf("invalid hash %q for ref %s", u.New, u.Ref)
+		}
+	}
+	locks := make([]*lockFile, 0, len(updates))
+	defer func() {
+		for _, l := range locks {
+			l.rollback()
+		}
+	}()
+	oldHashes := make([]string, len(updates))
+	for i, u := range updates {
+		l, err := lockRef(u.Ref)
+		if err != nil {
+			return err
+		}
+		locks = append(locks, l)
+		actual, err := ReadRef(u.Ref)
+		if err == ErrRefNotFound || err == ErrBranchWithoutHash {
+			actual = ""
+		} else if err != nil {
+			return err
+		}
+		if u.Old == ZeroHash && actual != "" || u.Old != "" && u.Old != ZeroHash && u.Old != actual {
+			return &RefMovedError{Ref: u.Ref, Expected: u.Old, Actual: actual}
+		}
+		oldHashes[i] = actual
+	}
+	for i, u := range updates {
+		if err := locks[i].write(u.New + "\n"); err != nil {
+			return err
+		}
+	}
+	currentBranch, err := GetCurrentBranch()
+	if err != nil {
+		currentBranch = ""
+	}
+	for i, u := range updates {
+		if err := locks[i].commit(); err != nil {
+			for j := i - 1; j >= 0; j-- {
+				if restoreErr := locks[j].restore(); restoreErr != nil {
+					return fmt.Errorf("could not update %s: %v, nor restore %s: %w", u.Ref, err, updates[j].Ref, restoreErr)
+				}
+			}
+			return err
+		}
+	}
+	// Refs are updated already, so, like in git, logs failing to be written
+	// only get reported.
+	for i, u := range updates {
+		if err := LogRefUpdate(u.Ref, oldHashes[i], u.New, u.Msg); err != nil {
+			fmt.Fprintf(os.Stderr, "warning: could not log update of %s: %v\n", u.Ref, err)
+		}
+		if currentBranch != "" && u.Ref == getRefPath(currentBranch) {
+			if err := LogHeadUpdate(oldHashes[i], u.New, u.Msg); err != nil {
+				fmt.Fprintf(os.Stderr, "warning: could not log update of HEAD: %v\n", err)
+			}
+		}
+	}
+	return nil
+}
+
+// Update a single ref, if it points at oldHash. See RefUpdate for special
+// values of oldHash.
+func UpdateRef(refName, newHash, oldHash, msg string) error {
+	var t Transaction
+	t.Update(refName, newHash, oldHash, msg)
+	return t.Commit()
+}
+
+// Lock file next to a ref, "<ref>.lock", which new content is written to
+// and then renamed over the ref. Its exclusive creation keeps other
+// processes from updating the ref at the same time.
+type lockFile struct {
+	path string
+	f    *os.File
+	// Content of the ref when it was locked, nil if it did not exist.
+	previous  []byte
+	committed bool
+}
+
+func lockRef(refName string) (*lockFile, error) {
+	path, err := common.GetGitFilePath(refName)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(path+".lock", os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if os.IsExist(err) {
+		return nil, fmt.Errorf("could not update %s: %w (%s exists)", refName, ErrRefLocked, path+".lock")
+	} else if err != nil {
+		return nil, err
+	}
+	l := &lockFile{path: path, f: f}
+	if l.previous, err = os.ReadFile(path); err != nil && !os.IsNotExist(err) {
+		l.rollback()
+		return nil, err
+	}
+	return l, nil
+}
+
+// Write and sync content of the lock file.
+func (l *lockFile) write(content string) error {
+	if _, err := l.f.WriteString(content); err != nil {
+		return err
+	}
+	if err := l.f.Sync(); err != nil {
+		return err
+	}
+	err := l.f.Close()
+	l.f = nil
+	return err
+}
+
+// Rename written lock file over the ref.
+func (l *lockFile) commit() error {
+	if err := os.Rename(l.path+".lock", l.path); err != nil {
+		return err
+	}
+	l.committed = true
+	return nil
+}
+
+// Remove the lock file unless it has been committed already.
+func (l *lockFile) rollback() {
+	if l.f != nil {
+		l.f.Close()
+	}
+	if !l.committed {
+		os.Remove(l.path + ".lock")
+	}
+}
+
+// Put back content the ref had before the lock file was committed, through
+// a new lock file.
+func (l *lockFile) restore() error {
+	if l.previous == nil {
+		if err := os.Remove(l.path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	f, err := os.OpenFile(l.path+".lock", os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return err
+	}
+	restored := &lockFile{path: l.path, f: f}
+	defer restored.rollback()
+	if err := restored.write(string(l.previous)); err != nil {
+		return err
+	}
+	return restored.commit()
+}
+
+// Write a ref, or HEAD, through a lock file, without checking its value.
+func writeRef(refName, content string) error {
+	if err := common.CheckWritable(); err != nil {
+		return err
+	}
+	l, err := lockRef(refName)
+	if err != nil {
+		return err
+	}
+	defer l.rollback()
+	if err := l.write(content); err != nil {
+		return err
+	}
+	return l.commit()
+}
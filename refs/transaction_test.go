@@ -0,0 +1,78 @@
+package refs
+
+import (
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/antoniszczepanik/gggit/internal/testrepo"
+)
+
+const (
+	hashA = "8ab686eafeb1f44702738c8b0f24f2567c36da6d"
+	hashB = "e69de29bb2d1d6434b8b29ae775ad8c2e48c5391"
+)
+
+func checkRef(t *testing.T, refName, want string) {
+	t.Helper()
+	got, err := ReadRef(refName)
+	if want == "" {
+		if err != ErrRefNotFound {
+			t.Errorf("%s points at %q (error %v), want it missing", refName, got, err)
+		}
+		return
+	}
+	if err != nil || got != want {
+		t.Errorf("%s points at %q (error %v), want %s", refName, got, err, want)
+	}
+}
+
+func TestTransactionMovedRef(t *testing.T) {
+	testrepo.Init(t)
+	if err := UpdateRef("refs/heads/b", hashA, ZeroHash, "create"); err != nil {
+		t.Fatal(err)
+	}
+	var tx Transaction
+	tx.Update("refs/heads/a", hashA, ZeroHash, "create")
+	tx.Update("refs/heads/b", hashB, hashB, "move")
+	var moved *RefMovedError
+	if err := tx.Commit(); !errors.As(err, &moved) || moved.Ref != "refs/heads/b" {
+		t.Fatalf("got error %v, want b to have moved", err)
+	}
+	checkRef(t, "refs/heads/a", "")
+	checkRef(t, "refs/heads/b", hashA)
+}
+
+func TestLockFileRestore(t *testing.T) {
+	testrepo.Init(t)
+	if err := UpdateRef("refs/heads/a", hashA, ZeroHash, "create"); err != nil {
+		t.Fatal(err)
+	}
+	var locks []*lockFile
+	for _, refName := range []string{"refs/heads/a", "refs/heads/b"} {
+		l, err := lockRef(refName)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer l.rollback()
+		if err := l.write(hashB + "\n"); err != nil {
+			t.Fatal(err)
+		}
+		if err := l.commit(); err != nil {
+			t.Fatal(err)
+		}
+		locks = append(locks, l)
+	}
+	checkRef(t, "refs/heads/a", hashB)
+	checkRef(t, "refs/heads/b", hashB)
+	for _, l := range locks {
+		if err := l.restore(); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := os.Stat(l.path + ".lock"); !os.IsNotExist(err) {
+			t.Errorf("lock file %s.lock is left behind", l.path)
+		}
+	}
+	checkRef(t, "refs/heads/a", hashA)
+	checkRef(t, "refs/heads/b", "")
+}
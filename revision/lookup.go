@@ -0,0 +1,143 @@
+package revision
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/antoniszczepanik/gggit/common"
+	"github.com/antoniszczepanik/gggit/index"
+	"github.com/antoniszczepanik/gggit/objects"
+	"github.com/antoniszczepanik/gggit/refs"
+)
+
+// Resolve "<rev>:<path>". Paths are relative to repository root, unless
+// they start with "./" or "../".
+func resolvePath(rev, path string) (string, error) {
+	treeHash, err := ResolveTree(rev)
+	if err != nil {
+		return "", err
+	}
+	relPath, err := repoPath(path)
+	if err != nil {
+		return "", err
+	}
+	if relPath == "" {
+		return treeHash, nil
+	}
+	t, err := objects.ReadTree(treeHash)
+	if err != nil {
+		return "", err
+	}
+	e, found, err := t.Find(relPath)
+	if err != nil {
+		return "", err
+	}
+	if !found {
+		return "", fmt.Errorf("path '%s' does not exist in '%s'", relPath, rev)
+	}
+	return e.Hash, nil
+}
+
+// Resolve ":<path>" or ":<stage>:<path>" into a blob staged in the index.
+func resolveIndexPath(expr string) (string, error) {
+	stage := 0
+	if len(expr) > 2 && expr[0] >= '0' && expr[0] <= '3' && expr[1] == ':' {
+		stage = int(expr[0] - '0')
+		expr = expr[2:]
+	}
+	relPath, err := repoPath(expr)
+	if err != nil {
+		return "", err
+	}
+	idx, err := index.Read()
+	if err != nil {
+		return "", err
+	}
+	for _, e := range idx.Entries {
+		if e.Path == relPath && e.Stage == stage {
+			return e.Hash, nil
+		}
+	}
+	if stage != 0 {
+		return "", fmt.Errorf("path '%s' is not in the index at stage %d", relPath, stage)
+	}
+	return "", fmt.Errorf("path '%s' is not in the index", relPath)
+}
+
+func repoPath(path string) (string, error) {
+	if path != "." && path != ".." && !strings.HasPrefix(path, "./") && !strings.HasPrefix(path, "../") {
+		return strings.Trim(path, "/"), nil
+	}
+	repoRoot, err := common.GetRepoRoot("")
+	if err != nil {
+		return "", err
+	}
+	return common.RepoRelPath(repoRoot, path)
+}
+
+// Find the youngest commit reachable from HEAD or any branch, with message
+// matching a regular expression.
+func searchMessage(pattern string) (string, error) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return "", fmt.Errorf("invalid message pattern: %w", err)
+	}
+	var starts []string
+	if head, err := refs.GetHeadCommitHash(); err == nil {
+		starts = append(starts, head)
+	}
+	branches, err := refs.ListBranches()
+	if err != nil {
+		return "", err
+	}
+	for _, branch := range branches {
+		hash, err := refs.ReadBranchHash(branch)
+		if err != nil {
+			return "", err
+		}
+		starts = append(starts, hash)
+	}
+
+	var best string
+	var bestCommit objects.Commit
+	visited := make(map[string]bool)
+	for len(starts) > 0 {
+		hash := starts[len(starts)-1]
+		starts = starts[:len(starts)-1]
+		if visited[hash] {
+			continue
+		}
+		visited[hash] = true
+		c, err := objects.ReadCommit(hash)
+		if err != nil {
+			return "", err
+		}
+		if re.MatchString(c.Msg) && (best == "" || c.CommitTime.After(bestCommit.CommitTime)) {
+			best, bestCommit = hash, c
+		}
+		starts = append(starts, c.Parents...)
+	}
+	if best == "" {
+		return "", fmt.Errorf("no commit message matches %s", pattern)
+	}
+	return best, nil
+}
+
+// Shorten a hash to at least minLength characters, using more if needed to
+// keep it unambiguous.
+func Abbrev(hash string, minLength int) (string, error) {
+	if minLength < MinAbbrev {
+		minLength = MinAbbrev
+	}
+	for length := minLength; length < len(hash); length++ {
+		candidates, err := objects.FindByPrefix(hash[:length])
+		if err != nil {
+			return "", err
+		}
+		if len(candidates) <= 1 {
+			return hash[:length], nil
+		}
+	}
+	return hash, nil
+}
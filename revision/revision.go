@@ -0,0 +1,360 @@
+package revision
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/antoniszczepanik/gggit/common"
+	"github.com/antoniszczepanik/gggit/objects"
+	"github.com/antoniszczepanik/gggit/refs"
+)
+
+// Abbreviated hashes have to be at least that long.
+const MinAbbrev = 4
+
+type AmbiguousError struct {
+	Prefix     string
+	Candidates []string
+}
+
+func (e *AmbiguousError) Error() string {
+	return fmt.Sprintf("short object ID %s is ambiguous, candidates are:\n\t%s", e.Prefix, strings.Join(e.Candidates, "\n\t"))
+}
+
+// Resolve a revision expression into an object hash. Supported forms are:
+//
+//	<hash>, <abbrev>       full or abbreviated hash
+//	HEAD, @, <refname>     HEAD, a tag, a branch, a remote branch or a full ref name
+//	@{-<n>}                n-th branch or commit checked out before the current one
+//	<ref>@{<n>}, @{<n>}    n-th prior value of a ref, or of the current branch
+//	<ref>@{<date>}         value of a ref at a point in time, e.g. @{2.hours.ago}
+//	<rev>~<n>              n-th ancestor, following first parents
+//	<rev>^<n>              n-th parent, ^0 is the commit itself
+//	<rev>^{<type>}, ^{}    object peeled to a type
+//	<rev>:<path>           blob or tree at a path of a tree-ish
+//	:<path>, :<n>:<path>   blob staged in the index, at given stage
+//	:/<regex>              youngest reachable commit with a matching message
+func Resolve(expr string) (string, error) {
+	if strings.HasPrefix(expr, ":/") {
+		return searchMessage(expr[2:])
+	}
+	if strings.HasPrefix(expr, ":") {
+		return resolveIndexPath(expr[1:])
+	}
+	if i := indexOutsideBraces(expr, ":"); i != -1 {
+		return resolvePath(expr[:i], expr[i+1:])
+	}
+	base, suffixes := expr, ""
+	if i := indexOutsideBraces(expr, "~^"); i != -1 {
+		base, suffixes = expr[:i], expr[i:]
+	}
+	hash, err := resolveName(base)
+	if err != nil {
+		return "", err
+	}
+	return applySuffixes(hash, suffixes, expr)
+}
+
+// Resolve an expression into a commit hash.
+func ResolveCommit(expr string) (string, error) {
+	hash, err := Resolve(expr)
+	if err != nil {
+		return "", err
+	}
+	return Peel(hash, objects.CommitObject)
+}
+
+// Resolve an expression into a tree hash. Commits are resolved into their
+// trees.
+func ResolveTree(expr string) (string, error) {
+	hash, err := Resolve(expr)
+	if err != nil {
+		return "", err
+	}
+	return Peel(hash, objects.TreeObject)
+}
+
+// Dereference an object until an object of the wanted type is reached. Tags
+// are peeled to objects they point at and commits to their trees.
+func Peel(hash string, want objects.ObjectType) (string, error) {
+	for {
+		o, err := objects.Read(hash)
+		if err != nil {
+			return "", err
+		}
+		if o.GetType() == want {
+			return hash, nil
+		}
+		switch o := o.(type) {
+		case objects.Tag:
+			hash = o.Object
+			continue
+		case objects.Commit:
+			if want == objects.TreeObject {
+				return o.TreeHash, nil
+			}
+		}
+		return "", fmt.Errorf("object %s is a %s, not a %s", hash, o.GetType(), want)
+	}
+}
+
+// Resolve a name without any suffixes.
+func resolveName(name string) (string, error) {
+	if name == "HEAD" || name == "@" {
+		return refs.GetHeadCommitHash()
+	}
+	if n, ok := ParsePreviousCheckout(name); ok {
+		previous, err := PreviousCheckout(n)
+		if err != nil {
+			return "", err
+		}
+		return resolveName(previous)
+	}
+	if at := strings.Index(name, "@{"); at != -1 && strings.HasSuffix(name, "}") {
+		return resolveLogEntry(name[:at], name[at+2:len(name)-1])
+	}
+	if isHex(name) && len(name) == 40 && objects.Exists(name) == nil {
+		return name, nil
+	}
+	if refName, err := FullRefName(name); err == nil {
+		return refs.ReadRef(refName)
+	} else if err != refs.ErrRefNotFound {
+		return "", err
+	}
+	if isHex(name) && len(name) >= MinAbbrev {
+		candidates, err := objects.FindByPrefix(strings.ToLower(name))
+		if err != nil {
+			return "", err
+		}
+		switch len(candidates) {
+		case 0:
+		case 1:
+			return candidates[0], nil
+		default:
+			return "", &AmbiguousError{Prefix: name, Candidates: candidates}
+		}
+	}
+	return "", fmt.Errorf("unknown revision %s", name)
+}
+
+// Get full name of an existing ref given by a name like "master", "v1.0"
+// or "origin/master". Tags take precedence over branches, just like in Git.
+// HEAD is returned as is.
+func FullRefName(name string) (string, error) {
+	if name == "HEAD" {
+		return name, nil
+	}
+	for _, refName := range []string{name, "refs/" + name, "refs/tags/" + name, "refs/heads/" + name,
+		"refs/remotes/" + name, "refs/remotes/" + name + "/HEAD"} {
+		if !strings.HasPrefix(refName, "refs/") {
+			continue
+		}
+		_, err := refs.ReadRef(refName)
+		if err == nil {
+			return refName, nil
+		} else if err != refs.ErrRefNotFound {
+			return "", err
+		}
+	}
+	return "", refs.ErrRefNotFound
+}
+
+// Resolve "<ref>@{<n>}" and "<ref>@{<date>}" using log of the ref. No ref
+// stands for the current branch. Entry 0 is the current value, which is
+// known even if the log has been expired.
+func resolveLogEntry(name, selector string) (string, error) {
+	refName := "HEAD"
+	if name == "" {
+		if branch, err := refs.GetCurrentBranch(); err == nil {
+			refName = "refs/heads/" + branch
+		} else if err != refs.ErrDetachedHead {
+			return "", err
+		}
+	} else if name != "@" {
+		var err error
+		if refName, err = FullRefName(name); err != nil {
+			return "", fmt.Errorf("unknown revision %s@{%s}", name, selector)
+		}
+	}
+	entries, err := refs.ReadLog(refName)
+	if err != nil {
+		return "", err
+	}
+	if n, err := strconv.Atoi(selector); err == nil && n >= 0 {
+		switch {
+		case n < len(entries):
+			return entries[n].New, nil
+		case n == 0:
+			return resolveName(refName)
+		}
+		return "", fmt.Errorf("log for %s only has %d entries", refName, len(entries))
+	}
+	when, err := common.ParseApproxDate(selector, time.Now())
+	if err != nil {
+		return "", fmt.Errorf("invalid revision %s@{%s}: %v", name, selector, err)
+	}
+	if len(entries) == 0 {
+		return "", fmt.Errorf("log for %s is empty", refName)
+	}
+	for _, e := range entries {
+		if !e.Time.After(when) {
+			return e.New, nil
+		}
+	}
+	// Before the first update the ref had its old value, if it existed.
+	oldest := entries[len(entries)-1]
+	if oldest.Old == refs.ZeroHash {
+		return "", fmt.Errorf("log for %s only goes back to %s", refName, oldest.Time.Format(time.RFC1123Z))
+	}
+	return oldest.Old, nil
+}
+
+// Parse "@{-<n>}" expression, reports false for anything else.
+func ParsePreviousCheckout(expr string) (int, bool) {
+	if !strings.HasPrefix(expr, "@{-") || !strings.HasSuffix(expr, "}") {
+		return 0, false
+	}
+	n, err := strconv.Atoi(expr[3 : len(expr)-1])
+	if err != nil || n < 1 {
+		return 0, false
+	}
+	return n, true
+}
+
+// Get name of the n-th branch checked out before the current one, or
+// a commit hash if HEAD was detached back then.
+func PreviousCheckout(n int) (string, error) {
+	history, err := refs.CheckoutHistory()
+	if err != nil {
+		return "", err
+	}
+	if n > len(history) {
+		return "", fmt.Errorf("@{-%d}: only %d checkout(s) in the history", n, len(history))
+	}
+	return history[n-1], nil
+}
+
+// Apply "~<n>", "^<n>" and "^{<type>}" suffixes one after another.
+func applySuffixes(hash, suffixes, expr string) (string, error) {
+	for len(suffixes) > 0 {
+		op := suffixes[0]
+		suffixes = suffixes[1:]
+		if op == '^' && strings.HasPrefix(suffixes, "{") {
+			end := strings.Index(suffixes, "}")
+			if end == -1 {
+				return "", fmt.Errorf("invalid revision %s", expr)
+			}
+			var err error
+			if hash, err = peelTo(hash, suffixes[1:end]); err != nil {
+				return "", err
+			}
+			suffixes = suffixes[end+1:]
+			continue
+		}
+		if op != '^' && op != '~' {
+			return "", fmt.Errorf("invalid revision %s", expr)
+		}
+		digits := len(suffixes) - len(strings.TrimLeft(suffixes, "0123456789"))
+		n := 1
+		if digits > 0 {
+			var err error
+			if n, err = strconv.Atoi(suffixes[:digits]); err != nil {
+				return "", fmt.Errorf("invalid revision %s", expr)
+			}
+			suffixes = suffixes[digits:]
+		}
+		commitHash, err := Peel(hash, objects.CommitObject)
+		if err != nil {
+			return "", err
+		}
+		if op == '~' {
+			hash, err = nthAncestor(commitHash, n, expr)
+		} else {
+			hash, err = nthParent(commitHash, n, expr)
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+	return hash, nil
+}
+
+func nthAncestor(hash string, n int, expr string) (string, error) {
+	for i := 0; i < n; i++ {
+		c, err := objects.ReadCommit(hash)
+		if err != nil {
+			return "", err
+		}
+		if len(c.Parents) == 0 {
+			return "", fmt.Errorf("unknown revision %s, history is not that long", expr)
+		}
+		hash = c.Parents[0]
+	}
+	return hash, nil
+}
+
+func nthParent(hash string, n int, expr string) (string, error) {
+	if n == 0 {
+		return hash, nil
+	}
+	c, err := objects.ReadCommit(hash)
+	if err != nil {
+		return "", err
+	}
+	if n > len(c.Parents) {
+		return "", fmt.Errorf("unknown revision %s, commit has %d parent(s)", expr, len(c.Parents))
+	}
+	return c.Parents[n-1], nil
+}
+
+// Handle "^{<type>}" suffix. An empty type peels tags until a non-tag
+// object is reached.
+func peelTo(hash, objectType string) (string, error) {
+	switch objects.ObjectType(objectType) {
+	case "":
+		for {
+			o, err := objects.Read(hash)
+			if err != nil {
+				return "", err
+			}
+			t, ok := o.(objects.Tag)
+			if !ok {
+				return hash, nil
+			}
+			hash = t.Object
+		}
+	case objects.CommitObject, objects.TreeObject, objects.BlobObject, objects.TagObject:
+		return Peel(hash, objects.ObjectType(objectType))
+	}
+	return "", fmt.Errorf("unknown object type %s", objectType)
+}
+
+// Find first occurrence of any of chars which is not inside of "{...}".
+func indexOutsideBraces(s, chars string) int {
+	depth := 0
+	for i, c := range s {
+		switch {
+		case c == '{':
+			depth++
+		case c == '}' && depth > 0:
+			depth--
+		case depth == 0 && strings.ContainsRune(chars, c):
+			return i
+		}
+	}
+	return -1
+}
+
+func isHex(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, c := range s {
+		if !strings.ContainsRune("0123456789abcdefABCDEF", c) {
+			return false
+		}
+	}
+	return true
+}
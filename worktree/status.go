@@ -0,0 +1,310 @@
+package worktree
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/antoniszczepanik/gggit/common"
+	"github.com/antoniszczepanik/gggit/ignore"
+	"github.com/antoniszczepanik/gggit/index"
+	"github.com/antoniszczepanik/gggit/objects"
+)
+
+type ChangeKind byte
+
+const (
+	Added    ChangeKind = 'A'
+	Modified ChangeKind = 'M'
+	Deleted  ChangeKind = 'D'
+)
+
+func (k ChangeKind) String() string {
+	switch k {
+	case Added:
+		return "new file"
+	case Modified:
+		return "modified"
+	case Deleted:
+		return "deleted"
+	}
+	return "unknown"
+}
+
+type Change struct {
+	Path string
+	Kind ChangeKind
+}
+
+// A path with conflicting versions left in the index by a merge.
+type Unmerged struct {
+	Path string
+	// Which of base, ours and theirs versions are present, indexed by their
+	// stage numbers.
+	Stages [4]bool
+}
+
+// Get two letter code describing the conflict, the same as used by
+// porcelain status.
+func (u Unmerged) Code() string {
+	base, ours, theirs := u.Stages[1], u.Stages[2], u.Stages[3]
+	switch {
+	case base && ours && theirs:
+		return "UU"
+	case ours && theirs:
+		return "AA"
+	case base && ours:
+		return "UD"
+	case base && theirs:
+		return "DU"
+	case ours:
+		return "AU"
+	case theirs:
+		return "UA"
+	}
+	return "DD"
+}
+
+func (u Unmerged) String() string {
+	switch u.Code() {
+	case "UU":
+		return "both modified"
+	case "AA":
+		return "both added"
+	case "UD":
+		return "deleted by them"
+	case "DU":
+		return "deleted by us"
+	case "AU":
+		return "added by us"
+	case "UA":
+		return "added by them"
+	}
+	return "both deleted"
+}
+
+type Status struct {
+	// Differences between HEAD tree and the index.
+	Staged []Change
+	// Differences between the index and working directory.
+	Unstaged []Change
+	// Files present in working directory, but not in the index. Directories
+	// without a single tracked file are reported as a whole, with a trailing
+	// slash.
+	Untracked []string
+	// Paths with unresolved merge conflicts.
+	Unmerged []Unmerged
+}
+
+func (s *Status) Clean() bool {
+	return len(s.Staged) == 0 && len(s.Unstaged) == 0 && len(s.Untracked) == 0 && len(s.Unmerged) == 0
+}
+
+// Compare HEAD tree, the index and working directory.
+func GetStatus(repoRoot, headTree string) (*Status, error) {
+	head, err := ReadFlatTree(headTree)
+	if err != nil {
+		return nil, err
+	}
+	idx, err := index.Read()
+	if err != nil {
+		return nil, err
+	}
+	s := &Status{}
+	s.Staged = stagedChanges(head, idx)
+	s.Unmerged = unmergedPaths(idx)
+	if s.Unstaged, err = unstagedChanges(repoRoot, idx); err != nil {
+		return nil, err
+	}
+	m, err := ignore.New(repoRoot)
+	if err != nil {
+		return nil, err
+	}
+	if s.Untracked, err = untrackedFiles(repoRoot, idx, m); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func stagedChanges(head map[string]objects.TreeEntry, idx *index.Index) []Change {
+	var changes []Change
+	inIndex := make(map[string]bool)
+	for _, e := range idx.Entries {
+		inIndex[e.Path] = true
+		if e.Stage != 0 {
+			continue
+		}
+		headEntry, ok := head[e.Path]
+		if !ok {
+			changes = append(changes, Change{Path: e.Path, Kind: Added})
+		} else if headEntry.Hash != e.Hash || headEntry.Mode != e.Mode {
+			changes = append(changes, Change{Path: e.Path, Kind: Modified})
+		}
+	}
+	for path := range head {
+		if !inIndex[path] {
+			changes = append(changes, Change{Path: path, Kind: Deleted})
+		}
+	}
+	sortChanges(changes)
+	return changes
+}
+
+func unstagedChanges(repoRoot string, idx *index.Index) ([]Change, error) {
+	var changes []Change
+	for _, e := range idx.Entries {
+		if e.Stage != 0 {
+			continue
+		}
+		modified, err := IsModified(repoRoot, e)
+		if os.IsNotExist(err) {
+			changes = append(changes, Change{Path: e.Path, Kind: Deleted})
+		} else if err != nil {
+			return nil, err
+		} else if modified {
+			changes = append(changes, Change{Path: e.Path, Kind: Modified})
+		}
+	}
+	return changes, nil
+}
+
+// Check if working directory file differs from its index entry, either in
+// content or in mode. Files with size and modification time matching the
+// entry are assumed to have unchanged content, without reading it.
+func IsModified(repoRoot string, e index.Entry) (bool, error) {
+	fi, err := os.Lstat(filepath.Join(repoRoot, filepath.FromSlash(e.Path)))
+	if err != nil {
+		return false, err
+	}
+	// Submodules are not checked out by gggit, so they are never modified.
+	if e.Mode == objects.ModeGitlink {
+		return false, nil
+	}
+	if fi.IsDir() {
+		return false, &fs.PathError{Op: "lstat", Path: e.Path, Err: fs.ErrNotExist}
+	}
+	if objects.ModeFromFileInfo(fi) != e.Mode {
+		return true, nil
+	}
+	if fi.Size() == e.Size && fi.ModTime().Equal(e.MTime) {
+		return false, nil
+	}
+	hash, err := HashFile(repoRoot, e.Path)
+	if err != nil {
+		return false, err
+	}
+	return hash != e.Hash, nil
+}
+
+func unmergedPaths(idx *index.Index) []Unmerged {
+	var unmerged []Unmerged
+	for _, e := range idx.Entries {
+		if e.Stage == 0 {
+			continue
+		}
+		// Entries of the same path are next to each other.
+		if len(unmerged) == 0 || unmerged[len(unmerged)-1].Path != e.Path {
+			unmerged = append(unmerged, Unmerged{Path: e.Path})
+		}
+		unmerged[len(unmerged)-1].Stages[e.Stage] = true
+	}
+	return unmerged
+}
+
+// Find files which are neither tracked nor ignored.
+func untrackedFiles(repoRoot string, idx *index.Index, m *ignore.Matcher) ([]string, error) {
+	tracked := make(map[string]bool)
+	trackedDirs := make(map[string]bool)
+	for _, e := range idx.Entries {
+		tracked[e.Path] = true
+		for dir := e.Path; strings.Contains(dir, "/"); {
+			dir = dir[:strings.LastIndex(dir, "/")]
+			trackedDirs[dir] = true
+		}
+	}
+	var untracked []string
+	err := filepath.WalkDir(repoRoot, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if path == repoRoot {
+			return nil
+		}
+		relPath, err := common.RepoRelPath(repoRoot, path)
+		if err != nil {
+			return err
+		}
+		if tracked[relPath] {
+			return nil
+		}
+		ignored, err := m.IsIgnored(relPath, d.IsDir())
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() {
+			if !ignored {
+				untracked = append(untracked, relPath)
+			}
+			return nil
+		}
+		if trackedDirs[relPath] {
+			return nil
+		}
+		if ignored {
+			return filepath.SkipDir
+		}
+		// Report directory as a whole, but only if there is anything in it.
+		hasFiles, err := containsFiles(repoRoot, path, m)
+		if err != nil {
+			return err
+		}
+		if hasFiles {
+			untracked = append(untracked, relPath+"/")
+		}
+		return filepath.SkipDir
+	})
+	if err != nil {
+		return nil, err
+	}
+	return untracked, nil
+}
+
+var errFileFound = errors.New("file found")
+
+// Check whether a directory contains any files that are not ignored.
+func containsFiles(repoRoot, dir string, m *ignore.Matcher) (bool, error) {
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if path == dir {
+			return nil
+		}
+		relPath, err := common.RepoRelPath(repoRoot, path)
+		if err != nil {
+			return err
+		}
+		ignored, err := m.IsIgnored(relPath, d.IsDir())
+		if err != nil {
+			return err
+		}
+		switch {
+		case ignored && d.IsDir():
+			return filepath.SkipDir
+		case !ignored && !d.IsDir():
+			return errFileFound
+		}
+		return nil
+	})
+	if err == errFileFound {
+		return true, nil
+	}
+	return false, err
+}
+
+func sortChanges(changes []Change) {
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Path < changes[j].Path })
+}
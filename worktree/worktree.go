@@ -0,0 +1,413 @@
+package worktree
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+
+	"github.com/antoniszczepanik/gggit/index"
+	"github.com/antoniszczepanik/gggit/objects"
+)
+
+// Read a tree by hash and flatten it. Empty hash stands for an empty tree,
+// e.g. of a branch without any commits.
+func ReadFlatTree(hash string) (map[string]objects.TreeEntry, error) {
+	if hash == "" {
+		return map[string]objects.TreeEntry{}, nil
+	}
+	t, err := objects.ReadTree(hash)
+	if err != nil {
+		return nil, err
+	}
+	return t.Flatten()
+}
+
+// Calculate blob hash of a file in working directory.
+func HashFile(repoRoot, path string) (string, error) {
+	fullPath := filepath.Join(repoRoot, filepath.FromSlash(path))
+	fi, err := os.Lstat(fullPath)
+	if err != nil {
+		return "", err
+	}
+	blob, err := objects.NewBlobFromPath(fullPath, fi)
+	if err != nil {
+		return "", err
+	}
+	return objects.CalculateHash(blob)
+}
+
+// Write blob an entry points at into working directory, creating missing
+// parent directories on the way. Symlinks are recreated and executable
+// files get their execute bits, subject to umask.
+func WriteFile(repoRoot, path string, e objects.TreeEntry) error {
+	fullPath := filepath.Join(repoRoot, filepath.FromSlash(path))
+	if err := makeParentDirs(repoRoot, path); err != nil {
+		return err
+	}
+	// Content is streamed, so that large files never have to fit in memory.
+	_, _, r, err := objects.Open(e.Hash)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	// Whatever is there gets replaced rather than overwritten, so that
+	// permissions and file type are those of the new entry. A directory
+	// could be standing in a way of a file as well.
+	if err := os.RemoveAll(fullPath); err != nil {
+		return err
+	}
+	perm := os.FileMode(0644)
+	switch e.Mode {
+	case objects.ModeSymlink:
+		target, err := io.ReadAll(r)
+		if err != nil {
+			return err
+		}
+		return os.Symlink(string(target), fullPath)
+	case objects.ModeExecutable:
+		perm = 0755
+	}
+	f, err := os.OpenFile(fullPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// Write arbitrary content to a file in working directory, creating missing
+// parent directories on the way.
+func WriteContent(repoRoot, path, content string) error {
+	if err := makeParentDirs(repoRoot, path); err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(repoRoot, filepath.FromSlash(path)), []byte(content), 0644)
+}
+
+// Create all parent directories of a path, removing files that are in the
+// way.
+func makeParentDirs(repoRoot, path string) error {
+	dir := repoRoot
+	components := strings.Split(path, "/")
+	for _, c := range components[:len(components)-1] {
+		dir = filepath.Join(dir, c)
+		fi, err := os.Lstat(dir)
+		if err == nil && fi.IsDir() {
+			continue
+		}
+		if err == nil {
+			if err := os.Remove(dir); err != nil {
+				return err
+			}
+		} else if !os.IsNotExist(err) {
+			return err
+		}
+		if err := os.Mkdir(dir, 0755); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Remove a file from working directory together with all of its parent
+// directories that became empty.
+func RemoveFile(repoRoot, path string) error {
+	fullPath := filepath.Join(repoRoot, filepath.FromSlash(path))
+	if err := os.Remove(fullPath); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	for dir := filepath.Dir(fullPath); dir != repoRoot; dir = filepath.Dir(dir) {
+		// Fails for non-empty directories, which is exactly when we stop.
+		if os.Remove(dir) != nil {
+			break
+		}
+	}
+	return nil
+}
+
+// Create an index entry for a file that was just written out from a tree.
+func NewIndexEntry(repoRoot, path string, e objects.TreeEntry) (index.Entry, error) {
+	fi, err := os.Lstat(filepath.Join(repoRoot, filepath.FromSlash(path)))
+	if err != nil {
+		return index.Entry{}, err
+	}
+	return index.Entry{
+		Path:  path,
+		Mode:  e.Mode,
+		Hash:  e.Hash,
+		Size:  fi.Size(),
+		MTime: fi.ModTime(),
+	}, nil
+}
+
+type CheckoutError struct {
+	// Tracked files with local modifications.
+	Modified []string
+	// Untracked files that would be overwritten by the checkout.
+	Untracked []string
+}
+
+func (e *CheckoutError) Error() string {
+	msg := ""
+	if len(e.Modified) > 0 {
+		msg += "your local changes to the following files would be overwritten by checkout:\n"
+		for _, path := range e.Modified {
+			msg += "\t" + path + "\n"
+		}
+	}
+	if len(e.Untracked) > 0 {
+		msg += "the following untracked working tree files would be overwritten by checkout:\n"
+		for _, path := range e.Untracked {
+			msg += "\t" + path + "\n"
+		}
+	}
+	return msg + "commit your changes or use --force to discard them"
+}
+
+// Switch working directory and index from one tree to another. Files that
+// are the same in both trees are left untouched, so are their local
+// modifications. Unless forced, refuses to overwrite any local changes.
+func Checkout(repoRoot, fromTree, toTree string, force bool) error {
+	from, err := ReadFlatTree(fromTree)
+	if err != nil {
+		return err
+	}
+	to, err := ReadFlatTree(toTree)
+	if err != nil {
+		return err
+	}
+	idx, err := index.Read()
+	if err != nil {
+		return err
+	}
+	if idx.HasConflicts() && !force {
+		return errors.New("you need to resolve your current index first")
+	}
+	changed := changedPaths(from, to)
+	if !force {
+		if err := checkLocalChanges(repoRoot, idx, from, to, changed); err != nil {
+			return err
+		}
+	}
+
+	newIdx := &index.Index{}
+	// Deletions go first, so that directories can be replaced by files.
+	for _, path := range changed {
+		if _, ok := to[path]; !ok {
+			if err := RemoveFile(repoRoot, path); err != nil {
+				return err
+			}
+		}
+	}
+	for _, path := range sortedPaths(to) {
+		e := to[path]
+		if old, ok := from[path]; ok && sameEntry(old, e) && !force {
+			// Carry over index entry together with whatever was staged.
+			// Missing entry means that removal of the file is staged.
+			if idxEntry, ok := idx.Get(path); ok {
+				newIdx.Add(idxEntry)
+			}
+			continue
+		}
+		if err := WriteFile(repoRoot, path, e); err != nil {
+			return fmt.Errorf("checkout %s: %w", path, err)
+		}
+		idxEntry, err := NewIndexEntry(repoRoot, path, e)
+		if err != nil {
+			return err
+		}
+		newIdx.Add(idxEntry)
+	}
+	// Newly staged files not known to any of the trees stay staged.
+	if !force {
+		for _, e := range idx.Entries {
+			if e.Stage != 0 {
+				continue
+			}
+			_, inFrom := from[e.Path]
+			_, inTo := to[e.Path]
+			if !inFrom && !inTo {
+				newIdx.Add(e)
+			}
+		}
+	}
+	return newIdx.Write()
+}
+
+// Verify that switching trees is not going to overwrite any local changes.
+func checkLocalChanges(repoRoot string, idx *index.Index, from, to map[string]objects.TreeEntry, changed []string) error {
+	checkoutErr := &CheckoutError{}
+	for _, path := range changed {
+		old, tracked := from[path]
+		target, inTarget := to[path]
+		idxEntry, staged := idx.Get(path)
+		if staged && tracked && idxEntry.Hash != old.Hash && !(inTarget && idxEntry.Hash == target.Hash) {
+			checkoutErr.Modified = append(checkoutErr.Modified, path)
+			continue
+		}
+		fullPath := filepath.Join(repoRoot, filepath.FromSlash(path))
+		if fi, err := os.Lstat(fullPath); err == nil && fi.IsDir() {
+			// A directory standing where a file should be is removed with
+			// everything inside, which has to be tracked and go away.
+			if err := checkDirectory(repoRoot, path, idx, from, checkoutErr); err != nil {
+				return err
+			}
+			continue
+		}
+		hash, err := HashFile(repoRoot, path)
+		if os.IsNotExist(err) {
+			continue
+		} else if errors.Is(err, syscall.ENOTDIR) {
+			// One of parents is a file, which has to be tracked to be
+			// replaced by a directory. It is checked on its own then.
+			if file := fileInPath(repoRoot, path); file != "" {
+				if _, ok := from[file]; !ok && !contains(checkoutErr.Untracked, file) {
+					checkoutErr.Untracked = append(checkoutErr.Untracked, file)
+				}
+			}
+			continue
+		} else if err != nil {
+			return err
+		}
+		if inTarget && hash == target.Hash {
+			continue
+		}
+		if tracked && hash != old.Hash {
+			checkoutErr.Modified = append(checkoutErr.Modified, path)
+		} else if !tracked && !staged {
+			checkoutErr.Untracked = append(checkoutErr.Untracked, path)
+		} else if !tracked && staged {
+			checkoutErr.Modified = append(checkoutErr.Modified, path)
+		}
+	}
+	if len(checkoutErr.Modified) > 0 || len(checkoutErr.Untracked) > 0 {
+		return checkoutErr
+	}
+	return nil
+}
+
+// Report files inside of a directory which are not tracked in the tree
+// checked out from, or are staged, as they would be lost.
+func checkDirectory(repoRoot, dir string, idx *index.Index, from map[string]objects.TreeEntry, checkoutErr *CheckoutError) error {
+	return filepath.WalkDir(filepath.Join(repoRoot, filepath.FromSlash(dir)), func(fullPath string, d os.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(repoRoot, fullPath)
+		if err != nil {
+			return err
+		}
+		path := filepath.ToSlash(rel)
+		old, tracked := from[path]
+		idxEntry, staged := idx.Get(path)
+		switch {
+		case staged && (!tracked || idxEntry.Hash != old.Hash):
+			checkoutErr.Modified = append(checkoutErr.Modified, path)
+		case !tracked:
+			checkoutErr.Untracked = append(checkoutErr.Untracked, path)
+		}
+		return nil
+	})
+}
+
+// Find the first component of a path that is not a directory in working
+// directory. Returns empty string if there is none.
+func fileInPath(repoRoot, path string) string {
+	components := strings.Split(path, "/")
+	for i := range components {
+		prefix := strings.Join(components[:i+1], "/")
+		fi, err := os.Lstat(filepath.Join(repoRoot, filepath.FromSlash(prefix)))
+		if err != nil {
+			return ""
+		}
+		if !fi.IsDir() {
+			return prefix
+		}
+	}
+	return ""
+}
+
+func contains(paths []string, path string) bool {
+	for _, p := range paths {
+		if p == path {
+			return true
+		}
+	}
+	return false
+}
+
+// Get sorted paths that differ between two flattened trees.
+func changedPaths(from, to map[string]objects.TreeEntry) []string {
+	var paths []string
+	for path, e := range from {
+		if other, ok := to[path]; !ok || !sameEntry(e, other) {
+			paths = append(paths, path)
+		}
+	}
+	for path := range to {
+		if _, ok := from[path]; !ok {
+			paths = append(paths, path)
+		}
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+func sameEntry(a, b objects.TreeEntry) bool {
+	return a.Mode == b.Mode && a.Hash == b.Hash
+}
+
+func sortedPaths(entries map[string]objects.TreeEntry) []string {
+	paths := make([]string, 0, len(entries))
+	for path := range entries {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// Build an in-memory tree of tracked files as they are in working
+// directory. Files that did not change since they were staged point at
+// their staged blobs, modified files carry their current content. Deleted
+// files are left out.
+func WorkdirTree(repoRoot string, idx *index.Index) (objects.Tree, error) {
+	files := make(map[string]objects.TreeEntry)
+	for _, e := range idx.Entries {
+		if e.Stage != 0 {
+			continue
+		}
+		modified, err := IsModified(repoRoot, e)
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		if !modified {
+			files[e.Path] = objects.TreeEntry{Mode: e.Mode, Hash: e.Hash}
+			continue
+		}
+		fullPath := filepath.Join(repoRoot, filepath.FromSlash(e.Path))
+		fi, err := os.Lstat(fullPath)
+		if err != nil {
+			return nil, err
+		}
+		blob, err := objects.NewBlobFromPath(fullPath, fi)
+		if err != nil {
+			return nil, err
+		}
+		entry, err := objects.NewTreeEntry(objects.ModeFromFileInfo(fi), "", blob)
+		if err != nil {
+			return nil, err
+		}
+		files[e.Path] = entry
+	}
+	return objects.NewTreeFromEntries(files)
+}
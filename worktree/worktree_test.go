@@ -0,0 +1,210 @@
+package worktree
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/antoniszczepanik/gggit/index"
+	"github.com/antoniszczepanik/gggit/internal/testrepo"
+	"github.com/antoniszczepanik/gggit/objects"
+)
+
+// Write a tree of files with given content, keyed by their paths.
+func writeTree(t *testing.T, files map[string]string) string {
+	t.Helper()
+	entries := make(map[string]objects.TreeEntry)
+	for path, content := range files {
+		e, err := objects.NewTreeEntry(objects.ModeRegular, "", objects.NewBlob(content))
+		if err != nil {
+			t.Fatal(err)
+		}
+		entries[path] = e
+	}
+	tree, err := objects.NewTreeFromEntries(entries)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := tree.Write(); err != nil {
+		t.Fatal(err)
+	}
+	hash, err := objects.CalculateHash(tree)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return hash
+}
+
+// Get content of all files in working directory, keyed by their paths.
+func readWorkdir(t *testing.T, repoRoot string) map[string]string {
+	t.Helper()
+	files := make(map[string]string)
+	err := filepath.Walk(repoRoot, func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if fi.IsDir() && fi.Name() == ".gggit" {
+			return filepath.SkipDir
+		}
+		if fi.IsDir() {
+			return nil
+		}
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(repoRoot, path)
+		if err != nil {
+			return err
+		}
+		files[filepath.ToSlash(rel)] = string(content)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return files
+}
+
+func indexPaths(t *testing.T) []string {
+	t.Helper()
+	idx, err := index.Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var paths []string
+	for _, e := range idx.Entries {
+		paths = append(paths, e.Path)
+	}
+	return paths
+}
+
+func TestCheckoutFileDirectory(t *testing.T) {
+	file := map[string]string{"a": "file\n", "c": "c\n"}
+	dir := map[string]string{"a/b": "nested\n", "a/d/e": "deeper\n", "c": "c\n"}
+	tests := []struct {
+		name     string
+		from, to map[string]string
+	}{
+		{"file to directory", file, dir},
+		{"directory to file", dir, file},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			repoRoot := testrepo.Init(t)
+			from, to := writeTree(t, test.from), writeTree(t, test.to)
+			if err := Checkout(repoRoot, "", from, false); err != nil {
+				t.Fatal(err)
+			}
+			if err := Checkout(repoRoot, from, to, false); err != nil {
+				t.Fatal(err)
+			}
+			if got := readWorkdir(t, repoRoot); !reflect.DeepEqual(got, test.to) {
+				t.Errorf("working directory has %v, want %v", got, test.to)
+			}
+			var want []string
+			for path := range test.to {
+				want = append(want, path)
+			}
+			sort.Strings(want)
+			if got := indexPaths(t); !reflect.DeepEqual(got, want) {
+				t.Errorf("index has %v, want %v", got, want)
+			}
+			// And back again.
+			if err := Checkout(repoRoot, to, from, false); err != nil {
+				t.Fatal(err)
+			}
+			if got := readWorkdir(t, repoRoot); !reflect.DeepEqual(got, test.from) {
+				t.Errorf("working directory has %v after switching back, want %v", got, test.from)
+			}
+		})
+	}
+}
+
+func TestCheckoutKeepsFilesInTheWay(t *testing.T) {
+	tests := []struct {
+		name          string
+		from, to      map[string]string
+		write         map[string]string
+		stage         string
+		wantModified  []string
+		wantUntracked []string
+	}{
+		{
+			name:          "untracked file inside a directory replaced by a file",
+			from:          map[string]string{"a/b": "b\n"},
+			to:            map[string]string{"a": "a\n"},
+			write:         map[string]string{"a/new": "new\n"},
+			wantUntracked: []string{"a/new"},
+		},
+		{
+			name:         "staged file inside a directory replaced by a file",
+			from:         map[string]string{"a/b": "b\n"},
+			to:           map[string]string{"a": "a\n"},
+			write:        map[string]string{"a/new": "new\n"},
+			stage:        "a/new",
+			wantModified: []string{"a/new"},
+		},
+		{
+			name:         "modified file replaced by a directory",
+			from:         map[string]string{"a": "a\n"},
+			to:           map[string]string{"a/b": "b\n"},
+			write:        map[string]string{"a": "changed\n"},
+			wantModified: []string{"a"},
+		},
+		{
+			name:          "untracked file in place of a new directory",
+			from:          map[string]string{"c": "c\n"},
+			to:            map[string]string{"a/b": "b\n", "c": "c\n"},
+			write:         map[string]string{"a": "untracked\n"},
+			wantUntracked: []string{"a"},
+		},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			repoRoot := testrepo.Init(t)
+			from, to := writeTree(t, test.from), writeTree(t, test.to)
+			if err := Checkout(repoRoot, "", from, false); err != nil {
+				t.Fatal(err)
+			}
+			for path, content := range test.write {
+				if err := WriteContent(repoRoot, path, content); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if test.stage != "" {
+				idx, err := index.Read()
+				if err != nil {
+					t.Fatal(err)
+				}
+				e, err := index.NewEntryFromFile(repoRoot, test.stage)
+				if err != nil {
+					t.Fatal(err)
+				}
+				idx.Add(e)
+				if err := idx.Write(); err != nil {
+					t.Fatal(err)
+				}
+			}
+			err := Checkout(repoRoot, from, to, false)
+			var checkoutErr *CheckoutError
+			if !errors.As(err, &checkoutErr) {
+				t.Fatalf("got error %v, want a checkout error", err)
+			}
+			if !reflect.DeepEqual(checkoutErr.Modified, test.wantModified) || !reflect.DeepEqual(checkoutErr.Untracked, test.wantUntracked) {
+				t.Errorf("got modified %v and untracked %v, want %v and %v",
+					checkoutErr.Modified, checkoutErr.Untracked, test.wantModified, test.wantUntracked)
+			}
+			for path, content := range test.write {
+				if got, err := os.ReadFile(filepath.Join(repoRoot, path)); err != nil || string(got) != content {
+					t.Errorf("%s was changed", path)
+				}
+			}
+		})
+	}
+}